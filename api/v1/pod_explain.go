@@ -0,0 +1,333 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+)
+
+// ExplainPath - path of the debug endpoint which explains the webhook decision for a Pod.
+const ExplainPath = "/debug/explain"
+
+// ExplainStep - one step of the webhook decision chain.
+type ExplainStep struct {
+	Name    string `json:"name"`
+	Result  bool   `json:"result"`
+	Message string `json:"message"`
+}
+
+// Explanation - evaluation of the webhook decision chain for an existing Pod.
+type Explanation struct {
+	Pod   string        `json:"pod"`
+	Steps []ExplainStep `json:"steps"`
+	// Attached - the webhook would add Linkerd CNI network to the Pod.
+	Attached bool `json:"attached"`
+	// AttachDefinition - the AttachDefinition which is effective in the Pod's Namespace.
+	AttachDefinition *cniv1alpha1.AttachDefinition `json:"attachDefinition,omitempty"`
+	// CurrentConfig - CNI configuration of the Namespace's NetworkAttachmentDefinition.
+	CurrentConfig string `json:"currentConfig,omitempty"`
+	// RenderedConfig - CNI configuration which the operator renders for the AttachDefinition.
+	RenderedConfig string `json:"renderedConfig,omitempty"`
+	// ExpectedAnnotations - annotations which the webhook would set on the Pod.
+	ExpectedAnnotations map[string]string `json:"expectedAnnotations,omitempty"`
+	// Mismatches - differences between the expected and the actual state.
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+func (e *Explanation) step(name string, result bool, format string, args ...interface{}) {
+	e.Steps = append(e.Steps, ExplainStep{Name: name, Result: result, Message: fmt.Sprintf(format, args...)})
+}
+
+// Explainer evaluates the same decision chain as PodAnnotator against existing objects.
+type Explainer struct {
+	Client client.Client
+	// InstanceName - the operator instance whose webhook decision is explained.
+	InstanceName string
+	// Render, if set, renders the NetworkAttachmentDefinition which the operator maintains
+	// for an AttachDefinition, it is used to detect configuration drift.
+	Render func(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition) (
+		*netattachv1.NetworkAttachmentDefinition, error)
+}
+
+// Explain - explains why the webhook would or would not attach Linkerd CNI network to the Pod.
+// nolint:funlen,gocyclo // sequential steps of the decision chain.
+func (e *Explainer) Explain(ctx context.Context, podRef client.ObjectKey) (*Explanation, error) {
+	var (
+		logger      = logr.Discard()
+		explanation = &Explanation{Pod: podRef.String()}
+		pod         = &corev1.Pod{}
+	)
+
+	if err := e.Client.Get(ctx, podRef, pod); err != nil {
+		return nil, err
+	}
+
+	// Namespace must belong to the operator instance.
+	owned, err := isNamespaceOwned(ctx, e.Client, pod.Namespace, e.InstanceName)
+	if err != nil {
+		explanation.step("instance", false, "can not get Namespace: %v", err)
+
+		return explanation, nil
+	}
+
+	explanation.step("instance", owned, "Namespace belongs to the operator instance: %t", owned)
+
+	if !owned {
+		explanation.step("decision", false, "the Pod is handled by another operator instance")
+
+		return explanation, nil
+	}
+
+	if controllers.IsLinkerdInjectDisabled(pod.Annotations) {
+		explanation.step("pod-opt-out", false, "Pod annotation %s=%s", constants.LinkerdInjectAnnotation,
+			constants.LinkerdInjectDisabled)
+		explanation.step("decision", false, "the Pod opts out of Linkerd proxy inject")
+		explanation.compare(pod, nil)
+
+		return explanation, nil
+	}
+
+	// Step 1 and 2: injection is requested by the Pod or its Namespace.
+	var requested = isCNIRequestedByPod(logger, pod)
+
+	explanation.step("pod-annotation", requested, "Pod annotation %s=%q",
+		constants.LinkerdInjectAnnotation, pod.Annotations[constants.LinkerdInjectAnnotation])
+
+	if !requested {
+		requested, err = isCNIRequestedByNamespace(ctx, pod.Namespace, logger, e.Client)
+		if err != nil {
+			explanation.step("namespace-annotation", false, "can not get Namespace: %v", err)
+
+			return explanation, nil
+		}
+
+		explanation.step("namespace-annotation", requested, "Namespace %s requests injection: %t",
+			pod.Namespace, requested)
+	}
+
+	// Effective AttachDefinition of the Namespace.
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := e.Client.List(ctx, attachDefinitions, client.InNamespace(pod.Namespace)); err != nil {
+		explanation.step("attach-definition", false, "can not list AttachDefinitions: %v", err)
+	} else {
+		for i := range attachDefinitions.Items {
+			if attachDefinitions.Items[i].Spec.CreateMultusNetworkAttachmentDefinition {
+				explanation.AttachDefinition = &attachDefinitions.Items[i]
+
+				break
+			}
+		}
+
+		if explanation.AttachDefinition != nil {
+			explanation.step("attach-definition", true, "AttachDefinition %s requests NetworkAttachmentDefinition",
+				explanation.AttachDefinition.Name)
+		} else {
+			explanation.step("attach-definition", false,
+				"Namespace has no AttachDefinition with createMultusNetworkAttachmentDefinition=true")
+		}
+	}
+
+	if !requested {
+		explanation.step("decision", false, "neither Pod nor Namespace requested Linkerd proxy inject")
+		explanation.compare(pod, nil)
+
+		return explanation, nil
+	}
+
+	// Step 3: NetworkAttachmentDefinition in the Pod's Namespace.
+	multus, err := getMultus(ctx, logger, e.Client, pod.Namespace)
+	if err != nil {
+		explanation.step("network-attachment-definition", false, "%v", err)
+		explanation.step("decision", false, "the webhook returns an error, the Pod is admitted without mutation")
+		explanation.compare(pod, nil)
+
+		return explanation, nil
+	}
+
+	explanation.CurrentConfig = multus.Spec.Config
+	explanation.step("network-attachment-definition", true, "NetworkAttachmentDefinition %s/%s is found",
+		multus.Namespace, multus.Name)
+
+	if explanation.AttachDefinition != nil && e.Render != nil {
+		rendered, err := e.Render(ctx, explanation.AttachDefinition)
+		if err != nil {
+			explanation.step("render", false, "can not render NetworkAttachmentDefinition: %v", err)
+		} else {
+			explanation.RenderedConfig = rendered.Spec.Config
+			explanation.step("render", true, "NetworkAttachmentDefinition is rendered from the AttachDefinition")
+		}
+	}
+
+	// Step 4: annotations which the webhook would set.
+	cniArgs, err := controllers.PodCNIArgs(pod.Annotations)
+
+	// The Pod's ports to ignore are added to the NetworkAttachmentDefinition's ones.
+	var baseCNIConfig = &controllers.CNIPluginConf{}
+	if json.Unmarshal([]byte(multus.Spec.Config), baseCNIConfig) == nil {
+		cniArgs = controllers.MergeCNIArgs(baseCNIConfig, cniArgs)
+	}
+
+	if err != nil {
+		explanation.step("cni-args", false, "invalid annotations are not passed to Linkerd CNI: %v", err)
+	} else if len(cniArgs) != 0 {
+		explanation.step("cni-args", true, "Pod annotations are passed to Linkerd CNI as cni-args %v", cniArgs)
+	}
+
+	var expected = pod.DeepCopy()
+	if expected.Annotations == nil {
+		expected.Annotations = map[string]string{}
+	}
+
+	if _, ok := pod.Annotations[constants.LinkerdProxyUIDAnnotation]; !ok {
+		var linkerdCNIConfig = &controllers.CNIPluginConf{}
+
+		if err = json.Unmarshal([]byte(multus.Spec.Config), linkerdCNIConfig); err != nil {
+			explanation.step("proxy-uid", false, "can not parse NetworkAttachmentDefinition config: %v", err)
+			explanation.step("decision", false, "the webhook returns an error, the Pod is admitted without mutation")
+			explanation.compare(pod, nil)
+
+			return explanation, nil
+		}
+
+		expected.Annotations[constants.LinkerdProxyUIDAnnotation] = strconv.Itoa(linkerdCNIConfig.Linkerd.ProxyUID)
+		explanation.step("proxy-uid", true, "proxy UID %d is taken from NetworkAttachmentDefinition",
+			linkerdCNIConfig.Linkerd.ProxyUID)
+	} else {
+		explanation.step("proxy-uid", true, "Pod sets %s=%s", constants.LinkerdProxyUIDAnnotation,
+			pod.Annotations[constants.LinkerdProxyUIDAnnotation])
+	}
+
+	if expected, err = patchPodNetworks(logger, expected, cniArgs); err != nil {
+		explanation.step("networks-annotation", false, "%s is invalid: %v", constants.MultusNetworkAttachAnnotation, err)
+		explanation.step("decision", false, "the webhook returns an error, the Pod is admitted without mutation")
+		explanation.compare(pod, nil)
+
+		return explanation, nil
+	}
+
+	explanation.step("networks-annotation", true, "%s=%q", constants.MultusNetworkAttachAnnotation,
+		expected.Annotations[constants.MultusNetworkAttachAnnotation])
+
+	// The conflicts are warnings or denials depending on webhook.proxyConflicts of the operator configuration.
+	var linkerdCNIConfig = &controllers.CNIPluginConf{}
+
+	if err = json.Unmarshal([]byte(multus.Spec.Config), linkerdCNIConfig); err == nil {
+		if err = controllers.ApplyCNIArgs(linkerdCNIConfig, cniArgs); err == nil {
+			if conflicts := proxyConflicts(pod, &linkerdCNIConfig.Linkerd); len(conflicts) != 0 {
+				explanation.step("proxy-conflicts", false, "%s", strings.Join(conflicts, "; "))
+			} else {
+				explanation.step("proxy-conflicts", true, "Pod does not conflict with the Linkerd proxy")
+			}
+		}
+	}
+
+	explanation.Attached = true
+	explanation.ExpectedAnnotations = map[string]string{
+		constants.LinkerdProxyUIDAnnotation:     expected.Annotations[constants.LinkerdProxyUIDAnnotation],
+		constants.MultusNetworkAttachAnnotation: expected.Annotations[constants.MultusNetworkAttachAnnotation],
+	}
+	explanation.step("decision", true, "the webhook attaches Linkerd CNI network")
+	explanation.compare(pod, expected)
+
+	return explanation, nil
+}
+
+// compare - records mismatches between the Pod and the expected state.
+func (e *Explanation) compare(pod, expected *corev1.Pod) {
+	var requestsCNI = controllers.PodRequestsLinkerdCNI(pod)
+
+	switch {
+	case expected == nil && requestsCNI:
+		e.Mismatches = append(e.Mismatches,
+			"Pod has Linkerd CNI network, but the webhook would not attach it now")
+	case expected != nil && !requestsCNI:
+		e.Mismatches = append(e.Mismatches,
+			"Pod has no Linkerd CNI network, it was created while the webhook did not attach it; recreate the Pod")
+	}
+
+	if expected != nil {
+		var (
+			current = pod.Annotations[constants.LinkerdProxyUIDAnnotation]
+			want    = expected.Annotations[constants.LinkerdProxyUIDAnnotation]
+		)
+
+		if current != "" && current != want {
+			e.Mismatches = append(e.Mismatches, fmt.Sprintf("Pod %s=%s, expected %s",
+				constants.LinkerdProxyUIDAnnotation, current, want))
+		}
+	}
+
+	if requestsCNI && pod.Status.Phase == corev1.PodRunning {
+		attached, err := controllers.HasLinkerdCNINetworkStatus(pod)
+		if err != nil || !attached {
+			e.Mismatches = append(e.Mismatches, fmt.Sprintf(
+				"Multus network-status does not report Linkerd CNI network (error: %v)", err))
+		}
+	}
+
+	if e.CurrentConfig != "" && e.RenderedConfig != "" && e.CurrentConfig != e.RenderedConfig {
+		e.Mismatches = append(e.Mismatches,
+			"NetworkAttachmentDefinition config differs from the config rendered from the AttachDefinition")
+	}
+}
+
+// ExplainHandler - HTTP handler which explains the webhook decision for a Pod
+// referenced by the "pod" query parameter in a form of namespace/name.
+type ExplainHandler struct {
+	Explainer *Explainer
+}
+
+func (h *ExplainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var parts = strings.SplitN(r.URL.Query().Get("pod"), "/", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "query parameter pod=<namespace>/<name> is required", http.StatusBadRequest)
+
+		return
+	}
+
+	explanation, err := h.Explainer.Explain(r.Context(), client.ObjectKey{Namespace: parts[0], Name: parts[1]})
+	if err != nil {
+		http.Error(w, err.Error(), int(errorToResponse(err).Result.Code))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(explanation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// explainedConfig - CNI configuration of the NetworkAttachmentDefinition of the explained Pods.
+const explainedConfig = `{"name": "linkerd-cni", "type": "linkerd-cni", "linkerd": {"proxy-uid": 2102}}`
+
+// explainedPod - a pending Pod of the app Namespace with the annotations.
+func explainedPod(annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web-0", Annotations: annotations},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "web"},
+			{Name: constants.LinkerdProxyContainerName},
+		}},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+}
+
+func TestExplain(t *testing.T) {
+	var (
+		injectEnabled = map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectEnabled}
+		attached      = map[string]string{
+			constants.LinkerdInjectAnnotation:       constants.LinkerdInjectEnabled,
+			constants.MultusNetworkAttachAnnotation: constants.LinkerdCNINetworkAttachmentDefinitionName,
+		}
+	)
+
+	var (
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+		ldAttach  = &cniv1alpha1.AttachDefinition{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+			Spec:       cniv1alpha1.AttachDefinitionSpec{CreateMultusNetworkAttachmentDefinition: true},
+		}
+		multusNetAttach = &netattachv1.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+			Spec:       netattachv1.NetworkAttachmentDefinitionSpec{Config: explainedConfig},
+		}
+	)
+
+	var tests = []struct {
+		name    string
+		objects []client.Object
+		// renderedConfig - if set, the configuration which the operator renders for the AttachDefinition.
+		renderedConfig string
+		wantAttached   bool
+		wantProxyUID   string
+		wantMismatches int
+	}{
+		{
+			name:         "attached Pod",
+			objects:      []client.Object{explainedPod(attached), namespace, ldAttach, multusNetAttach},
+			wantAttached: true,
+			wantProxyUID: "2102",
+		},
+		{
+			name:           "Pod missed the webhook",
+			objects:        []client.Object{explainedPod(injectEnabled), namespace, ldAttach, multusNetAttach},
+			wantAttached:   true,
+			wantProxyUID:   "2102",
+			wantMismatches: 1,
+		},
+		{
+			name: "Namespace requests injection",
+			objects: []client.Object{
+				explainedPod(nil),
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: injectEnabled}},
+				ldAttach,
+				multusNetAttach,
+			},
+			wantAttached:   true,
+			wantProxyUID:   "2102",
+			wantMismatches: 1,
+		},
+		{
+			name:    "injection is not requested",
+			objects: []client.Object{explainedPod(nil), namespace, ldAttach, multusNetAttach},
+		},
+		{
+			name:           "Linkerd CNI network is not requested anymore",
+			objects:        []client.Object{explainedPod(attached), namespace, ldAttach},
+			wantMismatches: 1,
+		},
+		{
+			name: "running Pod without Linkerd CNI network status",
+			objects: func() []client.Object {
+				var pod = explainedPod(attached)
+				pod.Status.Phase = corev1.PodRunning
+
+				return []client.Object{pod, namespace, ldAttach, multusNetAttach}
+			}(),
+			wantAttached:   true,
+			wantProxyUID:   "2102",
+			wantMismatches: 1,
+		},
+		{
+			name:           "configuration drift",
+			objects:        []client.Object{explainedPod(attached), namespace, ldAttach, multusNetAttach},
+			renderedConfig: `{"name": "linkerd-cni", "type": "linkerd-cni", "linkerd": {"proxy-uid": 2103}}`,
+			wantAttached:   true,
+			wantProxyUID:   "2102",
+			wantMismatches: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var explainer = &Explainer{Client: explainerClient(t, tt.objects...)}
+
+			if tt.renderedConfig != "" {
+				explainer.Render = func(_ context.Context, ldAttach *cniv1alpha1.AttachDefinition) (
+					*netattachv1.NetworkAttachmentDefinition, error) {
+					return &netattachv1.NetworkAttachmentDefinition{
+						ObjectMeta: metav1.ObjectMeta{Namespace: ldAttach.Namespace, Name: ldAttach.Name},
+						Spec:       netattachv1.NetworkAttachmentDefinitionSpec{Config: tt.renderedConfig},
+					}, nil
+				}
+			}
+
+			explanation, err := explainer.Explain(context.Background(), client.ObjectKey{Namespace: "app", Name: "web-0"})
+			if err != nil {
+				t.Fatalf("Explain() error = %v", err)
+			}
+
+			if explanation.Attached != tt.wantAttached {
+				t.Errorf("attached = %t, want %t, steps %+v", explanation.Attached, tt.wantAttached, explanation.Steps)
+			}
+
+			if got := explanation.ExpectedAnnotations[constants.LinkerdProxyUIDAnnotation]; got != tt.wantProxyUID {
+				t.Errorf("expected proxy UID = %q, want %q", got, tt.wantProxyUID)
+			}
+
+			if len(explanation.Mismatches) != tt.wantMismatches {
+				t.Errorf("mismatches = %q, want %d", explanation.Mismatches, tt.wantMismatches)
+			}
+
+			if last := explanation.Steps[len(explanation.Steps)-1]; last.Name != "decision" || last.Result != tt.wantAttached {
+				t.Errorf("the last step = %+v, want decision %t", last, tt.wantAttached)
+			}
+		})
+	}
+}
+
+func TestExplainMissingPod(t *testing.T) {
+	var explainer = &Explainer{Client: explainerClient(t)}
+
+	if _, err := explainer.Explain(context.Background(), client.ObjectKey{Namespace: "app", Name: "web-0"}); !apierrors.IsNotFound(err) {
+		t.Errorf("Explain() error = %v, want NotFound", err)
+	}
+}
+
+// explainerClient - a fake client with the objects.
+func explainerClient(t *testing.T, objects ...client.Object) client.Client {
+	t.Helper()
+
+	var scheme = runtime.NewScheme()
+
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, cniv1alpha1.AddToScheme, netattachv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
@@ -24,13 +24,18 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
 	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/metrics"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/policy"
 	"github.com/go-logr/logr"
 	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -42,19 +47,58 @@ import (
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;versions=v1
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;versions=v1
 
+// podPolicyFields - replaces AttachDefinitionPolicy violation fields of the cni-args with the Pod annotations.
+var podPolicyFields = strings.NewReplacer(
+	"spec.proxyConfig.inboundPort", constants.LinkerdInboundPortAnnotation,
+	"spec.proxyConfig.outboundPort", constants.LinkerdOutboundPortAnnotation,
+	"spec.proxyConfig.proxyUID", constants.LinkerdProxyUIDAnnotation,
+	"spec.proxyConfig.skipInboundPorts", constants.LinkerdSkipInboundPortsAnnotation,
+	"spec.proxyConfig.skipOutboundPorts", constants.LinkerdSkipOutboundPortsAnnotation,
+)
+
 const (
-	LinkerdCNIAnnotationEnabled = "enabled"
-	LinkerdCNIAnnotationIngress = "ingress"
+	LinkerdCNIAnnotationEnabled = constants.LinkerdInjectEnabled
+	LinkerdCNIAnnotationIngress = constants.LinkerdInjectIngress
+)
+
+// Reasons of Events recorded on the Pod's controller or Namespace when the webhook skips or fails.
+const (
+	EventReasonSkippedExcluded                    = "LinkerdCNISkippedExcluded"
+	EventReasonSkippedOptOut                      = "LinkerdCNISkippedOptOut"
+	EventReasonNetworkAttachmentDefinitionMissing = "NetworkAttachmentDefinitionMissing"
+	EventReasonAdmissionFailed                    = "LinkerdCNIAdmissionFailed"
+	EventReasonCNIArgsInvalid                     = "LinkerdCNIArgsInvalid"
+	EventReasonProxyConflict                      = "LinkerdProxyConflict"
 )
 
 type PodAnnotator struct {
-	Client  client.Client
-	decoder *admission.Decoder
+	Client client.Client
+	// Config - if set, Pods in Namespaces excluded by the operator configuration are not mutated.
+	Config *operatorconfig.Store
+	// InstanceName - Pods in Namespaces of other operator instances are not mutated.
+	InstanceName string
+	// Recorder - if set, skips and failures are recorded as Events on the Pod's controller
+	// or, if the Pod is not controlled, on its Namespace. Pods which do not request injection are not reported.
+	Recorder record.EventRecorder
+	decoder  *admission.Decoder
 }
 
-// Handle - main Multus annotator handler.
+// Handle - main Multus annotator handler, reports the decision and its latency in metrics.
 // nolint:gocritic // hugeParam - admission.Request is passed not as a pointer to conform to admission.Handler interface.
 func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var start = time.Now()
+
+	resp, outcome := a.handle(ctx, req)
+
+	metrics.WebhookDecisions.WithLabelValues(outcome).Inc()
+	metrics.WebhookDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+
+	return resp
+}
+
+// handle - annotates the Pod and returns the response and the outcome of the decision.
+// nolint:gocritic,funlen,gocyclo // hugeParam as in Handle; sequential steps of the decision chain.
+func (a *PodAnnotator) handle(ctx context.Context, req admission.Request) (admission.Response, string) {
 	logger := log.FromContext(ctx).WithValues("request_namespace", req.Namespace, "request_name", req.Name)
 
 	logger.Info("Received admission request", "request", req)
@@ -64,18 +108,51 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 	if err != nil {
 		logger.Error(err, "can not decode v1.Pod")
 
-		return admission.Errored(http.StatusBadRequest, err)
+		return admission.Errored(http.StatusBadRequest, err), metrics.OutcomeError
 	}
 
 	logger.Info("Loaded Pod info", "pod_generate_name", pod.GenerateName)
 
+	if a.Config != nil && a.Config.Get().IsNamespaceExcluded(req.Namespace) {
+		if controllers.IsLinkerdInjectRequested(pod.Annotations) {
+			a.recordEvent(req, pod, corev1.EventTypeNormal, EventReasonSkippedExcluded,
+				"Linkerd CNI network is not attached to Pod %s: Namespace is excluded by the operator configuration",
+				podName(req, pod))
+		}
+
+		return admission.Allowed("Namespace is excluded by the operator configuration"), metrics.OutcomeSkippedExcluded
+	}
+
+	if a.Config != nil && !a.Config.Get().IsNamespaceWatched(req.Namespace) {
+		return admission.Allowed("Namespace is not watched by the operator"), metrics.OutcomeSkippedExcluded
+	}
+
+	if owned, err := isNamespaceOwned(ctx, a.Client, req.Namespace, a.InstanceName); err != nil {
+		return errorToResponse(err), metrics.OutcomeError
+	} else if !owned {
+		return admission.Allowed("Namespace belongs to another operator instance"), metrics.OutcomeSkippedInstance
+	}
+
+	// The Pod opts out of injection requested by its Namespace, Linkerd does not inject the proxy.
+	if controllers.IsLinkerdInjectDisabled(pod.Annotations) {
+		logger.Info("Pod opts out of Linkerd proxy inject")
+		a.recordEvent(req, pod, corev1.EventTypeNormal, EventReasonSkippedOptOut,
+			"Linkerd CNI network is not attached to Pod %s: the Pod sets %s=%s",
+			podName(req, pod), constants.LinkerdInjectAnnotation, constants.LinkerdInjectDisabled)
+
+		return admission.Allowed("Pod opts out of Linkerd proxy inject"), metrics.OutcomeSkippedOptOut
+	}
+
 	var isMultusAnnotationRequested = isCNIRequestedByPod(logger, pod)
 
 	// Check Namespace.
 	if !isMultusAnnotationRequested {
 		isMultusAnnotationRequested, err = isCNIRequestedByNamespace(ctx, req.Namespace, logger, a.Client)
 		if err != nil {
-			return errorToResponse(err)
+			a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonAdmissionFailed,
+				"can not check if Namespace of Pod %s requests Linkerd proxy inject: %v", podName(req, pod), err)
+
+			return errorToResponse(err), metrics.OutcomeError
 		}
 	}
 
@@ -83,13 +160,79 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 		logger.Info(
 			"Multus NetworkAttachmentDefinition is not required as neither Pod nor Namespace requested Linkerd proxy inject")
 
-		return admission.Allowed("No Multus annotation requested")
+		return admission.Allowed("No Multus annotation requested"), metrics.OutcomeSkippedNotRequested
 	}
 
 	// Check if Multus NetworkAttachDefinition is in the Pod's namespace.
 	multus, err := getMultus(ctx, logger, a.Client, req.Namespace)
+	if apierrors.IsNotFound(err) {
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonNetworkAttachmentDefinitionMissing,
+			"Linkerd CNI network is not attached to Pod %s: %v", podName(req, pod), err)
+
+		return errorToResponse(err), metrics.OutcomeErrorNoNAD
+	}
+
 	if err != nil {
-		return errorToResponse(err)
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonAdmissionFailed,
+			"Linkerd CNI network is not attached to Pod %s: %v", podName(req, pod), err)
+
+		return errorToResponse(err), metrics.OutcomeError
+	}
+
+	// Per-Pod proxy configuration is taken before the webhook sets the proxy UID from the NetworkAttachmentDefinition.
+	cniArgs, err := controllers.PodCNIArgs(pod.Annotations)
+	if err != nil {
+		logger.Error(err, "Pod has invalid Linkerd proxy configuration annotations")
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonCNIArgsInvalid,
+			"Linkerd proxy configuration of Pod %s is partially not passed to Linkerd CNI: %v", podName(req, pod), err)
+	}
+
+	// The Pod's own proxy configuration must not bypass the AttachDefinitionPolicies of its Namespace.
+	if len(cniArgs) != 0 {
+		violations, err := policy.Check(ctx, a.Client, req.Namespace, controllers.CNIArgsSpec(cniArgs))
+		if err != nil {
+			logger.Error(err, "can not check AttachDefinitionPolicies")
+			a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonAdmissionFailed,
+				"can not check Linkerd proxy configuration of Pod %s against AttachDefinitionPolicies: %v",
+				podName(req, pod), err)
+
+			return errorToResponse(err), metrics.OutcomeError
+		}
+
+		if len(violations) != 0 {
+			for _, violation := range violations {
+				violation.Field = podPolicyFields.Replace(violation.Field)
+			}
+
+			var message = violations.ToAggregate().Error()
+
+			logger.Info("Pod's Linkerd proxy configuration violates AttachDefinitionPolicies, deny", "violations", message)
+			a.recordEvent(req, pod, corev1.EventTypeWarning, controllers.EventReasonPolicyViolation,
+				"Pod %s is denied as its Linkerd proxy configuration violates AttachDefinitionPolicies: %s",
+				podName(req, pod), message)
+
+			return admission.Denied("Linkerd proxy configuration violates AttachDefinitionPolicies: " + message),
+				metrics.OutcomeDeniedPolicy
+		}
+	}
+
+	// The Pod may request injection only via its Namespace and have no annotations.
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	var linkerdCNIConfig = &controllers.CNIPluginConf{}
+
+	if err = json.Unmarshal([]byte(multus.Spec.Config), linkerdCNIConfig); err != nil {
+		logger.Error(err, "can not Unmarshal Multus.Spec.Config to CNIPluginConf")
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonAdmissionFailed,
+			"Linkerd CNI network is not attached to Pod %s: NetworkAttachmentDefinition %s/%s config is invalid: %v",
+			podName(req, pod), multus.Namespace, multus.Name, err)
+
+		return admission.Errored(
+			http.StatusInternalServerError,
+			fmt.Errorf("can not Unmarshal Multus.Spec.Config to CNIPluginConf, multus=%s/%s, error=%w",
+				multus.Namespace, multus.Name, err)), metrics.OutcomeError
 	}
 
 	// Patch ProxyUID from the Multus definition if necessary.
@@ -97,24 +240,52 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 	// removed from this controller as the proxy inject will be able to
 	// set other options such as resource requests, limits, ports etc.
 	if _, ok := pod.Annotations[constants.LinkerdProxyUIDAnnotation]; !ok {
-		var linkerdCNIConfig = &controllers.CNIPluginConf{}
+		pod.Annotations[constants.LinkerdProxyUIDAnnotation] = strconv.Itoa(linkerdCNIConfig.Linkerd.ProxyUID)
+	}
 
-		if err = json.Unmarshal([]byte(multus.Spec.Config), linkerdCNIConfig); err != nil {
-			logger.Error(err, "can not Unmarshal Multus.Spec.Config to CNIPluginConf")
+	// The Pod's own proxy configuration overrides the NetworkAttachmentDefinition's one,
+	// the Pod's ports to ignore are added to the NetworkAttachmentDefinition's ones.
+	cniArgs = controllers.MergeCNIArgs(linkerdCNIConfig, cniArgs)
+
+	if err = controllers.ApplyCNIArgs(linkerdCNIConfig, cniArgs); err != nil {
+		logger.Error(err, "can not apply cni-args to CNIPluginConf")
+
+		return admission.Errored(http.StatusInternalServerError, err), metrics.OutcomeError
+	}
 
-			return admission.Errored(
-				http.StatusInternalServerError,
-				fmt.Errorf("can not Unmarshal Multus.Spec.Config to CNIPluginConf, multus=%s/%s, error=%w",
-					multus.Namespace, multus.Name, err))
+	var warnings []string
+
+	if conflicts := proxyConflicts(pod, &linkerdCNIConfig.Linkerd); len(conflicts) != 0 {
+		var message = strings.Join(conflicts, "; ")
+
+		if a.Config != nil && a.Config.Get().Webhook.ProxyConflicts == operatorconfig.ProxyConflictsDeny {
+			logger.Info("Pod conflicts with the Linkerd proxy, deny", "conflicts", message)
+			a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonProxyConflict,
+				"Pod %s is denied as it conflicts with the Linkerd proxy: %s", podName(req, pod), message)
+
+			return admission.Denied("Pod conflicts with the Linkerd proxy: " + message), metrics.OutcomeDeniedProxyConflict
 		}
 
-		pod.Annotations[constants.LinkerdProxyUIDAnnotation] = strconv.Itoa(linkerdCNIConfig.Linkerd.ProxyUID)
+		logger.Info("Pod conflicts with the Linkerd proxy", "conflicts", message)
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonProxyConflict,
+			"Pod %s conflicts with the Linkerd proxy: %s", podName(req, pod), message)
+
+		warnings = conflicts
 	}
 
 	// Patch NetworkAttachmentDefinitions list.
 	logger.Info("Pod network annotation is",
 		constants.MultusNetworkAttachAnnotation, pod.Annotations[constants.MultusNetworkAttachAnnotation])
-	pod = patchPodNetworks(logger, pod)
+	pod, err = patchPodNetworks(logger, pod, cniArgs)
+	if err != nil {
+		logger.Error(err, "can not parse Pod networks annotation")
+		a.recordEvent(req, pod, corev1.EventTypeWarning, EventReasonAdmissionFailed,
+			"Linkerd CNI network is not attached to Pod %s: annotation %s is invalid: %v",
+			podName(req, pod), constants.MultusNetworkAttachAnnotation, err)
+
+		return admission.Errored(http.StatusBadRequest, err), metrics.OutcomeError
+	}
+
 	logger.Info("Patched Pod annotation is",
 		constants.MultusNetworkAttachAnnotation, pod.Annotations[constants.MultusNetworkAttachAnnotation])
 
@@ -122,10 +293,36 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 	if err != nil {
 		logger.Error(err, "can not json.Marshal patched Pod definition")
 
-		return admission.Errored(http.StatusInternalServerError, err)
+		return admission.Errored(http.StatusInternalServerError, err), metrics.OutcomeError
 	}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod).WithWarnings(warnings...), metrics.OutcomeAttached
+}
+
+// recordEvent - records an Event on the Pod's controller or, if the Pod is not controlled, on its Namespace,
+// as the Pod does not exist yet when it is created.
+// nolint:gocritic // hugeParam - admission.Request as in Handle.
+func (a *PodAnnotator) recordEvent(req admission.Request, pod *corev1.Pod, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	var target = controllers.ControllerReference(pod)
+	if target == nil {
+		target = controllers.NamespaceReference(req.Namespace)
+	} else {
+		target.Namespace = req.Namespace
+	}
+
+	controllers.RecordEvent(a.Recorder, target, eventType, reason, messageFmt, args...)
+}
+
+// podName - returns the Pod's name or, if it is generated by the API server, its generateName prefix.
+// nolint:gocritic // hugeParam - admission.Request as in Handle.
+func podName(req admission.Request, pod *corev1.Pod) string {
+	var name = pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+
+	return req.Namespace + "/" + name
 }
 
 func (a *PodAnnotator) InjectDecoder(d *admission.Decoder) error {
@@ -135,9 +332,9 @@ func (a *PodAnnotator) InjectDecoder(d *admission.Decoder) error {
 
 // isCNIRequestedByPod - checks if a Pod contains linkerd inject annotation.
 func isCNIRequestedByPod(logger logr.Logger, pod *corev1.Pod) bool {
-	podAnnotation, ok := pod.Annotations[constants.LinkerdInjectAnnotation]
-	if ok && (podAnnotation == LinkerdCNIAnnotationEnabled || podAnnotation == LinkerdCNIAnnotationIngress) {
-		logger.Info("Pod contains inject annotation", constants.LinkerdInjectAnnotation, podAnnotation)
+	if controllers.IsLinkerdInjectRequested(pod.Annotations) {
+		logger.Info("Pod contains inject annotation",
+			constants.LinkerdInjectAnnotation, pod.Annotations[constants.LinkerdInjectAnnotation])
 
 		return true
 	}
@@ -148,22 +345,18 @@ func isCNIRequestedByPod(logger logr.Logger, pod *corev1.Pod) bool {
 // isCNIRequestedByNamespace - if a Namespace contains linkerd inject annotation.
 func isCNIRequestedByNamespace(ctx context.Context, namespaceName string, logger logr.Logger, apiClient client.Client) (bool, error) {
 	// Check Namespace.
-	var (
-		namespaceRef = client.ObjectKey{Name: namespaceName}
-		namespace    = &corev1.Namespace{}
-	)
-
-	logger.Info("Checking Namespace annotation", "namespaceRef", namespaceRef.Name)
+	logger.Info("Checking Namespace annotation", "namespaceRef", namespaceName)
 
-	if err := apiClient.Get(ctx, namespaceRef, namespace); err != nil {
-		logger.Error(err, "can not get namespace", "namespaceRef", namespaceRef.Name)
+	namespace, err := controllers.GetNamespace(ctx, apiClient, namespaceName)
+	if err != nil {
+		logger.Error(err, "can not get namespace", "namespaceRef", namespaceName)
 
 		return false, err
 	}
 
-	namespaceAnnot, ok := namespace.Annotations[constants.LinkerdInjectAnnotation]
-	if ok && (namespaceAnnot == "enabled" || namespaceAnnot == "ingress") {
-		logger.Info("Namespace contains inject annotation", constants.LinkerdInjectAnnotation, namespaceAnnot)
+	if controllers.IsLinkerdInjectRequested(namespace.Annotations) {
+		logger.Info("Namespace contains inject annotation",
+			constants.LinkerdInjectAnnotation, namespace.Annotations[constants.LinkerdInjectAnnotation])
 
 		return true, nil
 	}
@@ -171,6 +364,16 @@ func isCNIRequestedByNamespace(ctx context.Context, namespaceName string, logger
 	return false, nil
 }
 
+// isNamespaceOwned - checks if the Namespace belongs to the operator instance.
+func isNamespaceOwned(ctx context.Context, apiClient client.Client, namespaceName, instance string) (bool, error) {
+	namespace, err := controllers.GetNamespace(ctx, apiClient, namespaceName)
+	if err != nil {
+		return false, err
+	}
+
+	return controllers.IsInstance(controllers.NamespaceInstance(namespace), instance), nil
+}
+
 func errorToResponse(err error) admission.Response {
 	if status := apierrors.APIStatus(nil); errors.As(err, &status) {
 		return admission.Errored(status.Status().Code, err)
@@ -216,30 +419,80 @@ func getMultus(ctx context.Context, logger logr.Logger, apiClient client.Client,
 	return multus, nil
 }
 
-// patchPodNetworks - adds Linkerd CNI network to NetworkAttachmentDefinitions list of a Pod.
-func patchPodNetworks(logger logr.Logger, pod *corev1.Pod) *corev1.Pod {
+// patchPodNetworks - adds the Linkerd CNI network to the Pod's Multus networks annotation.
+// The comma separated form of the annotation is kept if there are no cni-args, otherwise
+// the annotation is converted to the JSON form which can carry cni-args of the Linkerd CNI network.
+func patchPodNetworks(logger logr.Logger, pod *corev1.Pod, cniArgs map[string]interface{}) (*corev1.Pod, error) {
 	currentNetworks, ok := pod.Annotations[constants.MultusNetworkAttachAnnotation]
 
 	logger.Info("Pod annotation is", constants.MultusNetworkAttachAnnotation, currentNetworks)
 
-	if ok {
-		// Check that there is no the Linkerd CNI annotation already.
-		nets := strings.Split(currentNetworks, ",")
+	if len(cniArgs) == 0 && !strings.HasPrefix(strings.TrimSpace(currentNetworks), "[") {
+		if ok {
+			// Check that there is no the Linkerd CNI annotation already.
+			nets := strings.Split(currentNetworks, ",")
+
+			var isAnnotationNeeded = true
+			for _, net := range nets {
+				if net == constants.LinkerdCNINetworkAttachmentDefinitionName {
+					isAnnotationNeeded = false
+					break
+				}
+			}
 
-		var isAnnotationNeeded = true
-		for _, net := range nets {
-			if net == constants.LinkerdCNINetworkAttachmentDefinitionName {
-				isAnnotationNeeded = false
-				break
+			if isAnnotationNeeded {
+				pod.Annotations[constants.MultusNetworkAttachAnnotation] =
+					currentNetworks + "," + constants.LinkerdCNINetworkAttachmentDefinitionName
 			}
+		} else {
+			pod.Annotations[constants.MultusNetworkAttachAnnotation] = constants.LinkerdCNINetworkAttachmentDefinitionName
 		}
 
-		if isAnnotationNeeded {
-			pod.Annotations[constants.MultusNetworkAttachAnnotation] = currentNetworks + "," + constants.LinkerdCNINetworkAttachmentDefinitionName
+		return pod, nil
+	}
+
+	networks, err := controllers.ParsePodNetworks(currentNetworks)
+	if err != nil {
+		return pod, err
+	}
+
+	var linkerdNetwork *netattachv1.NetworkSelectionElement
+
+	for _, network := range networks {
+		if network.Name == constants.LinkerdCNINetworkAttachmentDefinitionName {
+			linkerdNetwork = network
+
+			break
 		}
-	} else {
-		pod.Annotations[constants.MultusNetworkAttachAnnotation] = constants.LinkerdCNINetworkAttachmentDefinitionName
 	}
 
-	return pod
+	if linkerdNetwork == nil {
+		linkerdNetwork = &netattachv1.NetworkSelectionElement{Name: constants.LinkerdCNINetworkAttachmentDefinitionName}
+		networks = append(networks, linkerdNetwork)
+	}
+
+	if len(cniArgs) != 0 {
+		// Arguments set by the Pod's author in the annotation are kept unless they are overridden.
+		var args = map[string]interface{}{}
+		if linkerdNetwork.CNIArgs != nil {
+			for key, value := range *linkerdNetwork.CNIArgs {
+				args[key] = value
+			}
+		}
+
+		for key, value := range cniArgs {
+			args[key] = value
+		}
+
+		linkerdNetwork.CNIArgs = &args
+	}
+
+	raw, err := json.Marshal(networks)
+	if err != nil {
+		return pod, err
+	}
+
+	pod.Annotations[constants.MultusNetworkAttachAnnotation] = string(raw)
+
+	return pod, nil
 }
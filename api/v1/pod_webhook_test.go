@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+func TestPodAnnotatorPolicies(t *testing.T) {
+	var restricted = &cniv1alpha1.AttachDefinitionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec: cniv1alpha1.AttachDefinitionPolicySpec{
+			Forbidden:        []cniv1alpha1.PolicySetting{cniv1alpha1.PolicySettingInboundPort},
+			ProxyUIDs:        &cniv1alpha1.UIDRestriction{Allowed: []cniv1alpha1.UIDRange{{Min: 2102, Max: 2102}}},
+			SkipInboundPorts: &cniv1alpha1.PortRestriction{Allowed: []cniv1alpha1.Ports{{Range: "8000-8100"}}},
+		},
+	}
+
+	var tests = []struct {
+		name        string
+		annotations map[string]string
+		wantAllowed bool
+		// wantDenied - annotations which the denial reports.
+		wantDenied []string
+	}{
+		{
+			name:        "no per-Pod configuration",
+			wantAllowed: true,
+		},
+		{
+			name: "allowed per-Pod configuration",
+			annotations: map[string]string{
+				constants.LinkerdProxyUIDAnnotation:         "2102",
+				constants.LinkerdSkipInboundPortsAnnotation: "8080,8000-8010",
+			},
+			wantAllowed: true,
+		},
+		{
+			name:        "proxy UID outside the allowed ranges",
+			annotations: map[string]string{constants.LinkerdProxyUIDAnnotation: "0"},
+			wantDenied:  []string{constants.LinkerdProxyUIDAnnotation},
+		},
+		{
+			name: "skipped ports outside the allowed ones and a forbidden port",
+			annotations: map[string]string{
+				constants.LinkerdInboundPortAnnotation:      "5143",
+				constants.LinkerdSkipInboundPortsAnnotation: "8080,22",
+			},
+			wantDenied: []string{
+				constants.LinkerdInboundPortAnnotation,
+				constants.LinkerdSkipInboundPortsAnnotation + "[1]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp = handleTestPod(t, operatorconfig.ProxyConflictsWarn, newTestPod(tt.annotations), restricted)
+
+			if resp.Allowed != tt.wantAllowed {
+				t.Fatalf("allowed = %t, want %t, result %+v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+
+			if tt.wantAllowed {
+				return
+			}
+
+			if resp.Result.Code != http.StatusForbidden {
+				t.Errorf("code = %d, want %d", resp.Result.Code, http.StatusForbidden)
+			}
+
+			for _, annotation := range tt.wantDenied {
+				if !strings.Contains(string(resp.Result.Reason), annotation+":") {
+					t.Errorf("reason %q does not report %s", resp.Result.Reason, annotation)
+				}
+			}
+		})
+	}
+}
+
+func TestPodAnnotatorPolicyOfAnotherNamespace(t *testing.T) {
+	var tenantPolicy = &cniv1alpha1.AttachDefinitionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec: cniv1alpha1.AttachDefinitionPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "restricted"}},
+			ProxyUIDs:         &cniv1alpha1.UIDRestriction{Allowed: []cniv1alpha1.UIDRange{{Min: 2102, Max: 2102}}},
+		},
+	}
+
+	var pod = newTestPod(map[string]string{constants.LinkerdProxyUIDAnnotation: "0"})
+
+	if resp := handleTestPod(t, operatorconfig.ProxyConflictsWarn, pod, tenantPolicy); !resp.Allowed {
+		t.Errorf("allowed = false, want true, result %+v", resp.Result)
+	}
+}
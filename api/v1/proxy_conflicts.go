@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// proxyConflicts - returns descriptions of the Pod's settings which conflict with the proxy configuration
+// the Pod gets from Linkerd CNI:
+//   - a container runs as the proxy UID, so iptables does not redirect its outbound traffic to the proxy;
+//   - a container declares the proxy inbound or outbound port;
+//   - a container declares a port which is skipped by the inbound redirection, so its traffic is not meshed.
+//
+// Init containers are checked as well, as sidecar init containers run next to the proxy. Ports which the Pod
+// skips itself with its skip-inbound-ports annotation are intended and are not reported. The UID check is
+// skipped if the proxy UID is not set.
+func proxyConflicts(pod *corev1.Pod, proxyInit *controllers.ProxyInit) []string {
+	var conflicts []string
+
+	var podRunAsUser *int64
+	if pod.Spec.SecurityContext != nil {
+		podRunAsUser = pod.Spec.SecurityContext.RunAsUser
+	}
+
+	var podSkippedPorts = strings.Split(pod.Annotations[constants.LinkerdSkipInboundPortsAnnotation], ",")
+
+	var containers = append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+
+	for i := range containers {
+		var container = &containers[i]
+
+		if container.Name == constants.LinkerdProxyContainerName {
+			continue
+		}
+
+		var runAsUser = podRunAsUser
+		if container.SecurityContext != nil && container.SecurityContext.RunAsUser != nil {
+			runAsUser = container.SecurityContext.RunAsUser
+		}
+
+		if proxyInit.ProxyUID != 0 && runAsUser != nil && *runAsUser == int64(proxyInit.ProxyUID) {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"container %s runs as the proxy UID %d, its outbound traffic bypasses the proxy",
+				container.Name, proxyInit.ProxyUID))
+		}
+
+		for _, port := range container.Ports {
+			var number = int(port.ContainerPort)
+
+			switch {
+			case number == proxyInit.IncomingProxyPort || number == proxyInit.OutgoingProxyPort:
+				conflicts = append(conflicts, fmt.Sprintf("container %s declares port %d which is used by the proxy",
+					container.Name, number))
+			case isPortListed(number, proxyInit.InboundPortsToIgnore) && !isPortListed(number, podSkippedPorts):
+				conflicts = append(conflicts, fmt.Sprintf(
+					"container %s declares port %d which is skipped by the proxy, its inbound traffic is not meshed",
+					container.Name, number))
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// isPortListed - checks if the port is in the list of ports and port ranges, invalid items are ignored.
+func isPortListed(port int, list []string) bool {
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+
+		if strings.Contains(item, "-") {
+			if first, last, err := operatorconfig.ParsePortRange(item); err == nil && port >= first && port <= last {
+				return true
+			}
+
+			continue
+		}
+
+		if number, err := strconv.Atoi(item); err == nil && number == port {
+			return true
+		}
+	}
+
+	return false
+}
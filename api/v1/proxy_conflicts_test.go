@@ -0,0 +1,280 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// testProxyInit - a NetworkAttachmentDefinition's proxy configuration.
+var testProxyInit = controllers.ProxyInit{
+	IncomingProxyPort:    4143,
+	OutgoingProxyPort:    4140,
+	ProxyUID:             2102,
+	InboundPortsToIgnore: []string{"4190", "4191", "9000-9010"},
+}
+
+// newTestPod - a Pod with an application container declaring the ports.
+func newTestPod(annotations map[string]string, ports ...int32) *corev1.Pod {
+	var pod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: annotations},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: constants.LinkerdProxyContainerName, Ports: []corev1.ContainerPort{{ContainerPort: 4143}}},
+			},
+		},
+	}
+
+	for _, port := range ports {
+		pod.Spec.Containers[0].Ports = append(pod.Spec.Containers[0].Ports, corev1.ContainerPort{ContainerPort: port})
+	}
+
+	return pod
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestProxyConflicts(t *testing.T) {
+	var tests = []struct {
+		name      string
+		pod       *corev1.Pod
+		proxyInit controllers.ProxyInit
+		want      []string
+	}{
+		{
+			name:      "no conflicts",
+			pod:       newTestPod(nil, 8080),
+			proxyInit: testProxyInit,
+		},
+		{
+			name:      "proxy and skipped ports",
+			pod:       newTestPod(nil, 4140, 4190, 9005),
+			proxyInit: testProxyInit,
+			want: []string{
+				"container app declares port 4140 which is used by the proxy",
+				"container app declares port 4190 which is skipped by the proxy, its inbound traffic is not meshed",
+				"container app declares port 9005 which is skipped by the proxy, its inbound traffic is not meshed",
+			},
+		},
+		{
+			name: "ports skipped by the pod itself",
+			pod: newTestPod(map[string]string{constants.LinkerdSkipInboundPortsAnnotation: "4190, 9000-9010"},
+				4190, 4191, 9005),
+			proxyInit: testProxyInit,
+			want: []string{
+				"container app declares port 4191 which is skipped by the proxy, its inbound traffic is not meshed",
+			},
+		},
+		{
+			name: "pod runs as the proxy UID",
+			pod: func() *corev1.Pod {
+				var pod = newTestPod(nil)
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: int64Ptr(2102)}
+
+				return pod
+			}(),
+			proxyInit: testProxyInit,
+			want:      []string{"container app runs as the proxy UID 2102, its outbound traffic bypasses the proxy"},
+		},
+		{
+			name: "container overrides the pod's UID",
+			pod: func() *corev1.Pod {
+				var pod = newTestPod(nil)
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: int64Ptr(2102)}
+				pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{RunAsUser: int64Ptr(1000)}
+
+				return pod
+			}(),
+			proxyInit: testProxyInit,
+		},
+		{
+			name: "unset proxy UID",
+			pod: func() *corev1.Pod {
+				var pod = newTestPod(nil)
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: int64Ptr(0)}
+
+				return pod
+			}(),
+			proxyInit: func() controllers.ProxyInit {
+				var proxyInit = testProxyInit
+				proxyInit.ProxyUID = 0
+
+				return proxyInit
+			}(),
+		},
+		{
+			name: "init containers",
+			pod: func() *corev1.Pod {
+				var pod = newTestPod(nil)
+				pod.Spec.InitContainers = []corev1.Container{{
+					Name:            "sidecar",
+					Ports:           []corev1.ContainerPort{{ContainerPort: 4143}},
+					SecurityContext: &corev1.SecurityContext{RunAsUser: int64Ptr(2102)},
+				}}
+
+				return pod
+			}(),
+			proxyInit: testProxyInit,
+			want: []string{
+				"container sidecar runs as the proxy UID 2102, its outbound traffic bypasses the proxy",
+				"container sidecar declares port 4143 which is used by the proxy",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proxyInit = tt.proxyInit
+
+			if got := proxyConflicts(tt.pod, &proxyInit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("proxyConflicts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodAnnotatorProxyConflicts(t *testing.T) {
+	var tests = []struct {
+		name           string
+		proxyConflicts string
+		pod            *corev1.Pod
+		wantAllowed    bool
+		wantCode       int32
+		wantWarnings   int
+	}{
+		{
+			name:           "warn",
+			proxyConflicts: operatorconfig.ProxyConflictsWarn,
+			pod:            newTestPod(nil, 4190),
+			wantAllowed:    true,
+			wantCode:       http.StatusOK,
+			wantWarnings:   1,
+		},
+		{
+			name:           "deny",
+			proxyConflicts: operatorconfig.ProxyConflictsDeny,
+			pod:            newTestPod(nil, 4190),
+			wantCode:       http.StatusForbidden,
+		},
+		{
+			name:           "deny admits ports skipped by the pod",
+			proxyConflicts: operatorconfig.ProxyConflictsDeny,
+			pod:            newTestPod(map[string]string{constants.LinkerdSkipInboundPortsAnnotation: "4190"}, 4190),
+			wantAllowed:    true,
+			wantCode:       http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp = handleTestPod(t, tt.proxyConflicts, tt.pod)
+
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %t, want %t, result %+v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+
+			if resp.Result != nil && resp.Result.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", resp.Result.Code, tt.wantCode)
+			}
+
+			if len(resp.Warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+// handleTestPod - admits the Pod in a Namespace which requests Linkerd proxy injection
+// and has the Linkerd CNI NetworkAttachmentDefinition with testProxyInit and the objects.
+func handleTestPod(t *testing.T, proxyConflicts string, pod *corev1.Pod, objects ...client.Object) admission.Response {
+	t.Helper()
+
+	var scheme = runtime.NewScheme()
+
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, cniv1alpha1.AddToScheme, netattachv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rawConfig, err := json.Marshal(&controllers.CNIPluginConf{Linkerd: testProxyInit})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        pod.Namespace,
+		Annotations: map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectEnabled},
+	}}
+
+	var multus = &netattachv1.NetworkAttachmentDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.LinkerdCNINetworkAttachmentDefinitionName, Namespace: pod.Namespace},
+		Spec:       netattachv1.NetworkAttachmentDefinitionSpec{Config: string(rawConfig)},
+	}
+
+	var cfg = operatorconfig.Default()
+	cfg.Webhook.ProxyConflicts = proxyConflicts
+
+	var annotator = &PodAnnotator{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objects, namespace, multus)...).Build(),
+		Config: operatorconfig.NewStore(cfg, "", nil),
+	}
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = annotator.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	rawPod, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return annotator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Namespace: pod.Namespace,
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: rawPod},
+	}})
+}
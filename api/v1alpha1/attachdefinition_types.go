@@ -78,6 +78,10 @@ type ProxyConfig struct {
 	SkipInboundPorts []Ports `json:"skipInboundPorts,omitempty" yaml:"skipInboundPorts,omitempty"`
 	// config.linkerd.io/skip-outbound-ports.
 	SkipOutboundPorts []Ports `json:"skipOutboundPorts,omitempty" yaml:"skipOutboundPorts,omitempty"`
+	// SkipOutboundServices - Services whose ClusterIP and endpoint addresses are skipped
+	// by the outbound redirection. The operator resolves them and re-renders the NetworkAttachmentDefinition
+	// when the Services or their endpoints change.
+	SkipOutboundServices []ServiceReference `json:"skipOutboundServices,omitempty" yaml:"skipOutboundServices,omitempty"`
 
 	// // config.alpha.linkerd.io/proxy-wait-before-exit-seconds.
 	// WaitBeforeExitSec uint32 `json:"waitBeforeExitSec,omitempty" yaml:"waitBeforeExitSec,omitempty"`
@@ -119,6 +123,87 @@ type ProxyConfig struct {
 	ProxyUID *uint32 `json:"proxyUID,omitempty" yaml:"proxyUID,omitempty"`
 }
 
+// ServiceReference - reference to a Service whose traffic bypasses the proxy.
+type ServiceReference struct {
+	// +kubebuilder:validation:Required
+
+	// Name of the Service.
+	Name string `json:"name" yaml:"name"`
+
+	// Namespace of the Service, the AttachDefinition's Namespace if not set.
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// PortName - if set, the Service must have the named port and only the endpoint addresses
+	// which serve it are skipped. The traffic to the addresses is skipped on every port.
+	PortName string `json:"portName,omitempty" yaml:"portName,omitempty"`
+}
+
+// MissedPodPolicy defines what the operator does with meshed Pods
+// which were created without Linkerd CNI network.
+// +kubebuilder:validation:Enum=Report;Evict
+type MissedPodPolicy string
+
+const (
+	// MissedPodPolicyReport - only report a Pod via an Event and metrics.
+	MissedPodPolicyReport MissedPodPolicy = "Report"
+	// MissedPodPolicyEvict - report and evict a Pod, so its controller recreates it
+	// through the mutating webhook. The eviction respects PodDisruptionBudgets.
+	MissedPodPolicyEvict MissedPodPolicy = "Evict"
+)
+
+// CNIConfigMapReference - reference to a Linkerd CNI ConfigMap.
+type CNIConfigMapReference struct {
+	// +kubebuilder:validation:Required
+
+	// Namespace of the ConfigMap.
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// +kubebuilder:validation:Required
+
+	// Name of the ConfigMap.
+	Name string `json:"name" yaml:"name"`
+
+	// Key of the ConfigMap which contains Linkerd CNI configuration.
+	// If empty, the operator's configured key is used.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// CNISource - base Linkerd CNI configuration of a Namespace, for example, of a second
+// Linkerd installation or a canary linkerd-cni version.
+// The source must be allowed by the operator configuration.
+type CNISource struct {
+	// ConfigMap - Linkerd CNI ConfigMap, if not set, the operator's configured ConfigMap is used.
+	ConfigMap *CNIConfigMapReference `json:"configMap,omitempty" yaml:"configMap,omitempty"`
+
+	// Kubeconfig - path to the Linkerd CNI kubeconfig on nodes,
+	// if not set, the operator's configured path is used.
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+}
+
+const (
+	// ConditionCNISourceAllowed - the AttachDefinition's CNI source is allowed by the operator configuration.
+	ConditionCNISourceAllowed = "CNISourceAllowed"
+	// ConditionDefaultsConsistent - Linkerd CNI ConfigMap and the Linkerd control plane linkerd-config
+	// agree on proxy UID and ports. Reported only if the operator uses linkerd-config.
+	ConditionDefaultsConsistent = "DefaultsConsistent"
+	// ConditionPolicyCompliant - the AttachDefinition complies with all AttachDefinitionPolicies
+	// which select its Namespace. A non-compliant AttachDefinition is not rendered and a non-compliant
+	// spec.rollbackTo revision is not applied.
+	ConditionPolicyCompliant = "PolicyCompliant"
+	// ConditionServicesResolved - all Services of proxyConfig.skipOutboundServices are resolved.
+	// Unresolved Services are not skipped. Reported only if the AttachDefinition references Services.
+	ConditionServicesResolved = "ServicesResolved"
+	// ConditionDegraded - the AttachDefinition's Linkerd CNI source is invalid and the NetworkAttachmentDefinition
+	// is rendered from the last known good configuration of the source, if any.
+	ConditionDegraded = "Degraded"
+	// ConditionRolledBack - the NetworkAttachmentDefinition is pinned to the revision of spec.rollbackTo.
+	// Reported only if spec.rollbackTo is set.
+	ConditionRolledBack = "RolledBack"
+)
+
+// DefaultRevisionHistoryLimit - number of rendered revisions kept if spec.revisionHistoryLimit is not set.
+const DefaultRevisionHistoryLimit = 10
+
 // AttachDefinitionSpec defines the desired state of AttachDefinition
 type AttachDefinitionSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -136,12 +221,80 @@ type AttachDefinitionSpec struct {
 	// Further below in comments are the annotations which will be added to a Pod.
 	// https://linkerd.io/2.11/reference/proxy-configuration/ .
 	Config ProxyConfig `json:"proxyConfig,omitempty" yaml:"proxyConfig,omitempty"`
+
+	// +kubebuilder:default=Report
+
+	// MissedPodPolicy defines what to do with Pods which requested Linkerd proxy injection
+	// but were created without Linkerd CNI network, for example, while the operator's webhook was down.
+	MissedPodPolicy MissedPodPolicy `json:"missedPodPolicy,omitempty" yaml:"missedPodPolicy,omitempty"`
+
+	// CNISource overrides the operator's Linkerd CNI ConfigMap and kubeconfig path for the Namespace.
+	CNISource *CNISource `json:"cniSource,omitempty" yaml:"cniSource,omitempty"`
+
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+
+	// RevisionHistoryLimit - number of rendered CNI configurations kept in status.history.
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty" yaml:"revisionHistoryLimit,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+
+	// RollbackTo pins the NetworkAttachmentDefinition to the CNI configuration of a revision from status.history
+	// instead of rendering the current one, if the revision complies with AttachDefinitionPolicies.
+	// Remove the field to render the current configuration again.
+	RollbackTo *int64 `json:"rollbackTo,omitempty" yaml:"rollbackTo,omitempty"`
+}
+
+// RenderedRevision - a CNI configuration which the operator rendered for the AttachDefinition's
+// NetworkAttachmentDefinition.
+type RenderedRevision struct {
+	// Revision - the revision number, it grows with every new configuration.
+	Revision int64 `json:"revision" yaml:"revision"`
+
+	// Config - the CNI configuration of the NetworkAttachmentDefinition.
+	Config string `json:"config" yaml:"config"`
+
+	// Trigger - what caused the new configuration, for example, a new AttachDefinition generation
+	// and the manager which changed it or a new Linkerd CNI ConfigMap resourceVersion.
+	Trigger string `json:"trigger,omitempty" yaml:"trigger,omitempty"`
+
+	// AttachDefinitionGeneration and CNIConfigMapResourceVersion - provenance of the configuration.
+	AttachDefinitionGeneration  int64  `json:"attachDefinitionGeneration,omitempty" yaml:"attachDefinitionGeneration,omitempty"`
+	CNIConfigMapResourceVersion string `json:"cniConfigMapResourceVersion,omitempty" yaml:"cniConfigMapResourceVersion,omitempty"`
+
+	// Time - when the configuration was applied to the NetworkAttachmentDefinition.
+	Time metav1.Time `json:"time" yaml:"time"`
 }
 
 // AttachDefinitionStatus defines the observed state of AttachDefinition
 type AttachDefinitionStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// MeshedPods - number of running Pods in the Namespace which requested Linkerd CNI network.
+	MeshedPods int32 `json:"meshedPods,omitempty" yaml:"meshedPods,omitempty"`
+
+	// PodsWithoutCNI - number of meshed Pods whose k8s.v1.cni.cncf.io/network-status
+	// annotation lacks the Linkerd CNI network or can not be parsed.
+	PodsWithoutCNI int32 `json:"podsWithoutCNI,omitempty" yaml:"podsWithoutCNI,omitempty"`
+
+	// PodsMissedMutation - number of Pods with Linkerd proxy which requested injection,
+	// but were not mutated by the webhook to use Linkerd CNI network.
+	PodsMissedMutation int32 `json:"podsMissedMutation,omitempty" yaml:"podsMissedMutation,omitempty"`
+
+	// Conditions - the latest observations of the AttachDefinition's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+
+	// CurrentRevision - the revision of the NetworkAttachmentDefinition's current CNI configuration.
+	CurrentRevision int64 `json:"currentRevision,omitempty" yaml:"currentRevision,omitempty"`
+
+	// History - the last rendered CNI configurations, the oldest first.
+	// +optional
+	History []RenderedRevision `json:"history,omitempty" yaml:"history,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,111 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PolicySetting - an AttachDefinition setting which a policy may forbid.
+// +kubebuilder:validation:Enum=cniSource;proxyConfig.inboundPort;proxyConfig.outboundPort;proxyConfig.logLevel;proxyConfig.proxyUID;proxyConfig.skipInboundPorts;proxyConfig.skipOutboundPorts;proxyConfig.skipOutboundServices;missedPodPolicy
+type PolicySetting string
+
+const (
+	PolicySettingCNISource         PolicySetting = "cniSource"
+	PolicySettingInboundPort       PolicySetting = "proxyConfig.inboundPort"
+	PolicySettingOutboundPort      PolicySetting = "proxyConfig.outboundPort"
+	PolicySettingLogLevel          PolicySetting = "proxyConfig.logLevel"
+	PolicySettingProxyUID          PolicySetting = "proxyConfig.proxyUID"
+	PolicySettingSkipInboundPorts  PolicySetting = "proxyConfig.skipInboundPorts"
+	PolicySettingSkipOutboundPorts PolicySetting = "proxyConfig.skipOutboundPorts"
+	// PolicySettingSkipOutboundServices - forbids Service references, the whole traffic
+	// to their addresses bypasses the proxy.
+	PolicySettingSkipOutboundServices PolicySetting = "proxyConfig.skipOutboundServices"
+	// PolicySettingMissedPodPolicy - forbids missedPodPolicy other than Report.
+	PolicySettingMissedPodPolicy PolicySetting = "missedPodPolicy"
+)
+
+// PortRestriction - ports which AttachDefinitions may skip.
+type PortRestriction struct {
+	// Allowed - ports and port ranges which may be skipped, every skipped port or range
+	// must be within one of them. Empty list forbids skipping ports.
+	Allowed []Ports `json:"allowed,omitempty" yaml:"allowed,omitempty"`
+}
+
+// UIDRange - an inclusive range of user IDs.
+type UIDRange struct {
+	// +kubebuilder:validation:Required
+
+	// Min - the first user ID of the range.
+	Min uint32 `json:"min" yaml:"min"`
+
+	// +kubebuilder:validation:Required
+
+	// Max - the last user ID of the range.
+	Max uint32 `json:"max" yaml:"max"`
+}
+
+// UIDRestriction - proxy user IDs which AttachDefinitions may set.
+type UIDRestriction struct {
+	// Allowed - allowed user ID ranges. Empty list forbids setting the proxy UID.
+	Allowed []UIDRange `json:"allowed,omitempty" yaml:"allowed,omitempty"`
+}
+
+// AttachDefinitionPolicySpec defines constraints of AttachDefinitions in the selected Namespaces.
+type AttachDefinitionPolicySpec struct {
+	// NamespaceSelector - Namespaces whose AttachDefinitions are constrained by the policy,
+	// all Namespaces if not set.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+
+	// SkipInboundPorts - if set, restricts proxyConfig.skipInboundPorts.
+	SkipInboundPorts *PortRestriction `json:"skipInboundPorts,omitempty" yaml:"skipInboundPorts,omitempty"`
+
+	// SkipOutboundPorts - if set, restricts proxyConfig.skipOutboundPorts.
+	SkipOutboundPorts *PortRestriction `json:"skipOutboundPorts,omitempty" yaml:"skipOutboundPorts,omitempty"`
+
+	// ProxyUIDs - if set, restricts proxyConfig.proxyUID.
+	ProxyUIDs *UIDRestriction `json:"proxyUIDs,omitempty" yaml:"proxyUIDs,omitempty"`
+
+	// Forbidden - settings which AttachDefinitions must not set.
+	Forbidden []PolicySetting `json:"forbidden,omitempty" yaml:"forbidden,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// AttachDefinitionPolicy restricts what AttachDefinitions may set in the selected Namespaces.
+// An AttachDefinition must comply with all policies which select its Namespace.
+type AttachDefinitionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AttachDefinitionPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AttachDefinitionPolicyList contains a list of AttachDefinitionPolicy
+type AttachDefinitionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AttachDefinitionPolicy `json:"items"`
+}
+
+// nolint:gochecknoinits // this init is generated by operator SDK so it should be okay to have it.
+func init() {
+	SchemeBuilder.Register(&AttachDefinitionPolicy{}, &AttachDefinitionPolicyList{})
+}
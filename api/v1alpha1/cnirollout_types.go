@@ -0,0 +1,139 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=Completed;Progressing;Paused
+
+// RolloutPhase - state of a CNIRollout.
+type RolloutPhase string
+
+const (
+	// RolloutPhaseCompleted - all Namespaces use the stable configuration.
+	RolloutPhaseCompleted RolloutPhase = "Completed"
+	// RolloutPhaseProgressing - the target configuration is applied to the Namespaces in waves.
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhasePaused - the rollout waits for CNI attachment failures to clear or for spec.paused to be unset.
+	RolloutPhasePaused RolloutPhase = "Paused"
+)
+
+const (
+	// ConditionRolloutHealthy - Pods in the updated Namespaces have no CNI attachment failures.
+	ConditionRolloutHealthy = "Healthy"
+)
+
+// CNIRolloutSpec defines how a new Linkerd CNI base configuration is applied to Namespaces.
+type CNIRolloutSpec struct {
+	// CanaryNamespaceSelector - if set, the selected Namespaces get the new configuration in the first wave.
+	CanaryNamespaceSelector *metav1.LabelSelector `json:"canaryNamespaceSelector,omitempty" yaml:"canaryNamespaceSelector,omitempty"`
+
+	// +kubebuilder:default={25,50,100}
+	// +kubebuilder:validation:MinItems=1
+
+	// Steps - cumulative percentages of the Namespaces which get the new configuration in the waves
+	// after the canary wave. The last step is always treated as 100.
+	Steps []RolloutStep `json:"steps,omitempty" yaml:"steps,omitempty"`
+
+	// +kubebuilder:default="5m"
+
+	// Interval - how long a wave runs without CNI attachment failures before the next wave starts.
+	Interval metav1.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+
+	// MaxPodsWithoutCNI - number of meshed Pods without Linkerd CNI network in the updated Namespaces,
+	// as reported by the AttachDefinitions' status.podsWithoutCNI, above which the rollout pauses.
+	MaxPodsWithoutCNI int32 `json:"maxPodsWithoutCNI,omitempty" yaml:"maxPodsWithoutCNI,omitempty"`
+
+	// Paused - stops the rollout at the current wave.
+	Paused bool `json:"paused,omitempty" yaml:"paused,omitempty"`
+}
+
+// +kubebuilder:validation:Minimum=1
+// +kubebuilder:validation:Maximum=100
+
+// RolloutStep - a cumulative percentage of Namespaces.
+type RolloutStep int32
+
+// CNIRolloutStatus defines the observed progress of a CNIRollout.
+type CNIRolloutStatus struct {
+	// Phase - Completed, Progressing or Paused.
+	Phase RolloutPhase `json:"phase,omitempty" yaml:"phase,omitempty"`
+
+	// StableConfig and StableResourceVersion - the Linkerd CNI configuration which Namespaces
+	// not updated yet keep using.
+	StableConfig          string `json:"stableConfig,omitempty" yaml:"stableConfig,omitempty"`
+	StableResourceVersion string `json:"stableResourceVersion,omitempty" yaml:"stableResourceVersion,omitempty"`
+
+	// TargetConfig and TargetResourceVersion - the Linkerd CNI configuration which is rolled out.
+	TargetConfig          string `json:"targetConfig,omitempty" yaml:"targetConfig,omitempty"`
+	TargetResourceVersion string `json:"targetResourceVersion,omitempty" yaml:"targetResourceVersion,omitempty"`
+
+	// CurrentWave - the current wave numbered from 0, the canary wave is the first one
+	// if canaryNamespaceSelector is set.
+	CurrentWave int32 `json:"currentWave,omitempty" yaml:"currentWave,omitempty"`
+
+	// WaveStartTime - when the current wave started.
+	WaveStartTime *metav1.Time `json:"waveStartTime,omitempty" yaml:"waveStartTime,omitempty"`
+
+	// UpdatedNamespaces - Namespaces which use the target configuration.
+	UpdatedNamespaces []string `json:"updatedNamespaces,omitempty" yaml:"updatedNamespaces,omitempty"`
+
+	// TotalNamespaces - number of Namespaces with AttachDefinitions which use the operator's Linkerd CNI ConfigMap.
+	TotalNamespaces int32 `json:"totalNamespaces,omitempty" yaml:"totalNamespaces,omitempty"`
+
+	// Conditions - the latest observations of the rollout.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Wave",type=integer,JSONPath=`.status.currentWave`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.totalNamespaces`
+
+// CNIRollout applies changes of the operator's Linkerd CNI ConfigMap to Namespaces in waves
+// and pauses when Pods in the updated Namespaces fail to get Linkerd CNI network.
+// The operator instance of the CNIRollout's cni.linkerd.io/instance label uses it, an instance uses one CNIRollout.
+type CNIRollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CNIRolloutSpec   `json:"spec,omitempty"`
+	Status CNIRolloutStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CNIRolloutList contains a list of CNIRollout
+type CNIRolloutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CNIRollout `json:"items"`
+}
+
+// nolint:gochecknoinits // this init is generated by operator SDK so it should be okay to have it.
+func init() {
+	SchemeBuilder.Register(&CNIRollout{}, &CNIRolloutList{})
+}
@@ -22,6 +22,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -31,7 +32,7 @@ func (in *AttachDefinition) DeepCopyInto(out *AttachDefinition) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinition.
@@ -84,10 +85,123 @@ func (in *AttachDefinitionList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AttachDefinitionPolicy) DeepCopyInto(out *AttachDefinitionPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinitionPolicy.
+func (in *AttachDefinitionPolicy) DeepCopy() *AttachDefinitionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AttachDefinitionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AttachDefinitionPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AttachDefinitionPolicyList) DeepCopyInto(out *AttachDefinitionPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AttachDefinitionPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinitionPolicyList.
+func (in *AttachDefinitionPolicyList) DeepCopy() *AttachDefinitionPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(AttachDefinitionPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AttachDefinitionPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AttachDefinitionPolicySpec) DeepCopyInto(out *AttachDefinitionPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SkipInboundPorts != nil {
+		in, out := &in.SkipInboundPorts, &out.SkipInboundPorts
+		*out = new(PortRestriction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SkipOutboundPorts != nil {
+		in, out := &in.SkipOutboundPorts, &out.SkipOutboundPorts
+		*out = new(PortRestriction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProxyUIDs != nil {
+		in, out := &in.ProxyUIDs, &out.ProxyUIDs
+		*out = new(UIDRestriction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Forbidden != nil {
+		in, out := &in.Forbidden, &out.Forbidden
+		*out = make([]PolicySetting, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinitionPolicySpec.
+func (in *AttachDefinitionPolicySpec) DeepCopy() *AttachDefinitionPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AttachDefinitionPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AttachDefinitionSpec) DeepCopyInto(out *AttachDefinitionSpec) {
 	*out = *in
 	in.Config.DeepCopyInto(&out.Config)
+	if in.CNISource != nil {
+		in, out := &in.CNISource, &out.CNISource
+		*out = new(CNISource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RollbackTo != nil {
+		in, out := &in.RollbackTo, &out.RollbackTo
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinitionSpec.
@@ -103,6 +217,20 @@ func (in *AttachDefinitionSpec) DeepCopy() *AttachDefinitionSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AttachDefinitionStatus) DeepCopyInto(out *AttachDefinitionStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]RenderedRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttachDefinitionStatus.
@@ -115,6 +243,177 @@ func (in *AttachDefinitionStatus) DeepCopy() *AttachDefinitionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfigMapReference) DeepCopyInto(out *CNIConfigMapReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfigMapReference.
+func (in *CNIConfigMapReference) DeepCopy() *CNIConfigMapReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfigMapReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIRollout) DeepCopyInto(out *CNIRollout) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIRollout.
+func (in *CNIRollout) DeepCopy() *CNIRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CNIRollout) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIRolloutList) DeepCopyInto(out *CNIRolloutList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CNIRollout, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIRolloutList.
+func (in *CNIRolloutList) DeepCopy() *CNIRolloutList {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIRolloutList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CNIRolloutList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIRolloutSpec) DeepCopyInto(out *CNIRolloutSpec) {
+	*out = *in
+	if in.CanaryNamespaceSelector != nil {
+		in, out := &in.CanaryNamespaceSelector, &out.CanaryNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]RolloutStep, len(*in))
+		copy(*out, *in)
+	}
+	out.Interval = in.Interval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIRolloutSpec.
+func (in *CNIRolloutSpec) DeepCopy() *CNIRolloutSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIRolloutSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIRolloutStatus) DeepCopyInto(out *CNIRolloutStatus) {
+	*out = *in
+	if in.WaveStartTime != nil {
+		in, out := &in.WaveStartTime, &out.WaveStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UpdatedNamespaces != nil {
+		in, out := &in.UpdatedNamespaces, &out.UpdatedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIRolloutStatus.
+func (in *CNIRolloutStatus) DeepCopy() *CNIRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNISource) DeepCopyInto(out *CNISource) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(CNIConfigMapReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNISource.
+func (in *CNISource) DeepCopy() *CNISource {
+	if in == nil {
+		return nil
+	}
+	out := new(CNISource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PortRestriction) DeepCopyInto(out *PortRestriction) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]Ports, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortRestriction.
+func (in *PortRestriction) DeepCopy() *PortRestriction {
+	if in == nil {
+		return nil
+	}
+	out := new(PortRestriction)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Ports) DeepCopyInto(out *Ports) {
 	*out = *in
@@ -143,6 +442,11 @@ func (in *ProxyConfig) DeepCopyInto(out *ProxyConfig) {
 		*out = make([]Ports, len(*in))
 		copy(*out, *in)
 	}
+	if in.SkipOutboundServices != nil {
+		in, out := &in.SkipOutboundServices, &out.SkipOutboundServices
+		*out = make([]ServiceReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.ProxyUID != nil {
 		in, out := &in.ProxyUID, &out.ProxyUID
 		*out = new(uint32)
@@ -159,3 +463,69 @@ func (in *ProxyConfig) DeepCopy() *ProxyConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenderedRevision) DeepCopyInto(out *RenderedRevision) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenderedRevision.
+func (in *RenderedRevision) DeepCopy() *RenderedRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(RenderedRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceReference) DeepCopyInto(out *ServiceReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceReference.
+func (in *ServiceReference) DeepCopy() *ServiceReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UIDRange) DeepCopyInto(out *UIDRange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UIDRange.
+func (in *UIDRange) DeepCopy() *UIDRange {
+	if in == nil {
+		return nil
+	}
+	out := new(UIDRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UIDRestriction) DeepCopyInto(out *UIDRestriction) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]UIDRange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UIDRestriction.
+func (in *UIDRestriction) DeepCopy() *UIDRestriction {
+	if in == nil {
+		return nil
+	}
+	out := new(UIDRestriction)
+	in.DeepCopyInto(out)
+	return out
+}
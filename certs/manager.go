@@ -0,0 +1,441 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certs manages the webhook serving certificate without cert-manager:
+// it generates a CA and a serving certificate, stores them in a Secret shared by all replicas,
+// writes them to the webhook server's certificate directory, injects the CA into
+// the MutatingWebhookConfiguration and rotates the certificates before they expire.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SecretCABundleKey - CA certificates trusted by the API server, the current and the previous CA.
+	SecretCABundleKey = "ca.crt"
+	// SecretCACertKey and SecretCAKeyKey - the current CA which signs serving certificates.
+	SecretCACertKey = "ca-signer.crt"
+	SecretCAKeyKey  = "ca-signer.key"
+	// SecretServingCert and SecretServingKey - the webhook serving certificate.
+	SecretServingCert = corev1.TLSCertKey
+	SecretServingKey  = corev1.TLSPrivateKeyKey
+
+	// DefaultCertName and DefaultKeyName - file names which the webhook server reads from its certificate directory.
+	DefaultCertName = "tls.crt"
+	DefaultKeyName  = "tls.key"
+
+	DefaultCAValidity = 10 * 365 * 24 * time.Hour
+	DefaultValidity   = 365 * 24 * time.Hour
+	// DefaultRotateBefore - certificates are rotated when they expire in less than this period.
+	DefaultRotateBefore = 30 * 24 * time.Hour
+	// DefaultInterval - period of certificate checks.
+	DefaultInterval = time.Hour
+
+	// secretWriteAttempts - replicas may write the Secret concurrently, the loser re-reads it.
+	secretWriteAttempts = 3
+)
+
+// ErrNotReady - the webhook server does not serve a valid certificate yet.
+var ErrNotReady = errors.New("webhook server does not serve a valid certificate yet")
+
+//+kubebuilder:rbac:groups="",namespace=system,resources=secrets,verbs=get;create;update
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;update
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;update
+
+// Manager - keeps the webhook serving certificate valid. It must be run by every replica
+// as each replica serves the webhook with the certificate from its local directory.
+type Manager struct {
+	// Client - a client which does not use the manager's cache as the certificate must be
+	// written before the manager is started.
+	Client client.Client
+	// Secret - Secret which stores the CA and the serving certificate.
+	Secret client.ObjectKey
+	// WebhookConfigurationName - MutatingWebhookConfiguration whose webhooks get the CA bundle.
+	WebhookConfigurationName string
+	// ValidatingWebhookConfigurationName - if set, ValidatingWebhookConfiguration whose webhooks
+	// get the CA bundle. It is skipped if it does not exist.
+	ValidatingWebhookConfigurationName string
+	// Service - webhook Service, the serving certificate is issued for its DNS names.
+	Service client.ObjectKey
+	// CertDir - directory of the webhook server's certificate and key.
+	CertDir string
+	// Port - port of the webhook server used by the readiness check.
+	Port int
+
+	CAValidity   time.Duration
+	Validity     time.Duration
+	RotateBefore time.Duration
+	Interval     time.Duration
+
+	mu       sync.RWMutex
+	caBundle []byte
+}
+
+// NewManager - creates a Manager with the default validity periods.
+func NewManager(c client.Client, secret, service client.ObjectKey, webhookConfigurationName, certDir string,
+	port int) *Manager {
+	return &Manager{
+		Client:                   c,
+		Secret:                   secret,
+		Service:                  service,
+		WebhookConfigurationName: webhookConfigurationName,
+		CertDir:                  certDir,
+		Port:                     port,
+		CAValidity:               DefaultCAValidity,
+		Validity:                 DefaultValidity,
+		RotateBefore:             DefaultRotateBefore,
+		Interval:                 DefaultInterval,
+	}
+}
+
+// DNSNames - DNS names of the webhook Service.
+func (m *Manager) DNSNames() []string {
+	var (
+		name      = m.Service.Name
+		namespace = m.Service.Namespace
+	)
+
+	return []string{
+		name + "." + namespace + ".svc",
+		name,
+		name + "." + namespace,
+		name + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// Ensure - makes the Secret, the certificate files and the CA bundle of the MutatingWebhookConfiguration
+// valid, generating or rotating the certificates if needed.
+func (m *Manager) Ensure(ctx context.Context) error {
+	var (
+		secret *corev1.Secret
+		err    error
+	)
+
+	for attempt := 0; attempt < secretWriteAttempts; attempt++ {
+		secret, err = m.ensureSecret(ctx)
+		if err == nil || !(apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)) {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeFiles(secret); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.caBundle = secret.Data[SecretCABundleKey]
+	m.mu.Unlock()
+
+	return m.injectCABundle(ctx, secret.Data[SecretCABundleKey])
+}
+
+// Start - periodically checks and rotates the certificates until the context is done.
+func (m *Manager) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("certs")
+
+	var ticker = time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.Ensure(ctx); err != nil {
+				logger.Error(err, "can not ensure webhook certificate")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection - every replica writes the certificate for its own webhook server.
+func (m *Manager) NeedLeaderElection() bool {
+	return false
+}
+
+// ReadyCheck - a healthz checker which succeeds when the webhook server serves a certificate
+// which is valid for the Service and signed by the injected CA bundle.
+func (m *Manager) ReadyCheck(_ *http.Request) error {
+	m.mu.RLock()
+	var caBundle = m.caBundle
+	m.mu.RUnlock()
+
+	var pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return ErrNotReady
+	}
+
+	var dialer = &net.Dialer{Timeout: 5 * time.Second}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort("localhost", strconv.Itoa(m.Port)), &tls.Config{
+		RootCAs:    pool,
+		ServerName: m.DNSNames()[0],
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotReady, err)
+	}
+
+	return conn.Close()
+}
+
+// ServingCertificateCheck - a healthz checker which succeeds when the certificate directory contains
+// a key pair which is currently valid, for example, provided by cert-manager.
+func ServingCertificateCheck(certDir string) func(*http.Request) error {
+	return func(_ *http.Request) error {
+		pair, err := tls.LoadX509KeyPair(filepath.Join(certDir, DefaultCertName), filepath.Join(certDir, DefaultKeyName))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotReady, err)
+		}
+
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotReady, err)
+		}
+
+		if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%w: certificate is valid from %s to %s", ErrNotReady,
+				cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		}
+
+		return nil
+	}
+}
+
+// ensureSecret - returns the Secret with valid certificates, creating or updating it if needed.
+func (m *Manager) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	logger := ctrl.Log.WithName("certs").WithValues("Secret", m.Secret)
+
+	var (
+		secret = &corev1.Secret{}
+		exists = true
+	)
+
+	if err := m.Client.Get(ctx, m.Secret, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		exists = false
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: m.Secret.Namespace, Name: m.Secret.Name},
+			Type:       corev1.SecretTypeTLS,
+		}
+	}
+
+	data, changed, err := m.renew(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return secret, nil
+	}
+
+	secret.Data = data
+
+	if !exists {
+		logger.Info("Creating webhook certificate Secret")
+
+		return secret, m.Client.Create(ctx, secret)
+	}
+
+	logger.Info("Rotating webhook certificate")
+
+	return secret, m.Client.Update(ctx, secret)
+}
+
+// renew - returns the Secret data with a valid CA and serving certificate and whether it was changed.
+func (m *Manager) renew(data map[string][]byte) (map[string][]byte, bool, error) {
+	var (
+		now     = time.Now()
+		changed bool
+		result  = map[string][]byte{}
+	)
+
+	for k, v := range data {
+		result[k] = v
+	}
+
+	signer, err := parseKeyPair(data[SecretCACertKey], data[SecretCAKeyKey])
+	if err != nil || now.Add(m.RotateBefore).After(signer.cert.NotAfter) {
+		var previous = signer
+		if err != nil {
+			previous = nil
+		}
+
+		if signer, err = newCA("linkerd-cni-attach-operator-ca", m.CAValidity); err != nil {
+			return nil, false, err
+		}
+
+		// The previous CA stays in the bundle until it expires, so certificates
+		// which are still served by other replicas remain trusted.
+		var bundle = append([]byte{}, signer.certPEM...)
+		if previous != nil && now.Before(previous.cert.NotAfter) {
+			bundle = append(bundle, previous.certPEM...)
+		}
+
+		result[SecretCACertKey] = signer.certPEM
+		result[SecretCAKeyKey] = signer.keyPEM
+		result[SecretCABundleKey] = bundle
+		changed = true
+	}
+
+	serving, err := parseKeyPair(data[SecretServingCert], data[SecretServingKey])
+	if changed || err != nil || now.Add(m.RotateBefore).After(serving.cert.NotAfter) ||
+		serving.cert.CheckSignatureFrom(signer.cert) != nil || serving.cert.VerifyHostname(m.DNSNames()[0]) != nil {
+		if serving, err = newServingCert(signer, m.DNSNames(), m.Validity); err != nil {
+			return nil, false, err
+		}
+
+		result[SecretServingCert] = serving.certPEM
+		result[SecretServingKey] = serving.keyPEM
+		changed = true
+	}
+
+	if _, err = parseCertificates(result[SecretCABundleKey]); err != nil {
+		result[SecretCABundleKey] = signer.certPEM
+		changed = true
+	}
+
+	return result, changed, nil
+}
+
+// writeFiles - writes the serving certificate and key to the certificate directory if they differ,
+// the webhook server reloads them from disk.
+func (m *Manager) writeFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(m.CertDir, 0o700); err != nil {
+		return err
+	}
+
+	for name, content := range map[string][]byte{
+		DefaultKeyName:  secret.Data[SecretServingKey],
+		DefaultCertName: secret.Data[SecretServingCert],
+	} {
+		var path = filepath.Join(m.CertDir, name)
+
+		if current, err := os.ReadFile(filepath.Clean(path)); err == nil && bytes.Equal(current, content) {
+			continue
+		}
+
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// injectCABundle - sets the CA bundle of all webhooks of the webhook configurations.
+func (m *Manager) injectCABundle(ctx context.Context, caBundle []byte) error {
+	if err := m.injectMutatingCABundle(ctx, caBundle); err != nil {
+		return err
+	}
+
+	if m.ValidatingWebhookConfigurationName == "" {
+		return nil
+	}
+
+	return m.injectValidatingCABundle(ctx, caBundle)
+}
+
+// injectMutatingCABundle - sets the CA bundle of all webhooks of the MutatingWebhookConfiguration.
+func (m *Manager) injectMutatingCABundle(ctx context.Context, caBundle []byte) error {
+	logger := ctrl.Log.WithName("certs").WithValues("MutatingWebhookConfiguration", m.WebhookConfigurationName)
+
+	var configuration = &admissionregistrationv1.MutatingWebhookConfiguration{}
+
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: m.WebhookConfigurationName}, configuration); err != nil {
+		return err
+	}
+
+	var changed bool
+
+	for i := range configuration.Webhooks {
+		if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			configuration.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	logger.Info("Injecting CA bundle")
+
+	return m.Client.Update(ctx, configuration)
+}
+
+// injectValidatingCABundle - sets the CA bundle of all webhooks of the ValidatingWebhookConfiguration,
+// installations without AttachDefinitionPolicies may not have it.
+func (m *Manager) injectValidatingCABundle(ctx context.Context, caBundle []byte) error {
+	logger := ctrl.Log.WithName("certs").WithValues("ValidatingWebhookConfiguration",
+		m.ValidatingWebhookConfigurationName)
+
+	var configuration = &admissionregistrationv1.ValidatingWebhookConfiguration{}
+
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: m.ValidatingWebhookConfigurationName}, configuration); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("ValidatingWebhookConfiguration is not found, skip")
+
+			return nil
+		}
+
+		return err
+	}
+
+	var changed bool
+
+	for i := range configuration.Webhooks {
+		if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			configuration.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	logger.Info("Injecting CA bundle")
+
+	return m.Client.Update(ctx, configuration)
+}
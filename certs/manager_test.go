@@ -0,0 +1,329 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const operatorNamespace = "linkerd-cni-attach-operator"
+
+// managerFor - a Manager with the default validity periods which issues certificates for the Service.
+func managerFor(service string) *Manager {
+	return NewManager(nil,
+		client.ObjectKey{Namespace: operatorNamespace, Name: "webhook-server-cert"},
+		client.ObjectKey{Namespace: operatorNamespace, Name: service},
+		"linkerd-cni-attach-operator-mutating-webhook-configuration", "", 9443)
+}
+
+func TestRenew(t *testing.T) {
+	var tests = []struct {
+		name string
+		// issuer - the Manager which generated the current Secret data, nil for a new Secret.
+		issuer *Manager
+		// corrupt - if set, damages the current Secret data.
+		corrupt            func(data map[string][]byte)
+		wantChanged        bool
+		wantCARotated      bool
+		wantServingRotated bool
+		// wantBundle - number of CAs in the CA bundle.
+		wantBundle int
+	}{
+		{
+			name:               "new Secret",
+			wantChanged:        true,
+			wantCARotated:      true,
+			wantServingRotated: true,
+			wantBundle:         1,
+		},
+		{
+			name:       "valid certificates",
+			issuer:     managerFor("webhook-service"),
+			wantBundle: 1,
+		},
+		{
+			name: "CA expires soon",
+			issuer: func() *Manager {
+				var m = managerFor("webhook-service")
+				m.CAValidity = 24 * time.Hour
+
+				return m
+			}(),
+			wantChanged:        true,
+			wantCARotated:      true,
+			wantServingRotated: true,
+			wantBundle:         2,
+		},
+		{
+			name: "expired CA is not trusted",
+			issuer: func() *Manager {
+				var m = managerFor("webhook-service")
+				m.CAValidity = -time.Minute
+
+				return m
+			}(),
+			wantChanged:        true,
+			wantCARotated:      true,
+			wantServingRotated: true,
+			wantBundle:         1,
+		},
+		{
+			name: "serving certificate expires soon",
+			issuer: func() *Manager {
+				var m = managerFor("webhook-service")
+				m.Validity = 24 * time.Hour
+
+				return m
+			}(),
+			wantChanged:        true,
+			wantServingRotated: true,
+			wantBundle:         1,
+		},
+		{
+			name:               "serving certificate of another Service",
+			issuer:             managerFor("old-webhook-service"),
+			wantChanged:        true,
+			wantServingRotated: true,
+			wantBundle:         1,
+		},
+		{
+			name:   "invalid serving key",
+			issuer: managerFor("webhook-service"),
+			corrupt: func(data map[string][]byte) {
+				data[SecretServingKey] = []byte("invalid")
+			},
+			wantChanged:        true,
+			wantServingRotated: true,
+			wantBundle:         1,
+		},
+		{
+			name:   "invalid CA bundle",
+			issuer: managerFor("webhook-service"),
+			corrupt: func(data map[string][]byte) {
+				data[SecretCABundleKey] = []byte("invalid")
+			},
+			wantChanged: true,
+			wantBundle:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				m    = managerFor("webhook-service")
+				data map[string][]byte
+			)
+
+			if tt.issuer != nil {
+				issued, _, err := tt.issuer.renew(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				data = issued
+			}
+
+			if tt.corrupt != nil {
+				tt.corrupt(data)
+			}
+
+			got, changed, err := m.renew(data)
+			if err != nil {
+				t.Fatalf("renew() error = %v", err)
+			}
+
+			if changed != tt.wantChanged {
+				t.Errorf("renew() changed = %t, want %t", changed, tt.wantChanged)
+			}
+
+			if rotated := !bytes.Equal(got[SecretCACertKey], data[SecretCACertKey]); rotated != tt.wantCARotated {
+				t.Errorf("CA rotated = %t, want %t", rotated, tt.wantCARotated)
+			}
+
+			if rotated := !bytes.Equal(got[SecretServingCert], data[SecretServingCert]); rotated != tt.wantServingRotated {
+				t.Errorf("serving certificate rotated = %t, want %t", rotated, tt.wantServingRotated)
+			}
+
+			bundle, err := parseCertificates(got[SecretCABundleKey])
+			if err != nil || len(bundle) != tt.wantBundle {
+				t.Fatalf("CA bundle has %d certificates, error %v, want %d", len(bundle), err, tt.wantBundle)
+			}
+
+			// The current CA is the first one in the bundle and signs the serving certificate for the Service.
+			if !bytes.Equal(bundle[0].Raw, mustParseKeyPair(t, got[SecretCACertKey], got[SecretCAKeyKey]).cert.Raw) {
+				t.Error("the first certificate of the CA bundle is not the current CA")
+			}
+
+			var roots = x509.NewCertPool()
+			for _, ca := range bundle {
+				roots.AddCert(ca)
+			}
+
+			var serving = mustParseKeyPair(t, got[SecretServingCert], got[SecretServingKey])
+			if _, err := serving.cert.Verify(x509.VerifyOptions{
+				DNSName: m.DNSNames()[0],
+				Roots:   roots,
+			}); err != nil {
+				t.Errorf("serving certificate is not valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	var (
+		ctx = context.Background()
+		m   = managerFor("webhook-service")
+	)
+
+	var webhook = admissionregistrationv1.MutatingWebhook{
+		Name: "mpod.cni.linkerd.io",
+	}
+
+	m.CertDir = t.TempDir()
+	m.Client = fake.NewClientBuilder().WithObjects(
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: m.WebhookConfigurationName},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{webhook, webhook},
+		},
+	).Build()
+
+	if err := m.Ensure(ctx); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+
+	var secret = &corev1.Secret{}
+	if err := m.Client.Get(ctx, m.Secret, secret); err != nil {
+		t.Fatalf("Secret is not created: %v", err)
+	}
+
+	for name, key := range map[string]string{DefaultCertName: SecretServingCert, DefaultKeyName: SecretServingKey} {
+		content, err := os.ReadFile(filepath.Join(m.CertDir, name))
+		if err != nil || !bytes.Equal(content, secret.Data[key]) {
+			t.Errorf("%s is not written from the Secret: %v", name, err)
+		}
+	}
+
+	var configuration = &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: m.WebhookConfigurationName}, configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, webhook := range configuration.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, secret.Data[SecretCABundleKey]) {
+			t.Errorf("CA bundle is not injected into webhook %s", webhook.Name)
+		}
+	}
+
+	// Valid certificates are not rotated.
+	if err := m.Ensure(ctx); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+
+	var current = &corev1.Secret{}
+	if err := m.Client.Get(ctx, m.Secret, current); err != nil {
+		t.Fatal(err)
+	}
+
+	if current.ResourceVersion != secret.ResourceVersion {
+		t.Errorf("Secret is updated, resourceVersion %s -> %s", secret.ResourceVersion, current.ResourceVersion)
+	}
+}
+
+func TestEnsureValidatingWebhookConfiguration(t *testing.T) {
+	var tests = []struct {
+		name    string
+		objects []client.Object
+	}{
+		{
+			name: "injected",
+			objects: []client.Object{&admissionregistrationv1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: "linkerd-cni-attach-operator-validating-webhook-configuration"},
+				Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "vattachdefinition.cni.linkerd.io"}},
+			}},
+		},
+		{
+			name: "not installed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ctx = context.Background()
+				m   = managerFor("webhook-service")
+			)
+
+			m.CertDir = t.TempDir()
+			m.ValidatingWebhookConfigurationName = "linkerd-cni-attach-operator-validating-webhook-configuration"
+			m.Client = fake.NewClientBuilder().WithObjects(append(tt.objects,
+				&admissionregistrationv1.MutatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: m.WebhookConfigurationName},
+				})...,
+			).Build()
+
+			if err := m.Ensure(ctx); err != nil {
+				t.Fatalf("Ensure() error = %v", err)
+			}
+
+			if len(tt.objects) == 0 {
+				return
+			}
+
+			var (
+				secret        = &corev1.Secret{}
+				configuration = &admissionregistrationv1.ValidatingWebhookConfiguration{}
+			)
+
+			if err := m.Client.Get(ctx, m.Secret, secret); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.Client.Get(ctx, client.ObjectKeyFromObject(tt.objects[0]), configuration); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(configuration.Webhooks[0].ClientConfig.CABundle, secret.Data[SecretCABundleKey]) {
+				t.Error("CA bundle is not injected into the ValidatingWebhookConfiguration")
+			}
+		})
+	}
+}
+
+// mustParseKeyPair - parses the PEM encoded key pair or fails the test.
+func mustParseKeyPair(t *testing.T, certPEM, keyPEM []byte) *keyPair {
+	t.Helper()
+
+	pair, err := parseKeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
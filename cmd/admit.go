@@ -0,0 +1,268 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+
+	podwebhook "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1"
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+const admissionReviewKind = "AdmissionReview"
+
+// admitResult - outcome of the pod webhook for a replayed admission request.
+type admitResult struct {
+	Allowed  bool                           `json:"allowed"`
+	Code     int32                          `json:"code,omitempty"`
+	Reason   string                         `json:"reason,omitempty"`
+	Message  string                         `json:"message,omitempty"`
+	Warnings []string                       `json:"warnings,omitempty"`
+	Patch    []jsonpatch.JsonPatchOperation `json:"patch,omitempty"`
+}
+
+// runAdmit - replays an AdmissionReview or a bare Pod through the pod webhook
+// against an in-memory client populated with the provided manifests. The operator configuration
+// is loaded as the manager does, so exclusions and webhook settings of --config apply.
+// nolint:funlen,gocyclo // flags parsing and loading of optional manifests.
+func runAdmit(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var (
+		flags = flag.NewFlagSet("admit", flag.ContinueOnError)
+
+		requestPath   string
+		namespacePath string
+		multusPath    string
+		attachPath    string
+		configMapPath string
+		linkerdConfig string
+		output        string
+	)
+
+	flags.SetOutput(stderr)
+
+	var configFlags = operatorconfig.BindFlags(flags)
+
+	flags.StringVar(&requestPath, "request", "",
+		"Path to an AdmissionReview or a Pod manifest, \"-\" to read from stdin.")
+	flags.StringVar(&namespacePath, "namespace", "",
+		"Path to the Pod's Namespace manifest. If not set, a Namespace without annotations is used.")
+	flags.StringVar(&multusPath, "network-attachment-definition", "",
+		"Path to the Namespace's Multus NetworkAttachmentDefinition manifest.")
+	flags.StringVar(&attachPath, "attach-definition", "",
+		"Path to the Namespace's AttachDefinition manifest.")
+	flags.StringVar(&configMapPath, "cni-config-map", "",
+		"Path to a Linkerd CNI ConfigMap manifest. If set together with --attach-definition and "+
+			"without --network-attachment-definition, the NetworkAttachmentDefinition is rendered.")
+	flags.StringVar(&linkerdConfig, "linkerd-config", "",
+		"Path to the linkerd-config ConfigMap manifest, required to render the NetworkAttachmentDefinition "+
+			"if the operator configuration sets linkerdConfig.")
+	flags.StringVar(&output, "o", OutputYAML, "Output format: yaml or json.")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if requestPath == "" {
+		return fmt.Errorf("%w: --request", ErrRequiredFlagNotSet)
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+
+	if err = checkStdinUsage(requestPath, namespacePath, multusPath, attachPath, configMapPath, linkerdConfig); err != nil {
+		return err
+	}
+
+	req, err := readAdmissionRequest(requestPath, stdin)
+	if err != nil {
+		return err
+	}
+
+	// Namespace of the request.
+	var namespace = &corev1.Namespace{}
+
+	if namespacePath != "" {
+		if err = decodeInput(namespacePath, stdin, namespace); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case req.Namespace == "" && namespace.Name == "":
+		req.Namespace = corev1.NamespaceDefault
+	case req.Namespace == "":
+		req.Namespace = namespace.Name
+	}
+
+	namespace.Name = req.Namespace
+
+	var objects = []client.Object{namespace}
+
+	// AttachDefinition and NetworkAttachmentDefinition.
+	var ldAttach *cniv1alpha1.AttachDefinition
+
+	if attachPath != "" {
+		ldAttach = &cniv1alpha1.AttachDefinition{
+			Spec: cniv1alpha1.AttachDefinitionSpec{CreateMultusNetworkAttachmentDefinition: true},
+		}
+
+		if err = decodeInput(attachPath, stdin, ldAttach); err != nil {
+			return err
+		}
+
+		ldAttach.Namespace = req.Namespace
+
+		objects = append(objects, ldAttach)
+	}
+
+	switch {
+	case multusPath != "":
+		var multus = &netattachv1.NetworkAttachmentDefinition{}
+
+		if err = decodeInput(multusPath, stdin, multus); err != nil {
+			return err
+		}
+
+		multus.Namespace = req.Namespace
+
+		objects = append(objects, multus)
+	case ldAttach != nil && configMapPath != "" && ldAttach.Spec.CreateMultusNetworkAttachmentDefinition:
+		var cniConfigMap = &corev1.ConfigMap{}
+
+		if err = decodeInput(configMapPath, stdin, cniConfigMap); err != nil {
+			return err
+		}
+
+		var linkerdConfigMap *corev1.ConfigMap
+
+		if linkerdConfig != "" {
+			linkerdConfigMap = &corev1.ConfigMap{}
+
+			if err = decodeInput(linkerdConfig, stdin, linkerdConfigMap); err != nil {
+				return err
+			}
+		}
+
+		multus, err := renderOffline(config, ldAttach, cniConfigMap, linkerdConfigMap)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, multus)
+	}
+
+	var scheme = newScheme()
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		return err
+	}
+
+	var annotator = &podwebhook.PodAnnotator{
+		Client:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Config:       operatorconfig.NewStore(config, "", nil),
+		InstanceName: config.InstanceName,
+	}
+
+	if err = annotator.InjectDecoder(decoder); err != nil {
+		return err
+	}
+
+	var resp = annotator.Handle(context.Background(), admission.Request{AdmissionRequest: *req})
+
+	var result = &admitResult{
+		Allowed:  resp.Allowed,
+		Warnings: resp.Warnings,
+		Patch:    resp.Patches,
+	}
+
+	if resp.Result != nil {
+		result.Code = resp.Result.Code
+		result.Reason = string(resp.Result.Reason)
+		result.Message = resp.Result.Message
+	}
+
+	return printObject(stdout, result, output)
+}
+
+// readAdmissionRequest - reads an AdmissionReview or wraps a bare Pod into a CREATE admission request.
+func readAdmissionRequest(path string, stdin io.Reader) (*admissionv1.AdmissionRequest, error) {
+	raw, err := readInput(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	var typeMeta = &metav1.TypeMeta{}
+
+	if err = yaml.Unmarshal(raw, typeMeta); err != nil {
+		return nil, fmt.Errorf("can not decode %s: %w", path, err)
+	}
+
+	if typeMeta.Kind == admissionReviewKind {
+		var review = &admissionv1.AdmissionReview{}
+
+		if err = yaml.Unmarshal(raw, review); err != nil {
+			return nil, fmt.Errorf("can not decode %s: %w", path, err)
+		}
+
+		if review.Request == nil {
+			return nil, fmt.Errorf("%s: AdmissionReview does not contain request", path)
+		}
+
+		return review.Request, nil
+	}
+
+	var pod = &corev1.Pod{}
+
+	if err = yaml.UnmarshalStrict(raw, pod); err != nil {
+		return nil, fmt.Errorf("can not decode %s: %w", path, err)
+	}
+
+	podRaw, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID("offline-admit"),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: podRaw},
+	}, nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gomodules.xyz/jsonpatch/v2"
+)
+
+const (
+	injectedPod = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: app
+  annotations:
+    linkerd.io/inject: enabled
+spec:
+  containers:
+  - name: web
+    image: nginx
+`
+
+	plainPod = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: app
+spec:
+  containers:
+  - name: web
+    image: nginx
+`
+
+	injectedNamespace = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: app
+  annotations:
+    linkerd.io/inject: enabled
+`
+)
+
+// linkerdCNIAnnotations - annotations which the pod webhook adds to a meshed Pod of the example AttachDefinition.
+var linkerdCNIAnnotations = map[string]string{
+	"k8s.v1.cni.cncf.io/networks": "linkerd-cni",
+	"config.linkerd.io/proxy-uid": "1000681000",
+}
+
+// patchedAnnotations - returns the annotations which the patch sets, other changes are ignored
+// as the webhook also normalizes the Pod's JSON.
+func patchedAnnotations(patch []jsonpatch.JsonPatchOperation) map[string]string {
+	var (
+		annotations = map[string]string{}
+		unescape    = strings.NewReplacer("~1", "/", "~0", "~")
+	)
+
+	for _, operation := range patch {
+		switch {
+		case operation.Path == "/metadata/annotations":
+			values, _ := operation.Value.(map[string]interface{})
+			for name, value := range values {
+				annotations[name], _ = value.(string)
+			}
+		case strings.HasPrefix(operation.Path, "/metadata/annotations/"):
+			annotations[unescape.Replace(strings.TrimPrefix(operation.Path, "/metadata/annotations/"))], _ =
+				operation.Value.(string)
+		}
+	}
+
+	return annotations
+}
+
+// writeManifest - writes the manifest to a temporary file and returns its path.
+func writeManifest(t *testing.T, name, manifest string) string {
+	t.Helper()
+
+	var path = filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRunAdmit(t *testing.T) {
+	var withAttachDefinition = []string{
+		"--attach-definition", exampleAttachDefinition, "--cni-config-map", exampleCNIConfigMap,
+	}
+
+	var tests = []struct {
+		name            string
+		args            []string
+		stdin           string
+		wantAllowed     bool
+		wantAnnotations map[string]string
+		wantErr         error
+	}{
+		{
+			name:            "meshed Pod",
+			args:            withAttachDefinition,
+			stdin:           injectedPod,
+			wantAllowed:     true,
+			wantAnnotations: linkerdCNIAnnotations,
+		},
+		{
+			name: "AdmissionReview",
+			args: withAttachDefinition,
+			stdin: func() string {
+				var review = "apiVersion: admission.k8s.io/v1\nkind: AdmissionReview\nrequest:\n" +
+					"  uid: 0df28fbd-5f5f-11e8-bc74-36e6bb280816\n  kind: {version: v1, kind: Pod}\n" +
+					"  resource: {version: v1, resource: pods}\n  namespace: app\n  operation: CREATE\n  object:\n"
+
+				for _, line := range strings.Split(strings.TrimSpace(injectedPod), "\n") {
+					review += "    " + line + "\n"
+				}
+
+				return review
+			}(),
+			wantAllowed:     true,
+			wantAnnotations: linkerdCNIAnnotations,
+		},
+		{
+			name: "Namespace requests injection",
+			args: append([]string{
+				"--namespace", writeManifest(t, "namespace.yaml", injectedNamespace),
+			}, withAttachDefinition...),
+			stdin:           plainPod,
+			wantAllowed:     true,
+			wantAnnotations: linkerdCNIAnnotations,
+		},
+		{
+			name:        "Pod is not meshed",
+			args:        withAttachDefinition,
+			stdin:       plainPod,
+			wantAllowed: true,
+		},
+		{
+			name:  "NetworkAttachmentDefinition is not found",
+			stdin: injectedPod,
+		},
+		{
+			name:    "stdin is used twice",
+			args:    []string{"--attach-definition", StdinPath},
+			stdin:   injectedPod,
+			wantErr: ErrStdinUsedTwice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			err := runAdmit(append([]string{"--request", StdinPath, "-o", "json"}, tt.args...),
+				strings.NewReader(tt.stdin), &stdout, &stderr)
+			if tt.wantErr != nil || err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("runAdmit() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			var result = &admitResult{}
+			if err := json.Unmarshal(stdout.Bytes(), result); err != nil {
+				t.Fatalf("can not decode the result %q: %v", stdout.String(), err)
+			}
+
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %t, want %t: %s", result.Allowed, tt.wantAllowed, result.Message)
+			}
+
+			var annotations = patchedAnnotations(result.Patch)
+
+			if len(annotations) != 0 || len(tt.wantAnnotations) != 0 {
+				if !reflect.DeepEqual(annotations, tt.wantAnnotations) {
+					t.Errorf("patched annotations = %v, want %v", annotations, tt.wantAnnotations)
+				}
+			}
+		})
+	}
+}
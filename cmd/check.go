@@ -0,0 +1,651 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+const (
+	CheckStatusOK   = "ok"
+	CheckStatusWarn = "warn"
+	CheckStatusFail = "fail"
+
+	OutputText = "text"
+
+	checkTimeout = 30 * time.Second
+	dialTimeout  = 5 * time.Second
+
+	// linkerdCNIKubeconfigPlaceholder - value of the kubeconfig path in the Linkerd CNI ConfigMap
+	// which is replaced by the Linkerd CNI installer.
+	linkerdCNIKubeconfigPlaceholder = "__KUBECONFIG_FILEPATH__"
+)
+
+// nolint:stylecheck // The error text starts from the name of the application, so capital letter.
+var ErrChecksFailed = errors.New("some checks failed")
+
+// permission - an API operation which the operator requires.
+type permission struct {
+	Group       string
+	Resource    string
+	Subresource string
+	Verbs       []string
+	// Namespaced - the operation is granted by a Role in the operator's Namespace.
+	Namespaced bool
+}
+
+// requiredPermissions - operations granted to the operator by config/rbac/role.yaml, which is generated
+// from the kubebuilder RBAC markers, and by config/rbac/leader_election_role.yaml.
+// TestRequiredPermissionsMatchRoles keeps them in sync.
+var requiredPermissions = []permission{
+	{Group: "", Resource: "pods", Verbs: []string{"get", "list", "watch"}},
+	{Group: "", Resource: "pods", Subresource: "eviction", Verbs: []string{"create"}},
+	{Group: "", Resource: "namespaces", Verbs: []string{"get", "list", "watch"}},
+	{Group: "", Resource: "configmaps", Verbs: []string{"get", "list", "watch"}},
+	{Group: "", Resource: "events", Verbs: []string{"create", "patch"}},
+	{Group: "", Resource: "services", Verbs: []string{"get", "list", "watch"}},
+	{Group: "", Resource: "endpoints", Verbs: []string{"get", "list", "watch"}},
+	{
+		Group: "cni.linkerd.io", Resource: "attachdefinitions",
+		Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{Group: "cni.linkerd.io", Resource: "attachdefinitions", Subresource: "status", Verbs: []string{"get", "update", "patch"}},
+	{Group: "cni.linkerd.io", Resource: "attachdefinitions", Subresource: "finalizers", Verbs: []string{"update"}},
+	{Group: "cni.linkerd.io", Resource: "attachdefinitionpolicies", Verbs: []string{"get", "list", "watch"}},
+	{Group: "cni.linkerd.io", Resource: "cnirollouts", Verbs: []string{"get", "list", "watch"}},
+	{Group: "cni.linkerd.io", Resource: "cnirollouts", Subresource: "status", Verbs: []string{"get", "update", "patch"}},
+	{
+		Group: "k8s.cni.cncf.io", Resource: "network-attachment-definitions",
+		Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{Group: "admissionregistration.k8s.io", Resource: "mutatingwebhookconfigurations", Verbs: []string{"get", "update"}},
+	{Group: "admissionregistration.k8s.io", Resource: "validatingwebhookconfigurations", Verbs: []string{"get", "update"}},
+	// The webhook certificate and the last known good CNI configurations.
+	{Group: "", Resource: "secrets", Verbs: []string{"get", "create", "update"}, Namespaced: true},
+	// Leader election.
+	{Group: "", Resource: "configmaps", Verbs: []string{"get", "create", "update"}, Namespaced: true},
+	{Group: "coordination.k8s.io", Resource: "leases", Verbs: []string{"get", "create", "update"}, Namespaced: true},
+	{Group: "", Resource: "events", Verbs: []string{"create", "patch"}, Namespaced: true},
+}
+
+// checkResult - a result of one preflight check.
+type checkResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// checkReport - results of all preflight checks.
+type checkReport struct {
+	Success bool          `json:"success"`
+	Checks  []checkResult `json:"checks"`
+}
+
+func (r *checkReport) add(name, status, message string) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: status, Message: message})
+
+	if status == CheckStatusFail {
+		r.Success = false
+	}
+}
+
+// checker - runs preflight checks against a cluster.
+type checker struct {
+	kubeClient kubernetes.Interface
+	config     *operatorconfig.Config
+
+	cniConfigMapRef controllers.CNIConfigMapRef
+	cniKubeconfig   string
+	webhookName     string
+	serviceAccount  string
+	dialWebhook     bool
+}
+
+// runCheck - verifies that the cluster has everything the operator depends on.
+func runCheck(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		flags = flag.NewFlagSet("check", flag.ContinueOnError)
+
+		kubeconfig string
+		output     string
+		c          = &checker{}
+	)
+
+	flags.SetOutput(stderr)
+
+	// The Linkerd CNI ConfigMap, the kubeconfig path and the instance are taken from
+	// the operator configuration loaded as the manager does it.
+	var configFlags = operatorconfig.BindFlags(flags)
+
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flags.StringVar(&c.webhookName, "webhook-name", "",
+		"Name of the pod webhook in the MutatingWebhookConfiguration. Defaults to the one of the operator instance.")
+	flags.StringVar(&c.serviceAccount, "service-account", "",
+		"Operator's ServiceAccount as namespace/name to check RBAC for. "+
+			"If not set, permissions of the current user are checked.")
+	flags.BoolVar(&c.dialWebhook, "dial-webhook", false,
+		"Open a TLS connection to the webhook Service, requires in-cluster network access.")
+	flags.StringVar(&output, "o", OutputText, "Output format: text or json.")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+
+	c.config = config
+	c.cniConfigMapRef = controllers.CNIConfigMapRef{
+		ObjectKey: client.ObjectKey{Namespace: config.CNIConfigMap.Namespace, Name: config.CNIConfigMap.Name},
+		Key:       config.CNIConfigMap.Key,
+	}
+	c.cniKubeconfig = config.CNIKubeconfig
+
+	if c.webhookName == "" {
+		c.webhookName = operatorconfig.PodWebhookName(config.InstanceName)
+	}
+
+	restConfig, err := getRESTConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	if c.kubeClient, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	var report = c.run(ctx)
+
+	switch output {
+	case OutputText:
+		if err = printCheckReport(stdout, report); err != nil {
+			return err
+		}
+	case OutputJSON:
+		if err = printObject(stdout, report, OutputJSON); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedOutput, output)
+	}
+
+	if !report.Success {
+		return ErrChecksFailed
+	}
+
+	return nil
+}
+
+// run - runs all checks.
+func (c *checker) run(ctx context.Context) *checkReport {
+	var report = &checkReport{Success: true}
+
+	c.checkMultusCRD(report)
+
+	if cniConfigMap := c.checkCNIConfigMap(ctx, report); cniConfigMap != nil {
+		c.checkCNIKubeconfig(cniConfigMap, report)
+	}
+
+	c.checkWebhook(ctx, report)
+	c.checkValidatingWebhook(ctx, report)
+	c.checkRBAC(ctx, report)
+
+	return report
+}
+
+// checkMultusCRD - checks that Multus NetworkAttachmentDefinition CRD is installed.
+func (c *checker) checkMultusCRD(report *checkReport) {
+	const name = "multus-crd"
+
+	resources, err := c.kubeClient.Discovery().ServerResourcesForGroupVersion(
+		constants.MultusNetworkAttachmentDefinitionAPIVersion)
+	if err != nil {
+		report.add(name, CheckStatusFail, "Multus API is not available: "+err.Error())
+
+		return
+	}
+
+	for i := range resources.APIResources {
+		if resources.APIResources[i].Kind == constants.MultusNetworkAttachmentDefinitionResourceKind {
+			report.add(name, CheckStatusOK, "Multus NetworkAttachmentDefinition CRD is installed")
+
+			return
+		}
+	}
+
+	report.add(name, CheckStatusFail, "Multus NetworkAttachmentDefinition CRD is not installed")
+}
+
+// checkCNIConfigMap - checks that the Linkerd CNI ConfigMap exists and can be parsed.
+func (c *checker) checkCNIConfigMap(ctx context.Context, report *checkReport) *corev1.ConfigMap {
+	const name = "cni-config-map"
+
+	var ref = c.cniConfigMapRef.Namespace + "/" + c.cniConfigMapRef.Name
+
+	cniConfigMap, err := c.kubeClient.CoreV1().ConfigMaps(c.cniConfigMapRef.Namespace).Get(
+		ctx, c.cniConfigMapRef.Name, metav1.GetOptions{})
+	if err != nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf("can not get Linkerd CNI ConfigMap %s: %v", ref, err))
+
+		return nil
+	}
+
+	if _, err = controllers.ParseLinkerdCNIConfig(cniConfigMap, c.cniConfigMapRef.Key, c.cniKubeconfig); err != nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf("can not parse Linkerd CNI ConfigMap %s: %v", ref, err))
+
+		return nil
+	}
+
+	report.add(name, CheckStatusOK, fmt.Sprintf("Linkerd CNI ConfigMap %s key %q is valid", ref, c.cniConfigMapRef.Key))
+
+	return cniConfigMap
+}
+
+// checkCNIKubeconfig - checks that the configured kubeconfig path matches the path
+// which Linkerd CNI installer writes.
+func (c *checker) checkCNIKubeconfig(cniConfigMap *corev1.ConfigMap, report *checkReport) {
+	const name = "cni-kubeconfig"
+
+	// Kubeconfig path which is configured in the ConfigMap without the operator's patch.
+	var cniConfig = &controllers.CNIPluginConf{}
+
+	if err := json.Unmarshal([]byte(cniConfigMap.Data[c.cniConfigMapRef.Key]), cniConfig); err != nil {
+		report.add(name, CheckStatusFail, err.Error())
+
+		return
+	}
+
+	var expected = cniConfig.Kubernetes.Kubeconfig
+
+	if expected == "" || expected == linkerdCNIKubeconfigPlaceholder {
+		netDir, ok := cniConfigMap.Data[constants.LinkerdCNINetDirKey]
+		if !ok {
+			report.add(name, CheckStatusWarn, fmt.Sprintf(
+				"can not determine Linkerd CNI kubeconfig path: ConfigMap has no %q key", constants.LinkerdCNINetDirKey))
+
+			return
+		}
+
+		expected = path.Join(netDir, constants.LinkerdCNIKubeconfigFileName)
+	}
+
+	if expected != c.cniKubeconfig {
+		report.add(name, CheckStatusFail, fmt.Sprintf(
+			"operator uses kubeconfig %q, but Linkerd CNI writes %q", c.cniKubeconfig, expected))
+
+		return
+	}
+
+	report.add(name, CheckStatusOK, fmt.Sprintf("kubeconfig path %q matches Linkerd CNI installation", expected))
+}
+
+// checkWebhook - checks that the MutatingWebhookConfiguration points at a Service
+// with ready endpoints and has a valid CA bundle.
+func (c *checker) checkWebhook(ctx context.Context, report *checkReport) {
+	const name = "webhook"
+
+	configurations, err := c.kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().List(
+		ctx, metav1.ListOptions{})
+	if err != nil {
+		report.add(name, CheckStatusFail, "can not list MutatingWebhookConfigurations: "+err.Error())
+
+		return
+	}
+
+	for i := range configurations.Items {
+		for j := range configurations.Items[i].Webhooks {
+			var webhook = &configurations.Items[i].Webhooks[j]
+
+			if webhook.Name == c.webhookName {
+				c.checkWebhookClientConfig(ctx, report, name, webhook.Name, configurations.Items[i].Name,
+					&webhook.ClientConfig, constants.PodWebhookPath)
+
+				return
+			}
+		}
+	}
+
+	report.add(name, CheckStatusFail, fmt.Sprintf("MutatingWebhookConfiguration with webhook %s is not found", c.webhookName))
+}
+
+// checkValidatingWebhook - checks that the AttachDefinitionPolicy webhook of the ValidatingWebhookConfiguration
+// points at a Service with ready endpoints and has a valid CA bundle.
+// Without the configuration AttachDefinitionPolicies are not validated, so its absence is a warning.
+func (c *checker) checkValidatingWebhook(ctx context.Context, report *checkReport) {
+	const name = "validating-webhook"
+
+	var configName = c.config.Webhook.ValidatingConfigurationName
+
+	configuration, err := c.kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(
+		ctx, configName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		report.add(name, CheckStatusWarn, fmt.Sprintf(
+			"ValidatingWebhookConfiguration %s is not found, AttachDefinitionPolicies are not validated", configName))
+
+		return
+	}
+
+	if err != nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf("can not get ValidatingWebhookConfiguration %s: %v", configName, err))
+
+		return
+	}
+
+	for i := range configuration.Webhooks {
+		var webhook = &configuration.Webhooks[i]
+
+		if webhook.Name == constants.AttachDefinitionPolicyWebhookName {
+			c.checkWebhookClientConfig(ctx, report, name, webhook.Name, configName,
+				&webhook.ClientConfig, constants.AttachDefinitionPolicyWebhookPath)
+
+			return
+		}
+	}
+
+	report.add(name, CheckStatusFail, fmt.Sprintf(
+		"webhook %s is not found in %s", constants.AttachDefinitionPolicyWebhookName, configName))
+}
+
+// checkWebhookClientConfig - checks that a webhook points at the path of a Service with ready endpoints
+// and has a valid CA bundle.
+func (c *checker) checkWebhookClientConfig(ctx context.Context, report *checkReport, name, webhookName, configName string,
+	clientConfig *admissionregistrationv1.WebhookClientConfig, webhookPath string) {
+	service := clientConfig.Service
+	if service == nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf(
+			"webhook %s in %s does not reference a Service", webhookName, configName))
+
+		return
+	}
+
+	if service.Path == nil || *service.Path != webhookPath {
+		report.add(name, CheckStatusFail, fmt.Sprintf(
+			"webhook %s in %s must use path %s", webhookName, configName, webhookPath))
+
+		return
+	}
+
+	if err := checkCABundle(clientConfig.CABundle); err != nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf(
+			"webhook %s in %s has invalid caBundle: %v", webhookName, configName, err))
+
+		return
+	}
+
+	var serviceRef = service.Namespace + "/" + service.Name
+
+	endpoints, err := c.kubeClient.CoreV1().Endpoints(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	if err != nil {
+		report.add(name, CheckStatusFail, fmt.Sprintf("can not get webhook Service %s endpoints: %v", serviceRef, err))
+
+		return
+	}
+
+	if !hasReadyAddresses(endpoints) {
+		report.add(name, CheckStatusFail, fmt.Sprintf("webhook Service %s has no ready endpoints", serviceRef))
+
+		return
+	}
+
+	if c.dialWebhook {
+		if err = dialWebhook(service, clientConfig.CABundle); err != nil {
+			report.add(name, CheckStatusFail, fmt.Sprintf("can not connect to webhook Service %s: %v", serviceRef, err))
+
+			return
+		}
+	}
+
+	report.add(name, CheckStatusOK, fmt.Sprintf(
+		"webhook %s in %s points at Service %s with ready endpoints", webhookName, configName, serviceRef))
+}
+
+// checkRBAC - checks that the operator is allowed to perform all required operations.
+func (c *checker) checkRBAC(ctx context.Context, report *checkReport) {
+	const name = "rbac"
+
+	var denied []string
+
+	namespace, err := c.operatorNamespace()
+	if err != nil {
+		report.add(name, CheckStatusFail, err.Error())
+
+		return
+	}
+
+	for _, perm := range requiredPermissions {
+		for _, verb := range perm.Verbs {
+			var attributes = &authorizationv1.ResourceAttributes{
+				Group:       perm.Group,
+				Resource:    perm.Resource,
+				Subresource: perm.Subresource,
+				Verb:        verb,
+			}
+
+			if perm.Namespaced {
+				attributes.Namespace = namespace
+			}
+
+			allowed, err := c.isAllowed(ctx, attributes)
+			if err != nil {
+				report.add(name, CheckStatusFail, "can not review access: "+err.Error())
+
+				return
+			}
+
+			if !allowed {
+				var resource = perm.Resource
+				if perm.Subresource != "" {
+					resource += "/" + perm.Subresource
+				}
+
+				if perm.Group != "" {
+					resource += "." + perm.Group
+				}
+
+				if perm.Namespaced {
+					resource += " in " + namespace
+				}
+
+				denied = append(denied, verb+" "+resource)
+			}
+		}
+	}
+
+	if len(denied) != 0 {
+		report.add(name, CheckStatusFail, "operations are not allowed: "+strings.Join(denied, ", "))
+
+		return
+	}
+
+	report.add(name, CheckStatusOK, "all operations required by the operator are allowed")
+}
+
+// operatorNamespace - returns the Namespace whose Roles grant the namespaced permissions:
+// webhook.namespace of the configuration, the Namespace of --service-account or the current Pod's Namespace.
+func (c *checker) operatorNamespace() (string, error) {
+	if c.config.Webhook.Namespace == "" && c.serviceAccount != "" {
+		return strings.SplitN(c.serviceAccount, "/", 2)[0], nil
+	}
+
+	namespace, err := c.config.WebhookNamespace()
+	if err != nil {
+		return "", fmt.Errorf("%w, set it or --service-account", err)
+	}
+
+	return namespace, nil
+}
+
+// isAllowed - reviews access of the configured ServiceAccount or of the current user.
+func (c *checker) isAllowed(ctx context.Context, attributes *authorizationv1.ResourceAttributes) (bool, error) {
+	if c.serviceAccount == "" {
+		review, err := c.kubeClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+			&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attributes},
+			}, metav1.CreateOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		return review.Status.Allowed, nil
+	}
+
+	review, err := c.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx,
+		&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: attributes,
+				User:               "system:serviceaccount:" + strings.Replace(c.serviceAccount, "/", ":", 1),
+			},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			return false, fmt.Errorf("current user can not create SubjectAccessReviews: %w", err)
+		}
+
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// checkCABundle - checks that a CA bundle contains valid and not expired PEM certificates.
+func checkCABundle(caBundle []byte) error {
+	if len(caBundle) == 0 {
+		return errors.New("caBundle is empty")
+	}
+
+	var (
+		rest  = caBundle
+		count int
+		now   = time.Now()
+	)
+
+	for {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate %q is valid from %s to %s", cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+		}
+
+		count++
+	}
+
+	if count == 0 {
+		return errors.New("caBundle does not contain PEM certificates")
+	}
+
+	return nil
+}
+
+// hasReadyAddresses - checks if Endpoints have at least one ready address.
+func hasReadyAddresses(endpoints *corev1.Endpoints) bool {
+	for i := range endpoints.Subsets {
+		if len(endpoints.Subsets[i].Addresses) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialWebhook - opens a TLS connection to the webhook Service verifying its certificate with the CA bundle.
+func dialWebhook(service *admissionregistrationv1.ServiceReference, caBundle []byte) error {
+	var roots = x509.NewCertPool()
+	roots.AppendCertsFromPEM(caBundle)
+
+	var (
+		host = service.Name + "." + service.Namespace + ".svc"
+		port = int32(443)
+	)
+
+	if service.Port != nil {
+		port = *service.Port
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp",
+		net.JoinHostPort(host, fmt.Sprint(port)),
+		&tls.Config{RootCAs: roots, ServerName: host, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// printCheckReport - prints a human-readable table of the check results.
+func printCheckReport(w io.Writer, report *checkReport) error {
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+
+	for _, result := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Name, result.Status, result.Message)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if report.Success {
+		_, err := fmt.Fprintln(w, "\nAll checks passed")
+
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, "\nSome checks failed")
+
+	return err
+}
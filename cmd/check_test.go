@@ -0,0 +1,110 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// grantedRule - a resource and a verb granted by a role.
+type grantedRule struct {
+	resource   string
+	verb       string
+	namespaced bool
+}
+
+// loadGrantedRules - reads the rules of the roles in a manifest file.
+func loadGrantedRules(t *testing.T, file string) map[grantedRule]bool {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("can not read %s: %v", file, err)
+	}
+
+	var granted = map[grantedRule]bool{}
+
+	for _, doc := range strings.Split(string(data), "\n---\n") {
+		var role rbacv1.ClusterRole
+		if err = yaml.Unmarshal([]byte(doc), &role); err != nil {
+			t.Fatalf("can not parse %s: %v", file, err)
+		}
+
+		if role.Kind == "" {
+			continue
+		}
+
+		for _, rule := range role.Rules {
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					for _, verb := range rule.Verbs {
+						// The version of the kubebuilder marker which controller-gen puts into the verbs.
+						if strings.HasPrefix(verb, "versions=") {
+							continue
+						}
+
+						granted[grantedRule{
+							resource:   resource + "." + group,
+							verb:       verb,
+							namespaced: role.Kind == "Role",
+						}] = true
+					}
+				}
+			}
+		}
+	}
+
+	return granted
+}
+
+func TestRequiredPermissionsMatchRoles(t *testing.T) {
+	var granted = loadGrantedRules(t, "../config/rbac/role.yaml")
+
+	var leaderElection = loadGrantedRules(t, "../config/rbac/leader_election_role.yaml")
+
+	var required = map[grantedRule]bool{}
+
+	for _, perm := range requiredPermissions {
+		var resource = perm.Resource
+		if perm.Subresource != "" {
+			resource += "/" + perm.Subresource
+		}
+
+		for _, verb := range perm.Verbs {
+			var rule = grantedRule{resource: resource + "." + perm.Group, verb: verb, namespaced: perm.Namespaced}
+
+			required[rule] = true
+
+			if !granted[rule] && !leaderElection[rule] {
+				t.Errorf("%s %s (namespaced: %t) is checked but not granted by config/rbac",
+					verb, rule.resource, rule.namespaced)
+			}
+		}
+	}
+
+	for rule := range granted {
+		if !required[rule] {
+			t.Errorf("%s %s (namespaced: %t) is granted by the RBAC markers but not checked",
+				rule.verb, rule.resource, rule.namespaced)
+		}
+	}
+}
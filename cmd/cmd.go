@@ -0,0 +1,210 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd implements subcommands of the operator binary which are run
+// instead of the manager, for example, to render configuration offline.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+const (
+	// StdinPath - file path which means that an input is read from stdin.
+	StdinPath = "-"
+
+	OutputYAML = "yaml"
+	OutputJSON = "json"
+)
+
+// nolint:stylecheck // The error text starts from the name of the application, so capital letter.
+var (
+	ErrStdinUsedTwice     = errors.New("only one input can be read from stdin")
+	ErrUnsupportedOutput  = errors.New("unsupported output format")
+	ErrRequiredFlagNotSet = errors.New("required flag is not set")
+	ErrUnsupportedOffline = errors.New("not supported offline")
+)
+
+// command - a subcommand of the operator binary.
+type command struct {
+	Usage string
+	Run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// commands - registered subcommands by their names.
+var commands = map[string]command{
+	"render": {
+		Usage: "render a Multus NetworkAttachmentDefinition from AttachDefinition and Linkerd CNI ConfigMap manifests",
+		Run:   runRender,
+	},
+	"admit": {
+		Usage: "replay an AdmissionReview or a Pod through the pod webhook against manifests from files",
+		Run:   runAdmit,
+	},
+	"check": {
+		Usage: "verify that the cluster has everything the operator depends on",
+		Run:   runCheck,
+	},
+	"explain": {
+		Usage: "explain why the webhook attached or did not attach Linkerd CNI network to a Pod",
+		Run:   runExplain,
+	},
+	"rbac": {
+		Usage: "print Roles and RoleBindings for the namespace-scoped mode",
+		Run:   runRBAC,
+	},
+}
+
+// IsCommand - checks if the name is a registered subcommand.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+
+	return ok
+}
+
+// Run runs a subcommand by its name and returns the process exit code.
+func Run(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+
+		return 2
+	}
+
+	if err := cmd.Run(args, os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// newScheme - returns a scheme with all types which the operator works with.
+func newScheme() *runtime.Scheme {
+	var scheme = runtime.NewScheme()
+
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(cniv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(netattachv1.AddToScheme(scheme))
+
+	return scheme
+}
+
+// getRESTConfig - returns a REST config from a kubeconfig path or, if it is empty,
+// from the default locations and in-cluster configuration.
+func getRESTConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+
+	return ctrl.GetConfig()
+}
+
+// envOrDefault - returns a value of an environment variable or the default value if it is not set.
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// readInput - reads a file or stdin if the path is StdinPath.
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == StdinPath {
+		return io.ReadAll(stdin)
+	}
+
+	return os.ReadFile(path)
+}
+
+// decodeInput - reads a YAML or JSON manifest from a file or stdin into obj.
+func decodeInput(path string, stdin io.Reader, obj interface{}) error {
+	raw, err := readInput(path, stdin)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(raw, obj); err != nil {
+		return fmt.Errorf("can not decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// checkStdinUsage - returns an error if more than one of the paths is stdin.
+func checkStdinUsage(paths ...string) error {
+	var stdinCount int
+
+	for _, path := range paths {
+		if path == StdinPath {
+			stdinCount++
+		}
+	}
+
+	if stdinCount > 1 {
+		return ErrStdinUsedTwice
+	}
+
+	return nil
+}
+
+// printObject - prints an object in the requested format.
+func printObject(w io.Writer, obj interface{}, format string) error {
+	var (
+		out []byte
+		err error
+	)
+
+	switch format {
+	case OutputYAML:
+		out, err = yaml.Marshal(obj)
+	case OutputJSON:
+		out, err = json.MarshalIndent(obj, "", "  ")
+		out = append(out, '\n')
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedOutput, format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+
+	return err
+}
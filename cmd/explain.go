@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podwebhook "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+)
+
+// nolint:stylecheck // The error text starts from the name of the application, so capital letter.
+var ErrInvalidPodRef = errors.New("a Pod must be referenced as <namespace>/<name>")
+
+// runExplain - explains why the webhook attached or did not attach Linkerd CNI network to a Pod.
+func runExplain(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		flags = flag.NewFlagSet("explain", flag.ContinueOnError)
+
+		kubeconfig string
+		output     string
+		reconciler = &controllers.AttachDefinitionReconciler{}
+	)
+
+	flags.SetOutput(stderr)
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flags.StringVar(&reconciler.CNIConfigMapRef.Namespace, "cni-config-map-namespace",
+		envOrDefault(constants.EnvCNIConfigMapNamespace, constants.DefaultLinkerdCNICMNamespace),
+		"Namespace of the Linkerd CNI ConfigMap.")
+	flags.StringVar(&reconciler.CNIConfigMapRef.Name, "cni-config-map-name",
+		envOrDefault(constants.EnvCNIConfigMapName, constants.DefaultLinkerdCNICMName),
+		"Name of the Linkerd CNI ConfigMap.")
+	flags.StringVar(&reconciler.CNIConfigMapRef.Key, "cni-config-map-key",
+		envOrDefault(constants.EnvCNIConfigMapKey, constants.DefaultLinkerdCNICMKey),
+		"Key of the Linkerd CNI ConfigMap which contains CNI configuration.")
+	flags.StringVar(&reconciler.CNIKubeconfig, "cni-kubeconfig",
+		envOrDefault(constants.EnvCNIKubeconfig, constants.DefaultLinkerdCNIKubeconfigPath),
+		"Path to the Linkerd CNI kubeconfig on nodes.")
+	flags.StringVar(&reconciler.InstanceName, "instance-name",
+		envOrDefault(constants.EnvInstanceName, constants.DefaultInstanceName),
+		"Name of the operator instance whose decision is explained.")
+	flags.StringVar(&output, "o", OutputText, "Output format: text, yaml or json.")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var parts = strings.SplitN(flags.Arg(0), "/", 2)
+	if flags.NArg() != 1 || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ErrInvalidPodRef
+	}
+
+	restConfig, err := getRESTConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	apiClient, err := client.New(restConfig, client.Options{Scheme: newScheme()})
+	if err != nil {
+		return err
+	}
+
+	reconciler.Client = apiClient
+
+	var explainer = &podwebhook.Explainer{
+		Client:       apiClient,
+		InstanceName: reconciler.InstanceName,
+		Render:       reconciler.RenderMultusNetworkAttachDefinition,
+	}
+
+	explanation, err := explainer.Explain(context.Background(), client.ObjectKey{Namespace: parts[0], Name: parts[1]})
+	if err != nil {
+		return err
+	}
+
+	if output != OutputText {
+		return printObject(stdout, explanation, output)
+	}
+
+	return printExplanation(stdout, explanation)
+}
+
+// printExplanation - prints a human-readable explanation.
+func printExplanation(w io.Writer, explanation *podwebhook.Explanation) error {
+	fmt.Fprintf(w, "Pod: %s\n\n", explanation.Pod)
+
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "STEP\tRESULT\tDETAILS")
+
+	for _, step := range explanation.Steps {
+		fmt.Fprintf(tw, "%s\t%t\t%s\n", step.Name, step.Result, step.Message)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if explanation.AttachDefinition != nil {
+		fmt.Fprintf(w, "\nEffective AttachDefinition: %s/%s\n",
+			explanation.AttachDefinition.Namespace, explanation.AttachDefinition.Name)
+	}
+
+	if explanation.CurrentConfig != "" {
+		fmt.Fprintf(w, "\nNetworkAttachmentDefinition config:\n%s\n", explanation.CurrentConfig)
+	}
+
+	if explanation.RenderedConfig != "" {
+		fmt.Fprintf(w, "\nRendered config:\n%s\n", explanation.RenderedConfig)
+	}
+
+	for name, value := range explanation.ExpectedAnnotations {
+		fmt.Fprintf(w, "\nExpected annotation %s=%s", name, value)
+	}
+
+	if len(explanation.Mismatches) == 0 {
+		_, err := fmt.Fprintln(w, "\n\nNo mismatches found")
+
+		return err
+	}
+
+	fmt.Fprintln(w, "\n\nMismatches:")
+
+	for _, mismatch := range explanation.Mismatches {
+		fmt.Fprintf(w, "  - %s\n", mismatch)
+	}
+
+	return nil
+}
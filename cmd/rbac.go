@@ -0,0 +1,207 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+// ErrInvalidServiceAccountRef - the ServiceAccount reference is not in a form of namespace/name.
+var ErrInvalidServiceAccountRef = errors.New("a ServiceAccount must be referenced as <namespace>/<name>")
+
+// runRBAC - prints Roles and RoleBindings for the namespace-scoped mode of the operator
+// and a ClusterRole with a ClusterRoleBinding for the cluster-scoped AttachDefinitionPolicies.
+func runRBAC(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		flags = flag.NewFlagSet("rbac", flag.ContinueOnError)
+
+		name                string
+		namespaces          string
+		configMapNamespaces string
+		serviceAccount      string
+		output              string
+	)
+
+	flags.SetOutput(stderr)
+	flags.StringVar(&name, "name", "linkerd-cni-attach-operator", "Name of the generated Roles and RoleBindings.")
+	flags.StringVar(&namespaces, "namespaces", "",
+		"Comma separated list of Namespaces which the operator watches, see manager.watchNamespaces.")
+	flags.StringVar(&configMapNamespaces, "config-map-namespaces",
+		envOrDefault(constants.EnvCNIConfigMapNamespace, constants.DefaultLinkerdCNICMNamespace),
+		"Comma separated list of Namespaces of the Linkerd CNI and linkerd-config ConfigMaps.")
+	flags.StringVar(&serviceAccount, "service-account", "",
+		"Operator's ServiceAccount as namespace/name.")
+	flags.StringVar(&output, "o", OutputYAML, "Output format: yaml or json.")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if namespaces == "" || serviceAccount == "" {
+		return fmt.Errorf("%w: --namespaces and --service-account", ErrRequiredFlagNotSet)
+	}
+
+	var saRef = strings.SplitN(serviceAccount, "/", 2)
+	if len(saRef) != 2 || saRef[0] == "" || saRef[1] == "" {
+		return ErrInvalidServiceAccountRef
+	}
+
+	var (
+		subject = rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: saRef[0], Name: saRef[1]}
+		list    = &corev1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+		objects []runtime.Object
+	)
+
+	for _, namespace := range splitNamespaces(namespaces) {
+		objects = append(objects, newRole(name, namespace, watchedNamespaceRules()),
+			newRoleBinding(name, namespace, subject))
+	}
+
+	var configMapName = name + "-configmaps"
+
+	for _, namespace := range splitNamespaces(configMapNamespaces) {
+		objects = append(objects, newRole(configMapName, namespace, []rbacv1.PolicyRule{{
+			APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"},
+		}}), newRoleBinding(configMapName, namespace, subject))
+	}
+
+	var policyName = name + "-policies"
+
+	objects = append(objects, newClusterRole(policyName, []rbacv1.PolicyRule{{
+		APIGroups: []string{"cni.linkerd.io"}, Resources: []string{"attachdefinitionpolicies"},
+		Verbs: []string{"get", "list", "watch"},
+	}}), newClusterRoleBinding(policyName, subject))
+
+	var rolloutName = name + "-rollouts"
+
+	objects = append(objects, newClusterRole(rolloutName, []rbacv1.PolicyRule{{
+		APIGroups: []string{"cni.linkerd.io"}, Resources: []string{"cnirollouts"},
+		Verbs: []string{"get", "list", "watch"},
+	}, {
+		APIGroups: []string{"cni.linkerd.io"}, Resources: []string{"cnirollouts/status"},
+		Verbs: []string{"get", "update", "patch"},
+	}}), newClusterRoleBinding(rolloutName, subject))
+
+	for _, obj := range objects {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+
+		list.Items = append(list.Items, runtime.RawExtension{Raw: raw})
+	}
+
+	return printObject(stdout, list, output)
+}
+
+// watchedNamespaceRules - rules of a Role in a watched Namespace derived from requiredPermissions.
+// In the namespace-scoped mode Namespaces and ConfigMaps are not watched: the operator only reads
+// its watched Namespaces, which a Role in the Namespace permits, and ConfigMaps are read
+// from the Linkerd CNI and linkerd-config Namespaces. AttachDefinitionPolicies and CNIRollouts
+// are cluster-scoped and need ClusterRoles.
+func watchedNamespaceRules() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+
+	for _, perm := range requiredPermissions {
+		var (
+			resource = perm.Resource
+			verbs    = perm.Verbs
+		)
+
+		switch perm.Resource {
+		case "configmaps", "attachdefinitionpolicies", "cnirollouts":
+			continue
+		case "namespaces":
+			verbs = []string{"get"}
+		}
+
+		if perm.Subresource != "" {
+			resource += "/" + perm.Subresource
+		}
+
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{perm.Group},
+			Resources: []string{resource},
+			Verbs:     verbs,
+		})
+	}
+
+	return rules
+}
+
+func newRole(name, namespace string, rules []rbacv1.PolicyRule) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Rules:      rules,
+	}
+}
+
+func newRoleBinding(name, namespace string, subject rbacv1.Subject) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+		Subjects:   []rbacv1.Subject{subject},
+	}
+}
+
+func newClusterRole(name string, rules []rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      rules,
+	}
+}
+
+func newClusterRoleBinding(name string, subject rbacv1.Subject) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+		Subjects:   []rbacv1.Subject{subject},
+	}
+}
+
+// splitNamespaces - splits a comma separated list of Namespaces omitting empty and repeated elements.
+func splitNamespaces(list string) []string {
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+
+	for _, namespace := range strings.Split(list, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			result = append(result, namespace)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunRBAC(t *testing.T) {
+	var tests = []struct {
+		name string
+		args []string
+		// want - generated objects as "Kind namespace/name".
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "Roles",
+			args: []string{
+				"--namespaces", "app, web,app", "--config-map-namespaces", "linkerd-cni",
+				"--service-account", "linkerd-cni-attach-operator/operator",
+			},
+			want: []string{
+				"Role app/operator", "RoleBinding app/operator",
+				"Role web/operator", "RoleBinding web/operator",
+				"Role linkerd-cni/operator-configmaps", "RoleBinding linkerd-cni/operator-configmaps",
+				"ClusterRole /operator-policies", "ClusterRoleBinding /operator-policies",
+				"ClusterRole /operator-rollouts", "ClusterRoleBinding /operator-rollouts",
+			},
+		},
+		{
+			name:    "missing Namespaces",
+			args:    []string{"--service-account", "linkerd-cni-attach-operator/operator"},
+			wantErr: ErrRequiredFlagNotSet,
+		},
+		{
+			name:    "invalid ServiceAccount",
+			args:    []string{"--namespaces", "app", "--service-account", "operator"},
+			wantErr: ErrInvalidServiceAccountRef,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			err := runRBAC(append([]string{"--name", "operator", "-o", "json"}, tt.args...),
+				strings.NewReader(""), &stdout, &stderr)
+			if tt.wantErr != nil || err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("runRBAC() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			var list = &corev1.List{}
+			if err := json.Unmarshal(stdout.Bytes(), list); err != nil {
+				t.Fatalf("can not decode the List %q: %v", stdout.String(), err)
+			}
+
+			var got []string
+
+			for _, item := range list.Items {
+				var obj = &metav1.PartialObjectMetadata{}
+				if err := json.Unmarshal(item.Raw, obj); err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, obj.Kind+" "+obj.Namespace+"/"+obj.Name)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchedNamespaceRules(t *testing.T) {
+	for _, rule := range watchedNamespaceRules() {
+		switch rule.Resources[0] {
+		case "configmaps":
+			t.Error("ConfigMaps are read from the Linkerd CNI Namespaces, not the watched ones")
+		case "namespaces":
+			if !reflect.DeepEqual(rule.Verbs, []string{"get"}) {
+				t.Errorf("Namespace verbs = %q, want get", rule.Verbs)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// runRender - prints the Multus NetworkAttachmentDefinition which the operator would
+// generate for an AttachDefinition and a Linkerd CNI ConfigMap read from files or stdin.
+// nolint:funlen // flags parsing and loading of optional manifests.
+func runRender(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var (
+		flags = flag.NewFlagSet("render", flag.ContinueOnError)
+
+		attachPath        string
+		configMapPath     string
+		linkerdConfigPath string
+		namespace         string
+		output            string
+	)
+
+	flags.SetOutput(stderr)
+
+	var configFlags = operatorconfig.BindFlags(flags)
+
+	flags.StringVar(&attachPath, "attach-definition", "",
+		"Path to an AttachDefinition manifest, \"-\" to read from stdin.")
+	flags.StringVar(&configMapPath, "cni-config-map", "",
+		"Path to a Linkerd CNI ConfigMap manifest, \"-\" to read from stdin.")
+	flags.StringVar(&linkerdConfigPath, "linkerd-config", "",
+		"Path to the linkerd-config ConfigMap manifest, required if the operator configuration sets linkerdConfig.")
+	flags.StringVar(&namespace, "namespace", "",
+		"Namespace of the AttachDefinition, overrides metadata.namespace of the manifest.")
+	flags.StringVar(&output, "o", OutputYAML, "Output format: yaml or json.")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if attachPath == "" || configMapPath == "" {
+		return fmt.Errorf("%w: --attach-definition and --cni-config-map", ErrRequiredFlagNotSet)
+	}
+
+	if err := checkStdinUsage(attachPath, configMapPath, linkerdConfigPath); err != nil {
+		return err
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+
+	// The API server defaults createMultusNetworkAttachmentDefinition to true if it is not set.
+	var ldAttach = &cniv1alpha1.AttachDefinition{
+		Spec: cniv1alpha1.AttachDefinitionSpec{CreateMultusNetworkAttachmentDefinition: true},
+	}
+
+	if err = decodeInput(attachPath, stdin, ldAttach); err != nil {
+		return err
+	}
+
+	if namespace != "" {
+		ldAttach.Namespace = namespace
+	}
+
+	var cniConfigMap = &corev1.ConfigMap{}
+
+	if err = decodeInput(configMapPath, stdin, cniConfigMap); err != nil {
+		return err
+	}
+
+	var linkerdConfigMap *corev1.ConfigMap
+
+	if linkerdConfigPath != "" {
+		linkerdConfigMap = &corev1.ConfigMap{}
+
+		if err = decodeInput(linkerdConfigPath, stdin, linkerdConfigMap); err != nil {
+			return err
+		}
+	}
+
+	if !ldAttach.Spec.CreateMultusNetworkAttachmentDefinition {
+		fmt.Fprintln(stderr,
+			"createMultusNetworkAttachmentDefinition is false, the operator deletes the NetworkAttachmentDefinition")
+
+		return nil
+	}
+
+	multusNetAttach, err := renderOffline(config, ldAttach, cniConfigMap, linkerdConfigMap)
+	if err != nil {
+		return err
+	}
+
+	return printObject(stdout, multusNetAttach, output)
+}
+
+// renderOffline - renders the NetworkAttachmentDefinition with the AttachDefinitionReconciler against
+// an in-memory client populated with the provided manifests, so the configuration is layered as the operator
+// does it. The Linkerd CNI ConfigMap is used as the operator's one or, if the AttachDefinition sets
+// spec.cniSource.configMap, as that ConfigMap. The linkerd-config ConfigMap is required if the operator
+// configuration uses it. Skipped Services can not be resolved without a cluster and are rejected.
+func renderOffline(operatorConfig *operatorconfig.Config, ldAttach *cniv1alpha1.AttachDefinition,
+	cniConfigMap, linkerdConfigMap *corev1.ConfigMap) (*netattachv1.NetworkAttachmentDefinition, error) {
+	if ldAttach.Spec.RollbackTo == nil && len(ldAttach.Spec.Config.SkipOutboundServices) != 0 {
+		return nil, fmt.Errorf("spec.proxyConfig.skipOutboundServices: Services can not be resolved: %w",
+			ErrUnsupportedOffline)
+	}
+
+	// The inputs are not modified.
+	var cfg = *operatorConfig
+
+	var manifestResourceVersion = cniConfigMap.ResourceVersion
+
+	cniConfigMap = cniConfigMap.DeepCopy()
+
+	var objects = []client.Object{cniConfigMap}
+
+	if source := ldAttach.Spec.CNISource; source != nil && source.ConfigMap != nil {
+		if cniConfigMap.Namespace == "" && cniConfigMap.Name == "" {
+			cniConfigMap.Namespace, cniConfigMap.Name = source.ConfigMap.Namespace, source.ConfigMap.Name
+		}
+
+		if cniConfigMap.Namespace != source.ConfigMap.Namespace || cniConfigMap.Name != source.ConfigMap.Name {
+			return nil, fmt.Errorf("spec.cniSource.configMap references ConfigMap %s/%s, the Linkerd CNI ConfigMap is %s",
+				source.ConfigMap.Namespace, source.ConfigMap.Name, client.ObjectKeyFromObject(cniConfigMap))
+		}
+	} else {
+		if cniConfigMap.Namespace == "" && cniConfigMap.Name == "" {
+			cniConfigMap.Namespace, cniConfigMap.Name = cfg.CNIConfigMap.Namespace, cfg.CNIConfigMap.Name
+		}
+
+		// The provided ConfigMap is the operator's one whatever its name is.
+		cfg.CNIConfigMap.Namespace, cfg.CNIConfigMap.Name = cniConfigMap.Namespace, cniConfigMap.Name
+	}
+
+	if ref := cfg.LinkerdConfig; ref != nil {
+		if linkerdConfigMap == nil {
+			return nil, fmt.Errorf("%w: --linkerd-config as the operator configuration sets linkerdConfig",
+				ErrRequiredFlagNotSet)
+		}
+
+		linkerdConfigMap = linkerdConfigMap.DeepCopy()
+		linkerdConfigMap.Namespace, linkerdConfigMap.Name = ref.Namespace, ref.Name
+
+		objects = append(objects, linkerdConfigMap)
+	}
+
+	var reconciler = &controllers.AttachDefinitionReconciler{
+		Client:       fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(objects...).Build(),
+		Scheme:       newScheme(),
+		InstanceName: cfg.InstanceName,
+		Config:       operatorconfig.NewStore(&cfg, "", nil),
+	}
+
+	multusNetAttach, err := reconciler.RenderMultusNetworkAttachDefinition(context.Background(), ldAttach)
+	if err != nil {
+		return nil, err
+	}
+
+	// The in-memory client assigns a resourceVersion to the ConfigMap, the manifest's one is reported.
+	if ldAttach.Spec.RollbackTo == nil {
+		multusNetAttach.Annotations[constants.CNIConfigMapResourceVersionAnnotation] = manifestResourceVersion
+	}
+
+	return multusNetAttach, nil
+}
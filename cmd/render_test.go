@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+const (
+	exampleAttachDefinition = "../examples/linkerd-attach.yaml"
+	exampleCNIConfigMap     = "../examples/linkerd-cni-example-config-map.yaml"
+)
+
+func TestRunRender(t *testing.T) {
+	var tests = []struct {
+		name  string
+		args  []string
+		stdin string
+		// wantProxyUID - proxy UID of the rendered NetworkAttachmentDefinition, nothing is rendered if 0.
+		wantProxyUID int
+		wantStderr   string
+		wantErr      error
+	}{
+		{
+			name:         "files",
+			args:         []string{"--attach-definition", exampleAttachDefinition, "--cni-config-map", exampleCNIConfigMap},
+			wantProxyUID: 1000681000,
+		},
+		{
+			name:         "AttachDefinition from stdin",
+			args:         []string{"--attach-definition", StdinPath, "--cni-config-map", exampleCNIConfigMap},
+			stdin:        "metadata:\n  name: linkerd-cni\nspec:\n  proxyConfig:\n    proxyUID: 2102\n",
+			wantProxyUID: 2102,
+		},
+		{
+			name:       "NetworkAttachmentDefinition is not requested",
+			args:       []string{"--attach-definition", StdinPath, "--cni-config-map", exampleCNIConfigMap},
+			stdin:      "metadata:\n  name: linkerd-cni\nspec:\n  createMultusNetworkAttachmentDefinition: false\n",
+			wantStderr: "createMultusNetworkAttachmentDefinition is false",
+		},
+		{
+			name:    "missing ConfigMap",
+			args:    []string{"--attach-definition", exampleAttachDefinition},
+			wantErr: ErrRequiredFlagNotSet,
+		},
+		{
+			name:    "stdin is used twice",
+			args:    []string{"--attach-definition", StdinPath, "--cni-config-map", StdinPath},
+			wantErr: ErrStdinUsedTwice,
+		},
+		{
+			name: "unsupported output",
+			args: []string{
+				"--attach-definition", exampleAttachDefinition, "--cni-config-map", exampleCNIConfigMap, "-o", "toml",
+			},
+			wantErr: ErrUnsupportedOutput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			err := runRender(append([]string{"--namespace", "app", "-o", "json"}, tt.args...),
+				strings.NewReader(tt.stdin), &stdout, &stderr)
+			if tt.wantErr != nil || err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("runRender() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+
+			if tt.wantProxyUID == 0 {
+				if stdout.Len() != 0 {
+					t.Errorf("stdout = %q, want nothing", stdout.String())
+				}
+
+				return
+			}
+
+			var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{}
+			if err := json.Unmarshal(stdout.Bytes(), multusNetAttach); err != nil {
+				t.Fatalf("can not decode the rendered NetworkAttachmentDefinition: %v", err)
+			}
+
+			if multusNetAttach.Namespace != "app" || multusNetAttach.Name != constants.LinkerdCNINetworkAttachmentDefinitionName {
+				t.Errorf("NetworkAttachmentDefinition %s/%s, want app/%s",
+					multusNetAttach.Namespace, multusNetAttach.Name, constants.LinkerdCNINetworkAttachmentDefinitionName)
+			}
+
+			var cniConfig = &controllers.CNIPluginConf{}
+			if err := json.Unmarshal([]byte(multusNetAttach.Spec.Config), cniConfig); err != nil {
+				t.Fatalf("can not decode the CNI configuration: %v", err)
+			}
+
+			if cniConfig.Linkerd.ProxyUID != tt.wantProxyUID {
+				t.Errorf("proxy UID = %d, want %d", cniConfig.Linkerd.ProxyUID, tt.wantProxyUID)
+			}
+
+			if cniConfig.Kubernetes.Kubeconfig != constants.DefaultLinkerdCNIKubeconfigPath {
+				t.Errorf("kubeconfig = %q, want %q", cniConfig.Kubernetes.Kubeconfig, constants.DefaultLinkerdCNIKubeconfigPath)
+			}
+		})
+	}
+}
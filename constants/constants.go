@@ -9,11 +9,97 @@ const (
 
 	LinkerdInjectAnnotation = "linkerd.io/inject"
 
+	LinkerdInjectEnabled  = "enabled"
+	LinkerdInjectIngress  = "ingress"
+	LinkerdInjectDisabled = "disabled"
+
+	LinkerdProxyContainerName = "linkerd-proxy"
+
 	LinkerdProxyUIDAnnotation = "config.linkerd.io/proxy-uid"
+
+	// Per-Pod Linkerd proxy configuration annotations which are passed to Linkerd CNI as cni-args.
+	LinkerdInboundPortAnnotation       = "config.linkerd.io/inbound-port"
+	LinkerdOutboundPortAnnotation      = "config.linkerd.io/outbound-port"
+	LinkerdSkipInboundPortsAnnotation  = "config.linkerd.io/skip-inbound-ports"
+	LinkerdSkipOutboundPortsAnnotation = "config.linkerd.io/skip-outbound-ports"
+	LinkerdSkipSubnetsAnnotation       = "config.linkerd.io/skip-subnets"
 )
 
 const (
 	MultusNetworkAttachmentDefinitionAPIVersion   = "k8s.cni.cncf.io/v1"
 	MultusNetworkAttachmentDefinitionResourceKind = "NetworkAttachmentDefinition"
 	MultusNetworkAttachAnnotation                 = "k8s.v1.cni.cncf.io/networks"
+	MultusNetworkStatusAnnotation                 = "k8s.v1.cni.cncf.io/network-status"
+)
+
+// Provenance annotations of the NetworkAttachmentDefinitions generated by the operator.
+const (
+	OperatorVersionAnnotation             = "cni.linkerd.io/operator-version"
+	AttachDefinitionGenerationAnnotation  = "cni.linkerd.io/attach-definition-generation"
+	CNIConfigMapAnnotation                = "cni.linkerd.io/cni-config-map"
+	CNIConfigMapResourceVersionAnnotation = "cni.linkerd.io/cni-config-map-resource-version"
+	// ConfigHashAnnotation - SHA-256 of the generated CNI configuration, a different hash of the current
+	// configuration means that it was modified outside of the operator.
+	ConfigHashAnnotation = "cni.linkerd.io/config-hash"
+)
+
+// OperatorVersion - version of the operator binary, set at build time with
+// -ldflags "-X github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants.OperatorVersion=<version>".
+var OperatorVersion = "dev"
+
+const (
+	EnvVarPrefix = "LINKERD_CNI_ATTACH_OPERATOR_"
+
+	EnvInstanceName          = EnvVarPrefix + "INSTANCE"
+	EnvCNIConfigMapNamespace = EnvVarPrefix + "CNI_CM_NAMESPACE"
+	EnvCNIConfigMapName      = EnvVarPrefix + "CNI_CM_NAME"
+	EnvCNIConfigMapKey       = EnvVarPrefix + "CNI_CM_KEY"
+	EnvCNIKubeconfig         = EnvVarPrefix + "KUBECONFIG"
+)
+
+const (
+	DefaultInstanceName = "default"
+
+	// InstanceLabel - label which assigns Namespaces, AttachDefinitions and NetworkAttachmentDefinitions
+	// to an operator instance. Unlabelled objects belong to their Namespace's instance,
+	// unlabelled Namespaces belong to the default instance.
+	InstanceLabel = "cni.linkerd.io/instance"
+
+	// LeaderElectionID - leader election lock name of the default operator instance.
+	LeaderElectionID = "cni-attach-operator.linkerd.io"
+
+	// LastKnownGoodSecretName - Secret of the default operator instance which stores the last successfully
+	// parsed configuration of every Linkerd CNI source.
+	LastKnownGoodSecretName = "linkerd-multus-operator-cni-last-known-good"
+
+	DefaultLinkerdCNICMNamespace = "linkerd-cni"
+	DefaultLinkerdCNICMName      = "linkerd-cni-config"
+	DefaultLinkerdCNICMKey       = "cni_network_config"
+
+	// Linkerd control plane ConfigMap with the installation Helm values.
+	DefaultLinkerdConfigNamespace = "linkerd"
+	DefaultLinkerdConfigName      = "linkerd-config"
+	DefaultLinkerdConfigKey       = "values"
+
+	// DefaultLinkerdCNIKubeconfigName - used the name which is created by
+	// Linkerd-CNI DaemonSet.
+	DefaultLinkerdCNIKubeconfigPath = "/etc/cni/net.d/ZZZ-linkerd-cni-kubeconfig"
+
+	// LinkerdCNIKubeconfigFileName - name of the kubeconfig file which Linkerd-CNI DaemonSet
+	// writes to the CNI network configuration directory.
+	LinkerdCNIKubeconfigFileName = "ZZZ-linkerd-cni-kubeconfig"
+	// LinkerdCNINetDirKey - key of Linkerd CNI ConfigMap with the CNI network configuration directory.
+	LinkerdCNINetDirKey = "dest_cni_net_dir"
+)
+
+const (
+	// PodWebhookName - name of the pod mutating webhook in MutatingWebhookConfiguration.
+	PodWebhookName = "attachdefinition.cni.linkerd.io"
+	// PodWebhookPath - path of the pod mutating webhook on the webhook server.
+	PodWebhookPath = "/annotate-v1-pod"
+	// AttachDefinitionPolicyWebhookName - name of the AttachDefinition validating webhook
+	// in ValidatingWebhookConfiguration.
+	AttachDefinitionPolicyWebhookName = "policy.attachdefinition.cni.linkerd.io"
+	// AttachDefinitionPolicyWebhookPath - path of the AttachDefinition validating webhook on the webhook server.
+	AttachDefinitionPolicyWebhookPath = "/validate-cni-linkerd-io-v1alpha1-attachdefinition"
 )
@@ -20,24 +20,55 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"errors"
 
 	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
 	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/metrics"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/policy"
 	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 )
 
 // nolint:stylecheck // The error text starts from the name of the application, so capital letter.
 var ErrCNIConfigMapKeyNotFound = errors.New("Linkerd CNI ConfigMap does not contain required key")
 
+// Reasons of Events recorded on AttachDefinitions.
+const (
+	EventReasonNetworkAttachmentDefinitionCreated  = "NetworkAttachmentDefinitionCreated"
+	EventReasonNetworkAttachmentDefinitionUpdated  = "NetworkAttachmentDefinitionUpdated"
+	EventReasonNetworkAttachmentDefinitionDeleted  = "NetworkAttachmentDefinitionDeleted"
+	EventReasonNetworkAttachmentDefinitionConflict = "NetworkAttachmentDefinitionConflict"
+	EventReasonCNISourceNotAllowed                 = "CNISourceNotAllowed"
+	EventReasonCNISourceUnreadable                 = "CNISourceUnreadable"
+	EventReasonPolicyViolation                     = "PolicyViolation"
+	EventReasonCNISourceDegraded                   = "CNISourceDegraded"
+	EventReasonNetworkAttachmentDefinitionTampered = "NetworkAttachmentDefinitionTampered"
+)
+
+// ErrCNISourceNotAllowed - an AttachDefinition references a CNI source which is not allowed by the operator configuration.
+var ErrCNISourceNotAllowed = errors.New("CNI source is not allowed by the operator configuration")
+
 // AttachDefinitionReconciler reconciles a AttachDefinition object
 type AttachDefinitionReconciler struct {
 	client.Client
@@ -45,6 +76,25 @@ type AttachDefinitionReconciler struct {
 	InstanceName    string
 	CNIKubeconfig   string
 	CNIConfigMapRef CNIConfigMapRef
+	// Recorder - if set, actions of the reconciler are recorded as Events on AttachDefinitions.
+	Recorder record.EventRecorder
+	// Config - if set, the CNI ConfigMap reference, the kubeconfig path, exclusions and
+	// defaults are taken from the current operator configuration instead of the fields above.
+	Config *operatorconfig.Store
+	// LastKnownGood - if set, the last successfully parsed configuration of every CNI source is stored
+	// and NetworkAttachmentDefinitions are rendered from it while the source is invalid.
+	LastKnownGood *LastKnownGood
+}
+
+// cniSourceStatus - how the Linkerd CNI configuration was loaded.
+type cniSourceStatus struct {
+	// Disagreements - proxy settings which differ between Linkerd CNI and linkerd-config.
+	Disagreements []string
+	// Degraded - if set, the CNI source is invalid and the configuration is loaded from its
+	// last known good ConfigMap.
+	Degraded error
+	// ConfigMap - the Linkerd CNI ConfigMap which the configuration is loaded from.
+	ConfigMap *corev1.ConfigMap
 }
 
 type CNIConfigMapRef struct {
@@ -75,88 +125,281 @@ func (r *AttachDefinitionReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
 	}
 
+	namespaceInstance, err := getNamespaceInstance(ctx, r.Client, req.Namespace)
+	if err != nil {
+		logger.Error(err, "can not get Namespace")
+
+		return ctrl.Result{}, err
+	}
+
 	var linkerdAttach = &cniv1alpha1.AttachDefinition{}
 
-	if err := r.Get(ctx, req.NamespacedName, linkerdAttach); err != nil {
+	if err = r.Get(ctx, req.NamespacedName, linkerdAttach); err != nil {
 		// Delete dependent resources - Multus NetworkAttachmentDefinition.
 		if apierrors.IsNotFound(err) {
-			return ctrl.Result{}, r.deleteMultusNetAttach(ctx, multusRef)
+			// The AttachDefinition is gone, so the Event is recorded on its Namespace.
+			return ctrl.Result{}, r.deleteMultusNetAttach(ctx, multusRef, namespaceInstance,
+				"attach-definition-deleted", NamespaceReference(req.Namespace))
 		}
 
 		return ctrl.Result{}, err
 	}
 
+	if instance := InstanceOf(linkerdAttach.Labels, namespaceInstance); !IsInstance(instance, r.InstanceName) {
+		logger.Info("AttachDefinition belongs to another operator instance, skip", "instance", instance)
+
+		return ctrl.Result{}, nil
+	}
+
+	if r.Config != nil && r.Config.Get().IsNamespaceExcluded(req.Namespace) {
+		logger.Info("Namespace is excluded by the operator configuration, skip")
+
+		return ctrl.Result{}, nil
+	}
+
 	// Multus NetworkAttachmentDefinition is not requested - delete.
 	if !linkerdAttach.Spec.CreateMultusNetworkAttachmentDefinition {
 		logger.Info("createMultusNetworkAttachmentDefinition is false, delete NetworkAttachmentDefinition")
 
-		return ctrl.Result{}, r.deleteMultusNetAttach(ctx, multusRef)
+		return ctrl.Result{}, r.deleteMultusNetAttach(ctx, multusRef, namespaceInstance, "not-requested", linkerdAttach)
 	}
 
 	// Create/Update Multus NetworkAttachmentDefinition.
 
-	// Load CNI Plugin configuration from a Linkerd CNI plugin ConfigMap.
-	cniConfigDefault, err := r.getLinkerdCNIConfig(ctx)
+	// A pinned revision which complies with AttachDefinitionPolicies is applied as is,
+	// the current configuration is not rendered.
+	if linkerdAttach.Spec.RollbackTo != nil {
+		return ctrl.Result{}, r.rollback(ctx, linkerdAttach, namespaceInstance)
+	}
+
+	// Specs which violate AttachDefinitionPolicies are not rendered, the current NetworkAttachmentDefinition is kept.
+	violations, err := policy.Check(ctx, r.Client, req.Namespace, &linkerdAttach.Spec)
 	if err != nil {
+		logger.Error(err, "can not check AttachDefinitionPolicies")
+
 		return ctrl.Result{}, err
 	}
 
-	// Merge Linkerd CNI ConfigMap and linkerdAttach before further steps.
-	var cniConfig = applyAttachDefinition(cniConfigDefault, linkerdAttach)
+	if len(violations) != 0 {
+		var message = violations.ToAggregate().Error()
 
-	var currentMultusNetAttach = &netattachv1.NetworkAttachmentDefinition{}
+		logger.Info("AttachDefinition violates AttachDefinitionPolicies, skip", "violations", message)
+		RecordEvent(r.Recorder, linkerdAttach, corev1.EventTypeWarning, EventReasonPolicyViolation,
+			"NetworkAttachmentDefinition %s is not rendered: %s", multusRef, message)
 
-	if err = r.Get(ctx, multusRef, currentMultusNetAttach); err != nil {
-		if apierrors.IsNotFound(err) {
-			// Create.
-			return ctrl.Result{}, r.createMultusNetAttach(ctx, multusRef, cniConfig)
-		}
+		// The AttachDefinition is reconciled again when a policy changes.
+		return ctrl.Result{}, r.updateConditions(ctx, linkerdAttach, []metav1.Condition{{
+			Type:    cniv1alpha1.ConditionPolicyCompliant,
+			Status:  metav1.ConditionFalse,
+			Reason:  "PolicyViolation",
+			Message: message,
+		}})
+	}
 
-		return ctrl.Result{}, err
+	var policyCondition = metav1.Condition{
+		Type:    cniv1alpha1.ConditionPolicyCompliant,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Compliant",
+		Message: "AttachDefinition complies with AttachDefinitionPolicies",
+	}
+
+	// Load CNI Plugin configuration from a Linkerd CNI plugin ConfigMap.
+	cniConfigDefault, source, err := r.getLinkerdCNIConfig(ctx, linkerdAttach)
+	if errors.Is(err, ErrCNISourceNotAllowed) {
+		logger.Error(err, "AttachDefinition references a CNI source which is not allowed")
+		RecordEvent(r.Recorder, linkerdAttach, corev1.EventTypeWarning, EventReasonCNISourceNotAllowed, "%v", err)
+
+		// The AttachDefinition is reconciled again when the operator configuration changes.
+		return ctrl.Result{}, r.updateConditions(ctx, linkerdAttach, []metav1.Condition{{
+			Type:    cniv1alpha1.ConditionCNISourceAllowed,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotAllowed",
+			Message: err.Error(),
+		}, policyCondition})
 	}
 
-	// Update.
-	// Prepare required state.
-	requiredMultusNetAttach, err := newMultusNetworkAttachDefinition(multusRef, cniConfig)
 	if err != nil {
-		logger.Error(err, "can not create expected NetworkAttachmentDefinition")
+		RecordEvent(r.Recorder, linkerdAttach, corev1.EventTypeWarning, EventReasonCNISourceUnreadable,
+			"can not load Linkerd CNI configuration: %v", err)
+
+		// The current NetworkAttachmentDefinition is kept until the source is fixed.
+		if isCNISourceInvalid(err) {
+			if statusErr := r.updateConditions(ctx, linkerdAttach, []metav1.Condition{{
+				Type:    cniv1alpha1.ConditionDegraded,
+				Status:  metav1.ConditionTrue,
+				Reason:  "SourceInvalid",
+				Message: "Linkerd CNI source is invalid and has no last known good configuration: " + err.Error(),
+			}}); statusErr != nil {
+				logger.Error(statusErr, "can not report the invalid CNI source")
+			}
+		}
 
 		return ctrl.Result{}, err
 	}
 
-	// Not very good comparison but will go for prototype.
-	// ToDo: write a better comparison, maybe via json.Unmarshal.
-	if currentMultusNetAttach.Spec.Config == requiredMultusNetAttach.Spec.Config {
-		logger.Info("Current and required configurations are equal, nothing to do")
+	var result ctrl.Result
 
-		return ctrl.Result{}, nil
+	if source.Degraded != nil {
+		logger.Info("Linkerd CNI source is invalid, render the last known good configuration",
+			"resourceVersion", source.ConfigMap.ResourceVersion, "error", source.Degraded.Error())
+		RecordEvent(r.Recorder, linkerdAttach, corev1.EventTypeWarning, EventReasonCNISourceDegraded,
+			"Linkerd CNI source is invalid, the last known good configuration of resourceVersion %s is used: %v",
+			source.ConfigMap.ResourceVersion, source.Degraded)
+
+		result.RequeueAfter = lastKnownGoodRequeueInterval
 	}
 
-	currentMultusNetAttach.Spec.Config = requiredMultusNetAttach.Spec.Config
+	var conditions = []metav1.Condition{{
+		Type:    cniv1alpha1.ConditionCNISourceAllowed,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Allowed",
+		Message: "CNI source is allowed",
+	}, policyCondition, newDegradedCondition(source)}
 
-	logger.Info("Updating Multus NetworkAttachmentDefinition")
+	var removed = []string{cniv1alpha1.ConditionRolledBack}
 
-	if err := r.Update(ctx, currentMultusNetAttach); err != nil {
-		logger.Error(err, "can not update NetworkAttachmentDefinition")
+	if r.linkerdConfigRef() != nil {
+		conditions = append(conditions, newDefaultsConsistentCondition(source.Disagreements))
+	} else {
+		removed = append(removed, cniv1alpha1.ConditionDefaultsConsistent)
+	}
+
+	// Unresolved Services are not skipped, the rest of the configuration is still rendered.
+	services, err := r.resolveSkippedServices(ctx, linkerdAttach)
+	if err != nil {
+		logger.Error(err, "can not resolve skipped Services")
 
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	if len(linkerdAttach.Spec.Config.SkipOutboundServices) != 0 {
+		conditions = append(conditions, newServicesResolvedCondition(services))
+	} else {
+		removed = append(removed, cniv1alpha1.ConditionServicesResolved)
+	}
+
+	if err = r.updateConditions(ctx, linkerdAttach, conditions, removed...); err != nil {
+		return result, err
+	}
+
+	// Merge Linkerd CNI ConfigMap and linkerdAttach before further steps.
+	requiredMultusNetAttach, err := renderMultusNetAttach(linkerdAttach, cniConfigDefault, services,
+		NewProvenance(linkerdAttach, source.ConfigMap))
+	if err != nil {
+		logger.Error(err, "can not create expected NetworkAttachmentDefinition")
+
+		return result, err
+	}
+
+	return result, r.ensureMultusNetAttach(ctx, linkerdAttach, namespaceInstance, requiredMultusNetAttach, "")
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AttachDefinitionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// The name filter applies only to AttachDefinitions, policies have arbitrary names.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&cniv1alpha1.AttachDefinition{}).
+		For(&cniv1alpha1.AttachDefinition{}, builder.WithPredicates(getEventFilter())).
+		Watches(&source.Kind{Type: &cniv1alpha1.AttachDefinitionPolicy{}},
+			handler.EnqueueRequestsFromMapFunc(r.attachDefinitionRequests)).
+		Watches(&source.Kind{Type: &cniv1alpha1.CNIRollout{}},
+			handler.EnqueueRequestsFromMapFunc(r.attachDefinitionRequests)).
+		Watches(&source.Kind{Type: &corev1.Service{}},
+			handler.EnqueueRequestsFromMapFunc(r.serviceAttachDefinitionRequests)).
+		Watches(&source.Kind{Type: &corev1.Endpoints{}},
+			handler.EnqueueRequestsFromMapFunc(r.serviceAttachDefinitionRequests)).
 		Named("AttachDefinitionReconciler").
-		WithEventFilter(getEventFilter()).
 		Complete(r)
 }
 
-// deleteMultusNetAttach - deletes a Multus NetworkAttachmentDefinition.
-func (r *AttachDefinitionReconciler) deleteMultusNetAttach(
-	ctx context.Context, multusRef client.ObjectKey) error {
+// ReconcileAll - reconciles every AttachDefinition, for example, after the operator configuration is changed.
+func (r *AttachDefinitionReconciler) ReconcileAll(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := r.List(ctx, attachDefinitions); err != nil {
+		logger.Error(err, "can not list AttachDefinitions")
+
+		return err
+	}
+
+	var errs []error
+
+	for i := range attachDefinitions.Items {
+		// Like the event filter, only AttachDefinitions named after the NetworkAttachmentDefinition are handled.
+		if attachDefinitions.Items[i].Name != constants.LinkerdCNINetworkAttachmentDefinitionName {
+			continue
+		}
+
+		var req = ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&attachDefinitions.Items[i])}
+
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// attachDefinitionRequests - maps an AttachDefinitionPolicy or a CNIRollout to all AttachDefinitions,
+// the policy may select any Namespace and the rollout may assign a configuration to any Namespace.
+func (r *AttachDefinitionReconciler) attachDefinitionRequests(obj client.Object) []reconcile.Request {
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := r.List(context.Background(), attachDefinitions); err != nil {
+		log.Log.Error(err, "can not list AttachDefinitions", "name", obj.GetName())
+
+		return nil
+	}
+
+	var requests = make([]reconcile.Request, 0, len(attachDefinitions.Items))
+
+	for i := range attachDefinitions.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&attachDefinitions.Items[i]),
+		})
+	}
+
+	return requests
+}
+
+// serviceAttachDefinitionRequests - maps a Service or its Endpoints to the AttachDefinitions which skip the Service.
+func (r *AttachDefinitionReconciler) serviceAttachDefinitionRequests(obj client.Object) []reconcile.Request {
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := r.List(context.Background(), attachDefinitions); err != nil {
+		log.Log.Error(err, "can not list AttachDefinitions", "Service", client.ObjectKeyFromObject(obj))
+
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for i := range attachDefinitions.Items {
+		if referencesService(&attachDefinitions.Items[i], client.ObjectKeyFromObject(obj)) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(&attachDefinitions.Items[i]),
+			})
+		}
+	}
+
+	return requests
+}
+
+// instanceName - returns the operator instance name, empty name means the default instance.
+func (r *AttachDefinitionReconciler) instanceName() string {
+	if r.InstanceName == "" {
+		return constants.DefaultInstanceName
+	}
+
+	return r.InstanceName
+}
+
+// deleteMultusNetAttach - deletes a Multus NetworkAttachmentDefinition
+// unless it belongs to another operator instance. The reason is reported in metrics
+// and in an Event recorded on the eventObject.
+func (r *AttachDefinitionReconciler) deleteMultusNetAttach(ctx context.Context, multusRef client.ObjectKey,
+	namespaceInstance, reason string, eventObject runtime.Object) error {
 	logger := log.FromContext(ctx).WithValues(
 		"k8s.cni.cncf.io/v1/NetworkAttachmentDefinition",
 		multusRef.Namespace+"/"+multusRef.Name)
@@ -180,6 +423,12 @@ func (r *AttachDefinitionReconciler) deleteMultusNetAttach(
 		return err
 	}
 
+	if instance := InstanceOf(multusNetAttach.Labels, namespaceInstance); !IsInstance(instance, r.InstanceName) {
+		logger.Info("Object belongs to another operator instance, skip", "instance", instance)
+
+		return nil
+	}
+
 	if err := r.Delete(ctx, multusNetAttach); err != nil {
 		// Already deleted, nothing to do.
 		if apierrors.IsNotFound(err) {
@@ -193,65 +442,529 @@ func (r *AttachDefinitionReconciler) deleteMultusNetAttach(
 		return err
 	}
 
+	metrics.NetworkAttachmentDefinitionOperations.WithLabelValues(metrics.OperationDelete, reason).Inc()
+	RecordEvent(r.Recorder, eventObject, corev1.EventTypeNormal, EventReasonNetworkAttachmentDefinitionDeleted,
+		"NetworkAttachmentDefinition %s is deleted: %s", multusRef, reason)
+
 	return nil
 }
 
-func (r *AttachDefinitionReconciler) createMultusNetAttach(ctx context.Context,
-	multusRef client.ObjectKey, config *CNIPluginConf) error {
-	logger := log.FromContext(ctx).WithValues(
-		constants.MultusNetworkAttachmentDefinitionAPIVersion+"/"+constants.MultusNetworkAttachmentDefinitionResourceKind,
-		multusRef.Namespace+"/"+multusRef.Name)
+// rollback - pins the NetworkAttachmentDefinition to the CNI configuration of the spec.rollbackTo revision.
+// If the revision is not kept in the history or violates AttachDefinitionPolicies,
+// the NetworkAttachmentDefinition is not changed.
+func (r *AttachDefinitionReconciler) rollback(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition,
+	namespaceInstance string) error {
+	logger := log.FromContext(ctx).WithValues("AttachDefinition", client.ObjectKeyFromObject(ldAttach))
 
-	logger.Info("Creating Multus NetworkAttachmentDefinition")
+	requiredMultusNetAttach, revision, err := renderRevision(ldAttach)
+	if err != nil {
+		logger.Info("can not roll back NetworkAttachmentDefinition", "reason", err.Error())
 
-	multusNetAttach, err := newMultusNetworkAttachDefinition(multusRef, config)
+		return r.updateConditions(ctx, ldAttach, []metav1.Condition{newRolledBackCondition(ldAttach, err)})
+	}
+
+	// The revision is checked by the current AttachDefinitionPolicies like a spec, so a rollback does not bypass them.
+	violations, err := r.checkRevision(ctx, ldAttach, revision)
 	if err != nil {
-		logger.Error(err, "can not Marshal CNI plugin configuration")
+		return err
+	}
+
+	if len(violations) != 0 {
+		var message = violations.ToAggregate().Error()
+
+		logger.Info("revision violates AttachDefinitionPolicies, skip", "revision", revision.Revision, "violations", message)
+		RecordEvent(r.Recorder, ldAttach, corev1.EventTypeWarning, EventReasonPolicyViolation,
+			"NetworkAttachmentDefinition is not rolled back to revision %d: %s", revision.Revision, message)
+
+		return r.updateConditions(ctx, ldAttach, []metav1.Condition{{
+			Type:    cniv1alpha1.ConditionPolicyCompliant,
+			Status:  metav1.ConditionFalse,
+			Reason:  "PolicyViolation",
+			Message: fmt.Sprintf("revision %d: %s", revision.Revision, message),
+		}, newRolledBackCondition(ldAttach, fmt.Errorf("revision %d violates AttachDefinitionPolicies",
+			revision.Revision))})
+	}
+
+	if err = r.updateConditions(ctx, ldAttach, []metav1.Condition{{
+		Type:    cniv1alpha1.ConditionPolicyCompliant,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Compliant",
+		Message: fmt.Sprintf("revision %d complies with AttachDefinitionPolicies", revision.Revision),
+	}, newRolledBackCondition(ldAttach, nil)}); err != nil {
+		return err
+	}
+
+	return r.ensureMultusNetAttach(ctx, ldAttach, namespaceInstance, requiredMultusNetAttach,
+		fmt.Sprintf("rollback to revision %d", revision.Revision))
+}
+
+// checkRevision - returns violations of AttachDefinitionPolicies by the revision's configuration.
+// Values equal to the current Linkerd CNI defaults are not checked; if the defaults can not be loaded,
+// every value of the revision is checked.
+func (r *AttachDefinitionReconciler) checkRevision(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition,
+	revision *cniv1alpha1.RenderedRevision) (field.ErrorList, error) {
+	logger := log.FromContext(ctx).WithValues("AttachDefinition", client.ObjectKeyFromObject(ldAttach))
+
+	cniConfig, err := parseRevisionConfig(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, _, err := r.getLinkerdCNIConfig(ctx, ldAttach)
+	if err != nil {
+		logger.Info("can not load Linkerd CNI defaults, check every value of the revision", "reason", err.Error())
+	}
+
+	violations, err := policy.Check(ctx, r.Client, ldAttach.Namespace, revisionSpec(cniConfig, defaults))
+	if err != nil {
+		logger.Error(err, "can not check AttachDefinitionPolicies")
+
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// ensureMultusNetAttach - creates or updates the NetworkAttachmentDefinition to the required state
+// unless it belongs to another operator instance and records its configuration in the AttachDefinition's history.
+// An empty trigger of the revision is derived from the provenance annotations.
+// nolint:funlen // sequential comparison steps.
+func (r *AttachDefinitionReconciler) ensureMultusNetAttach(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition,
+	namespaceInstance string, requiredMultusNetAttach *netattachv1.NetworkAttachmentDefinition, trigger string) error {
+	var multusRef = client.ObjectKeyFromObject(requiredMultusNetAttach)
+
+	logger := log.FromContext(ctx).WithValues("AttachDefinition", client.ObjectKeyFromObject(ldAttach))
+
+	var currentMultusNetAttach = &netattachv1.NetworkAttachmentDefinition{}
+
+	if err := r.Get(ctx, multusRef, currentMultusNetAttach); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		// Create.
+		if err = r.createMultusNetAttach(ctx, ldAttach, requiredMultusNetAttach); err != nil {
+			return err
+		}
+
+		return r.recordRevision(ctx, ldAttach, requiredMultusNetAttach, trigger)
+	}
+
+	if instance := InstanceOf(currentMultusNetAttach.Labels, namespaceInstance); !IsInstance(instance, r.InstanceName) {
+		logger.Info("NetworkAttachmentDefinition belongs to another operator instance, skip", "instance", instance)
+		RecordEvent(r.Recorder, ldAttach, corev1.EventTypeWarning, EventReasonNetworkAttachmentDefinitionConflict,
+			"NetworkAttachmentDefinition %s is managed by operator instance %q and is not changed", multusRef, instance)
+
+		return nil
+	}
+
+	// Update.
+	// Not very good comparison but will go for prototype.
+	// ToDo: write a better comparison, maybe via json.Unmarshal.
+	if currentMultusNetAttach.Spec.Config == requiredMultusNetAttach.Spec.Config &&
+		currentMultusNetAttach.Labels[constants.InstanceLabel] == r.instanceName() &&
+		hasAnnotations(currentMultusNetAttach, requiredMultusNetAttach.Annotations) {
+		logger.Info("Current and required configurations are equal, nothing to do")
+
+		return r.recordRevision(ctx, ldAttach, currentMultusNetAttach, trigger)
+	}
+
+	var (
+		reason        = "instance-label"
+		changedFields []string
+	)
+
+	if !hasAnnotations(currentMultusNetAttach, requiredMultusNetAttach.Annotations) {
+		reason = "provenance"
+	}
+
+	if currentMultusNetAttach.Spec.Config != requiredMultusNetAttach.Spec.Config {
+		reason = "config-changed"
+
+		// The configuration does not match its own hash: it was edited outside of the operator.
+		if isTampered(currentMultusNetAttach) {
+			reason = "tampered"
+			changedFields = changedConfigFields(currentMultusNetAttach.Spec.Config, requiredMultusNetAttach.Spec.Config)
+		}
+
+		metrics.ConfigDrift.WithLabelValues(multusRef.Namespace).Inc()
+	}
+
+	currentMultusNetAttach.Spec.Config = requiredMultusNetAttach.Spec.Config
+	setAnnotations(currentMultusNetAttach, requiredMultusNetAttach.Annotations)
+	setInstanceLabel(currentMultusNetAttach, r.instanceName())
+
+	logger.Info("Updating Multus NetworkAttachmentDefinition")
+
+	if err := r.Update(ctx, currentMultusNetAttach); err != nil {
+		logger.Error(err, "can not update NetworkAttachmentDefinition")
 
 		return err
 	}
 
+	metrics.NetworkAttachmentDefinitionOperations.WithLabelValues(metrics.OperationUpdate, reason).Inc()
+
+	if len(changedFields) != 0 {
+		RecordEvent(r.Recorder, ldAttach, corev1.EventTypeWarning, EventReasonNetworkAttachmentDefinitionTampered,
+			"NetworkAttachmentDefinition %s was modified outside of the operator, restored fields: %s",
+			multusRef, strings.Join(changedFields, ", "))
+	} else {
+		RecordEvent(r.Recorder, ldAttach, corev1.EventTypeNormal, EventReasonNetworkAttachmentDefinitionUpdated,
+			"NetworkAttachmentDefinition %s is updated: %s", multusRef, reason)
+	}
+
+	return r.recordRevision(ctx, ldAttach, currentMultusNetAttach, trigger)
+}
+
+func (r *AttachDefinitionReconciler) createMultusNetAttach(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition,
+	multusNetAttach *netattachv1.NetworkAttachmentDefinition) error {
+	var multusRef = client.ObjectKeyFromObject(multusNetAttach)
+
+	logger := log.FromContext(ctx).WithValues(
+		constants.MultusNetworkAttachmentDefinitionAPIVersion+"/"+constants.MultusNetworkAttachmentDefinitionResourceKind,
+		multusRef.Namespace+"/"+multusRef.Name)
+
+	logger.Info("Creating Multus NetworkAttachmentDefinition")
+
+	setInstanceLabel(multusNetAttach, r.instanceName())
+
 	if err := r.Create(ctx, multusNetAttach); err != nil {
 		logger.Error(err, "can not create Multus NetworkAttachmentDefinition")
 
 		return err
 	}
 
+	metrics.NetworkAttachmentDefinitionOperations.WithLabelValues(metrics.OperationCreate, "missing").Inc()
+	RecordEvent(r.Recorder, ldAttach, corev1.EventTypeNormal, EventReasonNetworkAttachmentDefinitionCreated,
+		"NetworkAttachmentDefinition %s is created", multusRef)
+
 	return nil
 }
 
+// RenderMultusNetworkAttachDefinition - renders the Multus NetworkAttachmentDefinition which
+// the reconciler maintains for the AttachDefinition: the spec.rollbackTo revision or the configuration
+// layered as Reconcile does it from the current Linkerd CNI ConfigMap, linkerd-config, the operator defaults
+// and the current state of the skipped Services.
+func (r *AttachDefinitionReconciler) RenderMultusNetworkAttachDefinition(ctx context.Context,
+	ldAttach *cniv1alpha1.AttachDefinition) (*netattachv1.NetworkAttachmentDefinition, error) {
+	var multusNetAttach *netattachv1.NetworkAttachmentDefinition
+
+	if ldAttach.Spec.RollbackTo != nil {
+		rendered, _, err := renderRevision(ldAttach)
+		if err != nil {
+			return nil, err
+		}
+
+		multusNetAttach = rendered
+	} else {
+		cniConfigDefault, source, err := r.getLinkerdCNIConfig(ctx, ldAttach)
+		if err != nil {
+			return nil, err
+		}
+
+		services, err := r.resolveSkippedServices(ctx, ldAttach)
+		if err != nil {
+			return nil, err
+		}
+
+		if multusNetAttach, err = renderMultusNetAttach(ldAttach, cniConfigDefault, services,
+			NewProvenance(ldAttach, source.ConfigMap)); err != nil {
+			return nil, err
+		}
+	}
+
+	setInstanceLabel(multusNetAttach, r.instanceName())
+
+	return multusNetAttach, nil
+}
+
+// CNISourceCheck - a healthz checker which succeeds when the configuration of the operator's Linkerd CNI ConfigMap
+// and, if used, linkerd-config can be loaded, the last known good configuration of an invalid ConfigMap is enough.
+func (r *AttachDefinitionReconciler) CNISourceCheck(req *http.Request) error {
+	_, _, err := r.getLinkerdCNIConfig(req.Context(), &cniv1alpha1.AttachDefinition{})
+
+	return err
+}
+
+// CNISourceDegradedCheck - a healthz checker which fails while the operator's Linkerd CNI ConfigMap is invalid
+// and its last known good configuration is used.
+func (r *AttachDefinitionReconciler) CNISourceDegradedCheck(req *http.Request) error {
+	_, source, err := r.getLinkerdCNIConfig(req.Context(), &cniv1alpha1.AttachDefinition{})
+	if err != nil {
+		return err
+	}
+
+	return source.Degraded
+}
+
+// linkerdConfigRef - returns the reference to the Linkerd control plane linkerd-config ConfigMap
+// or nil if it is not used.
+func (r *AttachDefinitionReconciler) linkerdConfigRef() *operatorconfig.ConfigMapKeyRef {
+	if r.Config == nil {
+		return nil
+	}
+
+	return r.Config.Get().LinkerdConfig
+}
+
 // getLinkerdCNIConfig - loads CNI Plugin configuration from a Linkerd CNI plugin ConfigMap
-// with patched KUBECONFIG path with the operator's provided value.
-func (r *AttachDefinitionReconciler) getLinkerdCNIConfig(ctx context.Context) (*CNIPluginConf, error) {
-	logger := log.FromContext(ctx).WithValues("v1/ConfigMap",
-		r.CNIConfigMapRef.Namespace+"/"+r.CNIConfigMapRef.Name)
+// with patched KUBECONFIG path with the operator's provided value and applied configuration defaults.
+// The AttachDefinition's CNI source, if allowed, overrides the operator's ConfigMap and kubeconfig path.
+// If the ConfigMap is invalid, its last known good configuration is used if stored.
+// If linkerd-config is used, its proxy settings are applied on top of the Linkerd CNI ConfigMap and
+// the settings which differ between them are returned.
+// nolint:funlen,gocyclo // sequential configuration layers.
+func (r *AttachDefinitionReconciler) getLinkerdCNIConfig(ctx context.Context,
+	ldAttach *cniv1alpha1.AttachDefinition) (*CNIPluginConf, *cniSourceStatus, error) {
+	var (
+		cmRef      = r.CNIConfigMapRef
+		kubeconfig = r.CNIKubeconfig
+		defaults   *cniv1alpha1.ProxyConfig
+		cfg        *operatorconfig.Config
+	)
+
+	if r.Config != nil {
+		cfg = r.Config.Get()
+
+		cmRef = CNIConfigMapRef{
+			ObjectKey: client.ObjectKey{Namespace: cfg.CNIConfigMap.Namespace, Name: cfg.CNIConfigMap.Name},
+			Key:       cfg.CNIConfigMap.Key,
+		}
+		kubeconfig = cfg.CNIKubeconfig
+		defaults = &cfg.Defaults
+	}
 
-	var cniConfigMap = &corev1.ConfigMap{}
-	if err := r.Get(ctx, r.CNIConfigMapRef.ObjectKey, cniConfigMap); err != nil {
-		logger.Error(err, "can not get Linkerd CNI ConfigMap")
+	if source := ldAttach.Spec.CNISource; source != nil {
+		if source.ConfigMap != nil {
+			cmRef.ObjectKey = client.ObjectKey{Namespace: source.ConfigMap.Namespace, Name: source.ConfigMap.Name}
 
-		return nil, err
+			if source.ConfigMap.Key != "" {
+				cmRef.Key = source.ConfigMap.Key
+			}
+		}
+
+		if source.Kubeconfig != "" {
+			kubeconfig = source.Kubeconfig
+		}
+
+		// Without the operator configuration, for example, in command-line tools, all sources are allowed.
+		if cfg != nil && !cfg.IsCNIConfigMapAllowed(cmRef.Namespace, cmRef.Name, cmRef.Key) {
+			metrics.CNISourceLoadFailures.WithLabelValues("not-allowed").Inc()
+
+			return nil, nil, fmt.Errorf("%w: ConfigMap %s key %q", ErrCNISourceNotAllowed, cmRef.ObjectKey, cmRef.Key)
+		}
+
+		if cfg != nil && !cfg.IsCNIKubeconfigAllowed(kubeconfig) {
+			metrics.CNISourceLoadFailures.WithLabelValues("not-allowed").Inc()
+
+			return nil, nil, fmt.Errorf("%w: kubeconfig %q", ErrCNISourceNotAllowed, kubeconfig)
+		}
 	}
 
-	cniRawConfig, ok := cniConfigMap.Data[r.CNIConfigMapRef.Key]
-	if !ok {
-		err := fmt.Errorf("%w: expected key %q", ErrCNIConfigMapKeyNotFound, r.CNIConfigMapRef.Key)
+	logger := log.FromContext(ctx).WithValues("v1/ConfigMap", cmRef.Namespace+"/"+cmRef.Name)
 
+	var (
+		cniConfigMap = &corev1.ConfigMap{}
+		source       = &cniSourceStatus{ConfigMap: cniConfigMap}
+		cniConfig    *CNIPluginConf
+	)
+
+	err := r.Get(ctx, cmRef.ObjectKey, cniConfigMap)
+	if err != nil {
 		logger.Error(err, "can not get Linkerd CNI ConfigMap")
+		metrics.CNISourceLoadFailures.WithLabelValues("config-map-get").Inc()
+	} else if cniConfig, err = ParseLinkerdCNIConfig(cniConfigMap, cmRef.Key, kubeconfig); err != nil {
+		logger.Error(err, "can not parse Linkerd CNI ConfigMap")
+		metrics.CNISourceLoadFailures.WithLabelValues("config-map-parse").Inc()
+	} else {
+		metrics.CNISourceDegraded.WithLabelValues(cmRef.ObjectKey.String(), cmRef.Key).Set(0)
+	}
+
+	if err == nil && r.LastKnownGood != nil {
+		// The source is valid, a failure to store it only delays the fallback.
+		if err := r.LastKnownGood.Save(ctx, cmRef, cniConfigMap); err != nil {
+			logger.Error(err, "can not store the last known good Linkerd CNI configuration")
+		}
+	}
+
+	// The CNIRollout assigns the stable or the rolled out configuration of the operator's ConfigMap to the Namespace.
+	if err == nil && ldAttach.Namespace != "" && !usesCNISource(ldAttach) {
+		rollout, err := instanceRollout(ctx, r.Client, r.InstanceName)
+		if err != nil {
+			logger.Error(err, "can not list CNIRollouts")
+
+			return nil, nil, err
+		}
+
+		if assigned := rolloutConfigMap(rollout, ldAttach.Namespace, cmRef, cniConfigMap); assigned != cniConfigMap {
+			if cniConfig, err = ParseLinkerdCNIConfig(assigned, cmRef.Key, kubeconfig); err != nil {
+				logger.Error(err, "can not parse Linkerd CNI configuration assigned by CNIRollout", "CNIRollout", rollout.Name)
+
+				return nil, nil, err
+			}
+
+			source.ConfigMap = assigned
+		}
+	}
+
+	if err != nil {
+		if cniConfig, source, err = r.lastKnownGoodCNIConfig(ctx, cmRef, kubeconfig, err); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if ref := r.linkerdConfigRef(); ref != nil {
+		values, err := r.getLinkerdValues(ctx, ref)
+		if err != nil {
+			metrics.CNISourceLoadFailures.WithLabelValues("linkerd-config").Inc()
+
+			return nil, nil, err
+		}
+
+		controlPlaneConfig, err := values.ProxyConfig()
+		if err != nil {
+			logger.Error(err, "can not parse linkerd-config proxy settings")
+			metrics.CNISourceLoadFailures.WithLabelValues("linkerd-config").Inc()
+
+			return nil, nil, err
+		}
+
+		source.Disagreements = values.Disagreements(cniConfig)
+		cniConfig = applyProxyConfig(cniConfig, controlPlaneConfig)
+	}
+
+	if defaults != nil {
+		cniConfig = applyProxyConfig(cniConfig, defaults)
+	}
+
+	return cniConfig, source, nil
+}
+
+// lastKnownGoodCNIConfig - loads the last known good configuration of the invalid CNI source.
+// The source error is returned if the source can not be replaced.
+func (r *AttachDefinitionReconciler) lastKnownGoodCNIConfig(ctx context.Context, cmRef CNIConfigMapRef,
+	kubeconfig string, sourceErr error) (*CNIPluginConf, *cniSourceStatus, error) {
+	if r.LastKnownGood == nil || !isCNISourceInvalid(sourceErr) {
+		return nil, nil, sourceErr
+	}
+
+	logger := log.FromContext(ctx).WithValues("v1/ConfigMap", cmRef.Namespace+"/"+cmRef.Name)
+
+	lastKnownGood, err := r.LastKnownGood.Load(ctx, cmRef)
+	if err != nil {
+		logger.Error(err, "can not load the last known good Linkerd CNI configuration")
+
+		return nil, nil, sourceErr
+	}
+
+	if lastKnownGood == nil {
+		return nil, nil, sourceErr
+	}
+
+	cniConfig, err := ParseLinkerdCNIConfig(lastKnownGood, cmRef.Key, kubeconfig)
+	if err != nil {
+		logger.Error(err, "can not parse the last known good Linkerd CNI configuration")
+
+		return nil, nil, sourceErr
+	}
+
+	metrics.CNISourceDegraded.WithLabelValues(cmRef.ObjectKey.String(), cmRef.Key).Set(1)
+
+	return cniConfig, &cniSourceStatus{
+		Degraded:  fmt.Errorf("ConfigMap %s key %q: %w", cmRef.ObjectKey, cmRef.Key, sourceErr),
+		ConfigMap: lastKnownGood,
+	}, nil
+}
+
+// getLinkerdValues - loads the Linkerd control plane Helm values from the linkerd-config ConfigMap.
+func (r *AttachDefinitionReconciler) getLinkerdValues(ctx context.Context,
+	ref *operatorconfig.ConfigMapKeyRef) (*LinkerdValues, error) {
+	logger := log.FromContext(ctx).WithValues("v1/ConfigMap", ref.Namespace+"/"+ref.Name)
+
+	var linkerdConfigMap = &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, linkerdConfigMap); err != nil {
+		logger.Error(err, "can not get linkerd-config ConfigMap")
+
+		return nil, err
+	}
+
+	values, err := ParseLinkerdConfig(linkerdConfigMap, ref.Key)
+	if err != nil {
+		logger.Error(err, "can not parse linkerd-config ConfigMap")
 
 		return nil, err
 	}
 
+	return values, nil
+}
+
+// newDefaultsConsistentCondition - reports whether Linkerd CNI and the control plane agree on proxy settings.
+func newDefaultsConsistentCondition(disagreements []string) metav1.Condition {
+	if len(disagreements) != 0 {
+		return metav1.Condition{
+			Type:   cniv1alpha1.ConditionDefaultsConsistent,
+			Status: metav1.ConditionFalse,
+			Reason: "CNIControlPlaneMismatch",
+			Message: "Linkerd CNI and control plane defaults disagree, control plane values are used: " +
+				strings.Join(disagreements, "; "),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    cniv1alpha1.ConditionDefaultsConsistent,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Consistent",
+		Message: "Linkerd CNI and control plane defaults agree",
+	}
+}
+
+// updateConditions - sets and removes the conditions in the AttachDefinition's status
+// and updates it if they changed.
+func (r *AttachDefinitionReconciler) updateConditions(ctx context.Context,
+	ldAttach *cniv1alpha1.AttachDefinition, conditions []metav1.Condition, removed ...string) error {
+	logger := log.FromContext(ctx).WithValues("AttachDefinition", client.ObjectKeyFromObject(ldAttach))
+
+	var current = ldAttach.Status.DeepCopy().Conditions
+
+	for _, condition := range conditions {
+		condition.ObservedGeneration = ldAttach.Generation
+
+		meta.SetStatusCondition(&ldAttach.Status.Conditions, condition)
+	}
+
+	for _, conditionType := range removed {
+		meta.RemoveStatusCondition(&ldAttach.Status.Conditions, conditionType)
+	}
+
+	if apiequality.Semantic.DeepEqual(current, ldAttach.Status.Conditions) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, ldAttach); err != nil {
+		logger.Error(err, "can not update AttachDefinition status")
+
+		return err
+	}
+
+	return nil
+}
+
+// ParseLinkerdCNIConfig - parses CNI Plugin configuration stored under the key of a Linkerd CNI
+// plugin ConfigMap and patches its KUBECONFIG path with the provided value.
+func ParseLinkerdCNIConfig(cniConfigMap *corev1.ConfigMap, key, kubeconfig string) (*CNIPluginConf, error) {
+	cniRawConfig, ok := cniConfigMap.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: expected key %q", ErrCNIConfigMapKeyNotFound, key)
+	}
+
 	var cniConfig = newCNIPluginConf()
 
 	if err := json.Unmarshal([]byte(cniRawConfig), cniConfig); err != nil {
-		logger.Error(err, "Can not Unmarshal Linkerd CNI ConfigMap")
-
 		return nil, err
 	}
 
 	// Set Kubeconfig.
-	cniConfig.Kubernetes.Kubeconfig = r.CNIKubeconfig
+	cniConfig.Kubernetes.Kubeconfig = kubeconfig
 
 	return cniConfig, nil
 }
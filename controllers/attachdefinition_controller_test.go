@@ -0,0 +1,170 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// canaryKubeconfigPath - Linkerd CNI kubeconfig of the canary linkerd-cni installation.
+const canaryKubeconfigPath = "/etc/cni/net.d/ZZZ-linkerd-cni-canary-kubeconfig"
+
+// reconcilerWith - an AttachDefinitionReconciler over a fake client with the objects.
+func reconcilerWith(t *testing.T, objects ...client.Object) *AttachDefinitionReconciler {
+	t.Helper()
+
+	var scheme = runtime.NewScheme()
+
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, cniv1alpha1.AddToScheme, netattachv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &AttachDefinitionReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Scheme: scheme,
+	}
+}
+
+// linkerdCNIConfigMap - a Linkerd CNI ConfigMap, the proxy UID tells which ConfigMap the configuration is loaded from.
+func linkerdCNIConfigMap(namespace string, proxyUID int) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: constants.DefaultLinkerdCNICMName},
+		Data: map[string]string{
+			constants.DefaultLinkerdCNICMKey: fmt.Sprintf(
+				`{"name": "linkerd-cni", "type": "linkerd-cni", "linkerd": {"proxy-uid": %d}}`, proxyUID),
+		},
+	}
+}
+
+func TestGetLinkerdCNIConfigSources(t *testing.T) {
+	var tests = []struct {
+		name           string
+		source         *cniv1alpha1.CNISource
+		wantProxyUID   int
+		wantKubeconfig string
+		wantErr        error
+	}{
+		{
+			name:           "operator's source",
+			wantProxyUID:   2102,
+			wantKubeconfig: constants.DefaultLinkerdCNIKubeconfigPath,
+		},
+		{
+			name: "allowed ConfigMap",
+			source: &cniv1alpha1.CNISource{
+				ConfigMap: &cniv1alpha1.CNIConfigMapReference{Namespace: "linkerd-canary", Name: constants.DefaultLinkerdCNICMName},
+			},
+			wantProxyUID:   2103,
+			wantKubeconfig: constants.DefaultLinkerdCNIKubeconfigPath,
+		},
+		{
+			name: "allowed kubeconfig",
+			source: &cniv1alpha1.CNISource{
+				Kubeconfig: canaryKubeconfigPath,
+			},
+			wantProxyUID:   2102,
+			wantKubeconfig: canaryKubeconfigPath,
+		},
+		{
+			name: "ConfigMap is not allowed",
+			source: &cniv1alpha1.CNISource{
+				ConfigMap: &cniv1alpha1.CNIConfigMapReference{Namespace: "app", Name: constants.DefaultLinkerdCNICMName},
+			},
+			wantErr: ErrCNISourceNotAllowed,
+		},
+		{
+			name: "key is not allowed",
+			source: &cniv1alpha1.CNISource{
+				ConfigMap: &cniv1alpha1.CNIConfigMapReference{
+					Namespace: constants.DefaultLinkerdCNICMNamespace,
+					Name:      constants.DefaultLinkerdCNICMName,
+					Key:       "canary",
+				},
+			},
+			wantErr: ErrCNISourceNotAllowed,
+		},
+		{
+			name: "kubeconfig is not allowed",
+			source: &cniv1alpha1.CNISource{
+				ConfigMap:  &cniv1alpha1.CNIConfigMapReference{Namespace: "linkerd-canary", Name: constants.DefaultLinkerdCNICMName},
+				Kubeconfig: "/etc/kubernetes/admin.conf",
+			},
+			wantErr: ErrCNISourceNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg = operatorconfig.Default()
+
+			// The canary ConfigMap is allowed with any key.
+			var canary = cfg.CNIConfigMap
+			canary.Namespace = "linkerd-canary"
+			canary.Key = ""
+
+			cfg.AllowedCNISources.ConfigMaps = append(cfg.AllowedCNISources.ConfigMaps, canary)
+			cfg.AllowedCNISources.Kubeconfigs = []string{canaryKubeconfigPath}
+
+			var r = reconcilerWith(t,
+				linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, 2102),
+				linkerdCNIConfigMap("linkerd-canary", 2103),
+			)
+			r.Config = operatorconfig.NewStore(cfg, "", nil)
+
+			var ldAttach = &cniv1alpha1.AttachDefinition{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "attach"},
+				Spec:       cniv1alpha1.AttachDefinitionSpec{CNISource: tt.source},
+			}
+
+			cniConfig, _, err := r.getLinkerdCNIConfig(context.Background(), ldAttach)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getLinkerdCNIConfig() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if cniConfig.Linkerd.ProxyUID != tt.wantProxyUID {
+				t.Errorf("proxy UID = %d, want %d", cniConfig.Linkerd.ProxyUID, tt.wantProxyUID)
+			}
+
+			if cniConfig.Kubernetes.Kubeconfig != tt.wantKubeconfig {
+				t.Errorf("kubeconfig = %q, want %q", cniConfig.Kubernetes.Kubeconfig, tt.wantKubeconfig)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// Keys of Multus cni-args of the Linkerd CNI network. They are the JSON names of the ProxyInit
+// fields, and an argument replaces the field of the NetworkAttachmentDefinition's configuration.
+const (
+	CNIArgIncomingProxyPort     = "incoming-proxy-port"
+	CNIArgOutgoingProxyPort     = "outgoing-proxy-port"
+	CNIArgProxyUID              = "proxy-uid"
+	CNIArgInboundPortsToIgnore  = "inbound-ports-to-ignore"
+	CNIArgOutboundPortsToIgnore = "outbound-ports-to-ignore"
+	CNIArgSubnetsToIgnore       = "subnets-to-ignore"
+)
+
+// cniArgParser - converts a Pod annotation value to a cni-args value.
+type cniArgParser func(value string) (interface{}, error)
+
+// podCNIArgs - Pod annotations which are translated to cni-args.
+var podCNIArgs = []struct {
+	annotation string
+	arg        string
+	parse      cniArgParser
+}{
+	{constants.LinkerdInboundPortAnnotation, CNIArgIncomingProxyPort, parseCNIArgPort},
+	{constants.LinkerdOutboundPortAnnotation, CNIArgOutgoingProxyPort, parseCNIArgPort},
+	{constants.LinkerdProxyUIDAnnotation, CNIArgProxyUID, parseCNIArgUID},
+	{constants.LinkerdSkipInboundPortsAnnotation, CNIArgInboundPortsToIgnore, parseCNIArgPorts},
+	{constants.LinkerdSkipOutboundPortsAnnotation, CNIArgOutboundPortsToIgnore, parseCNIArgPorts},
+	{constants.LinkerdSkipSubnetsAnnotation, CNIArgSubnetsToIgnore, parseCNIArgSubnets},
+}
+
+// PodCNIArgs - translates per-Pod Linkerd proxy configuration annotations to cni-args of
+// the Linkerd CNI network, so the iptables rules match the proxy configuration of the Pod.
+// Invalid annotations are reported in the error and are not translated.
+func PodCNIArgs(annotations map[string]string) (map[string]interface{}, error) {
+	var (
+		args = map[string]interface{}{}
+		errs []error
+	)
+
+	for _, item := range podCNIArgs {
+		value, ok := annotations[item.annotation]
+		if !ok {
+			continue
+		}
+
+		parsed, err := item.parse(strings.TrimSpace(value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("annotation %s=%q: %w", item.annotation, value, err))
+
+			continue
+		}
+
+		args[item.arg] = parsed
+	}
+
+	return args, utilerrors.NewAggregate(errs)
+}
+
+// mergedCNIArgs - cni-args whose lists are merged with the NetworkAttachmentDefinition's ones, so a Pod
+// which skips its own ports or subnets keeps skipping the Namespace-wide ones, for example, the proxy
+// admin ports or the subnets of skipped Services.
+var mergedCNIArgs = []string{CNIArgInboundPortsToIgnore, CNIArgOutboundPortsToIgnore, CNIArgSubnetsToIgnore}
+
+// MergeCNIArgs - returns a copy of the cni-args whose ports and subnets to ignore are the union of the CNI
+// configuration's lists and the Pod's ones. The arguments replace the fields of the configuration, so
+// the merged lists must be passed in the cni-args.
+func MergeCNIArgs(cfg *CNIPluginConf, args map[string]interface{}) map[string]interface{} {
+	var merged = make(map[string]interface{}, len(args))
+
+	for key, value := range args {
+		merged[key] = value
+	}
+
+	var base = map[string][]string{
+		CNIArgInboundPortsToIgnore:  cfg.Linkerd.InboundPortsToIgnore,
+		CNIArgOutboundPortsToIgnore: cfg.Linkerd.OutboundPortsToIgnore,
+		CNIArgSubnetsToIgnore:       cfg.Linkerd.SubnetsToIgnore,
+	}
+
+	for _, key := range mergedCNIArgs {
+		value, ok := args[key]
+		if !ok {
+			continue
+		}
+
+		var (
+			items = []string{}
+			seen  = map[string]bool{}
+		)
+
+		for _, item := range append(append([]string{}, base[key]...), cniArgStrings(value)...) {
+			if !seen[item] {
+				seen[item] = true
+				items = append(items, item)
+			}
+		}
+
+		merged[key] = items
+	}
+
+	return merged
+}
+
+// CNIArgsSpec - returns the AttachDefinition settings which the cni-args override, so the Pod's own
+// proxy configuration is checked against AttachDefinitionPolicies like an AttachDefinition.
+// The ports to ignore are only the Pod's ones: the merged NetworkAttachmentDefinition's ports
+// come from the AttachDefinition, which the reconciler checks, or from the operator.
+func CNIArgsSpec(args map[string]interface{}) *cniv1alpha1.AttachDefinitionSpec {
+	var spec = &cniv1alpha1.AttachDefinitionSpec{}
+
+	if port, ok := args[CNIArgIncomingProxyPort].(int); ok {
+		spec.Config.InboundPort = cniv1alpha1.Port(port)
+	}
+
+	if port, ok := args[CNIArgOutgoingProxyPort].(int); ok {
+		spec.Config.OutboundPort = cniv1alpha1.Port(port)
+	}
+
+	if uid, ok := args[CNIArgProxyUID].(int); ok {
+		var proxyUID = uint32(uid)
+		spec.Config.ProxyUID = &proxyUID
+	}
+
+	spec.Config.SkipInboundPorts = cniArgPorts(args[CNIArgInboundPortsToIgnore])
+	spec.Config.SkipOutboundPorts = cniArgPorts(args[CNIArgOutboundPortsToIgnore])
+
+	return spec
+}
+
+// cniArgPorts - converts a list of ports and port ranges of cni-args to AttachDefinition ports.
+func cniArgPorts(value interface{}) []cniv1alpha1.Ports {
+	var ports []cniv1alpha1.Ports
+
+	for _, item := range cniArgStrings(value) {
+		if strings.Contains(item, "-") {
+			ports = append(ports, cniv1alpha1.Ports{Range: item})
+
+			continue
+		}
+
+		if port, err := strconv.Atoi(item); err == nil {
+			ports = append(ports, cniv1alpha1.Ports{Port: cniv1alpha1.Port(port)})
+		}
+	}
+
+	return ports
+}
+
+// cniArgStrings - returns a list argument as parsed from the annotations or decoded from JSON.
+func cniArgStrings(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		var items = make([]string, 0, len(list))
+
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+
+		return items
+	default:
+		return nil
+	}
+}
+
+// ApplyCNIArgs - overrides ProxyInit fields of the CNI configuration with cni-args,
+// the ports and subnets to ignore are merged as MergeCNIArgs does.
+func ApplyCNIArgs(cfg *CNIPluginConf, args map[string]interface{}) error {
+	raw, err := json.Marshal(MergeCNIArgs(cfg, args))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, &cfg.Linkerd)
+}
+
+func parseCNIArgPort(value string) (interface{}, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("port %d is out of range", port)
+	}
+
+	return port, nil
+}
+
+func parseCNIArgUID(value string) (interface{}, error) {
+	uid, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return int(uid), nil
+}
+
+// parseCNIArgPorts - parses a comma separated list of ports and port ranges.
+func parseCNIArgPorts(value string) (interface{}, error) {
+	var ports = []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "-") {
+			if _, _, err := operatorconfig.ParsePortRange(item); err != nil {
+				return nil, err
+			}
+		} else if _, err := parseCNIArgPort(item); err != nil {
+			return nil, err
+		}
+
+		ports = append(ports, item)
+	}
+
+	return ports, nil
+}
+
+// parseCNIArgSubnets - parses a comma separated list of CIDRs.
+func parseCNIArgSubnets(value string) (interface{}, error) {
+	var subnets = []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		if _, _, err := net.ParseCIDR(item); err != nil {
+			return nil, err
+		}
+
+		subnets = append(subnets, item)
+	}
+
+	return subnets, nil
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+// newTestCNIPluginConf - a NetworkAttachmentDefinition configuration which the cni-args override.
+func newTestCNIPluginConf() *CNIPluginConf {
+	var cfg = newCNIPluginConf()
+
+	cfg.Linkerd = ProxyInit{
+		IncomingProxyPort:     4143,
+		OutgoingProxyPort:     4140,
+		ProxyUID:              2102,
+		PortsToRedirect:       []int{8080},
+		InboundPortsToIgnore:  []string{"4190", "4191"},
+		OutboundPortsToIgnore: []string{"443"},
+		SubnetsToIgnore:       []string{"10.0.0.0/8"},
+	}
+
+	return cfg
+}
+
+func TestPodCNIArgsOverrideProxyInit(t *testing.T) {
+	var tests = []struct {
+		name        string
+		annotations map[string]string
+		want        ProxyInit
+		wantErr     bool
+	}{
+		{
+			name:        "no annotations",
+			annotations: map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectEnabled},
+			want:        newTestCNIPluginConf().Linkerd,
+		},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				constants.LinkerdInboundPortAnnotation:       "5143",
+				constants.LinkerdOutboundPortAnnotation:      "5140",
+				constants.LinkerdProxyUIDAnnotation:          "3000",
+				constants.LinkerdSkipInboundPortsAnnotation:  "25, 8000-8100",
+				constants.LinkerdSkipOutboundPortsAnnotation: "5432",
+				constants.LinkerdSkipSubnetsAnnotation:       "192.168.0.0/16,fd00::/8",
+			},
+			want: ProxyInit{
+				IncomingProxyPort:     5143,
+				OutgoingProxyPort:     5140,
+				ProxyUID:              3000,
+				PortsToRedirect:       []int{8080},
+				InboundPortsToIgnore:  []string{"4190", "4191", "25", "8000-8100"},
+				OutboundPortsToIgnore: []string{"443", "5432"},
+				SubnetsToIgnore:       []string{"10.0.0.0/8", "192.168.0.0/16", "fd00::/8"},
+			},
+		},
+		{
+			name:        "empty list keeps the ports",
+			annotations: map[string]string{constants.LinkerdSkipOutboundPortsAnnotation: ""},
+			want:        newTestCNIPluginConf().Linkerd,
+		},
+		{
+			name: "duplicate ports are skipped once",
+			annotations: map[string]string{
+				constants.LinkerdSkipInboundPortsAnnotation:  "4191,25",
+				constants.LinkerdSkipOutboundPortsAnnotation: "443",
+			},
+			want: func() ProxyInit {
+				var want = newTestCNIPluginConf().Linkerd
+				want.InboundPortsToIgnore = []string{"4190", "4191", "25"}
+
+				return want
+			}(),
+		},
+		{
+			name:        "empty list keeps the subnets",
+			annotations: map[string]string{constants.LinkerdSkipSubnetsAnnotation: ""},
+			want:        newTestCNIPluginConf().Linkerd,
+		},
+		{
+			name:        "duplicate subnets are skipped once",
+			annotations: map[string]string{constants.LinkerdSkipSubnetsAnnotation: "10.0.0.0/8,10.96.0.10/32"},
+			want: func() ProxyInit {
+				var want = newTestCNIPluginConf().Linkerd
+				want.SubnetsToIgnore = []string{"10.0.0.0/8", "10.96.0.10/32"}
+
+				return want
+			}(),
+		},
+		{
+			name: "invalid annotations are not passed",
+			annotations: map[string]string{
+				constants.LinkerdInboundPortAnnotation:       "70000",
+				constants.LinkerdSkipInboundPortsAnnotation:  "25,9000-8000",
+				constants.LinkerdSkipSubnetsAnnotation:       "10.0.0.1",
+				constants.LinkerdSkipOutboundPortsAnnotation: "5432",
+			},
+			want: func() ProxyInit {
+				var want = newTestCNIPluginConf().Linkerd
+				want.OutboundPortsToIgnore = []string{"443", "5432"}
+
+				return want
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := PodCNIArgs(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PodCNIArgs() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			// The arguments reach the plugin as JSON in the networks annotation.
+			raw, err := json.Marshal(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded map[string]interface{}
+			if err = json.Unmarshal(raw, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			var cfg = newTestCNIPluginConf()
+			if err = ApplyCNIArgs(cfg, decoded); err != nil {
+				t.Fatalf("ApplyCNIArgs() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(cfg.Linkerd, tt.want) {
+				t.Errorf("ProxyInit = %+v, want %+v", cfg.Linkerd, tt.want)
+			}
+		})
+	}
+}
+
+// TestCNIArgKeysMatchProxyInit - every cni-args key must be the JSON name of a ProxyInit field,
+// otherwise Linkerd CNI ignores it.
+func TestCNIArgKeysMatchProxyInit(t *testing.T) {
+	var fields = map[string]bool{}
+
+	var proxyInit = reflect.TypeOf(ProxyInit{})
+	for i := 0; i < proxyInit.NumField(); i++ {
+		fields[strings.Split(proxyInit.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+
+	for _, item := range podCNIArgs {
+		if !fields[item.arg] {
+			t.Errorf("cni-args key %q of annotation %s is not a ProxyInit field", item.arg, item.annotation)
+		}
+	}
+}
+
+func TestCNIArgsSpec(t *testing.T) {
+	var uid uint32 = 3000
+
+	var tests = []struct {
+		name        string
+		annotations map[string]string
+		want        cniv1alpha1.ProxyConfig
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				constants.LinkerdInboundPortAnnotation:       "5143",
+				constants.LinkerdOutboundPortAnnotation:      "5140",
+				constants.LinkerdProxyUIDAnnotation:          "3000",
+				constants.LinkerdSkipInboundPortsAnnotation:  "25, 8000-8100",
+				constants.LinkerdSkipOutboundPortsAnnotation: "5432",
+				constants.LinkerdSkipSubnetsAnnotation:       "192.168.0.0/16",
+			},
+			want: cniv1alpha1.ProxyConfig{
+				InboundPort:       5143,
+				OutboundPort:      5140,
+				ProxyUID:          &uid,
+				SkipInboundPorts:  []cniv1alpha1.Ports{{Port: 25}, {Range: "8000-8100"}},
+				SkipOutboundPorts: []cniv1alpha1.Ports{{Port: 5432}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := PodCNIArgs(tt.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := CNIArgsSpec(args).Config; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CNIArgsSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
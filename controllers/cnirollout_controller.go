@@ -0,0 +1,529 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// Reasons of Events recorded on CNIRollouts.
+const (
+	EventReasonRolloutStarted     = "RolloutStarted"
+	EventReasonRolloutWaveStarted = "RolloutWaveStarted"
+	EventReasonRolloutPaused      = "RolloutPaused"
+	EventReasonRolloutResumed     = "RolloutResumed"
+	EventReasonRolloutAborted     = "RolloutAborted"
+	EventReasonRolloutCompleted   = "RolloutCompleted"
+)
+
+// rolloutRequeueInterval - CNIRollouts are reconciled periodically to notice changes of the Linkerd CNI
+// ConfigMap, which is not watched, and of the Pods' network status in the updated Namespaces.
+const rolloutRequeueInterval = 30 * time.Second
+
+// CNIRolloutReconciler applies changes of the operator's Linkerd CNI ConfigMap to Namespaces in waves.
+// It only tracks the progress in the CNIRollout's status, the AttachDefinitionReconciler renders
+// the configuration which the status assigns to a Namespace.
+type CNIRolloutReconciler struct {
+	client.Client
+	Scheme          *runtime.Scheme
+	InstanceName    string
+	CNIConfigMapRef CNIConfigMapRef
+	// Recorder - if set, the rollout progress is recorded as Events on CNIRollouts.
+	Recorder record.EventRecorder
+	// Config - if set, the CNI ConfigMap reference and exclusions are taken from the current
+	// operator configuration instead of the fields above.
+	Config *operatorconfig.Store
+}
+
+//+kubebuilder:rbac:groups=cni.linkerd.io,resources=cnirollouts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cni.linkerd.io,resources=cnirollouts/status,verbs=get;update;patch
+
+// Reconcile starts a rollout when the Linkerd CNI configuration changes, moves it to the next wave
+// after the interval and pauses it while Pods in the updated Namespaces have no Linkerd CNI network.
+func (r *CNIRolloutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("CNIRollout", req.Name)
+
+	rollout, err := instanceRollout(ctx, r.Client, r.InstanceName)
+	if err != nil {
+		logger.Error(err, "can not list CNIRollouts")
+
+		return ctrl.Result{}, err
+	}
+
+	if rollout == nil || rollout.Name != req.Name {
+		logger.Info("CNIRollout is deleted or is not used by the operator instance, skip")
+
+		return ctrl.Result{}, nil
+	}
+
+	var (
+		cmRef        = configuredCNIConfigMapRef(r.CNIConfigMapRef, r.Config)
+		cniConfigMap = &corev1.ConfigMap{}
+	)
+
+	if err = r.Get(ctx, cmRef.ObjectKey, cniConfigMap); err != nil {
+		logger.Error(err, "can not get Linkerd CNI ConfigMap", "v1/ConfigMap", cmRef.ObjectKey)
+
+		return ctrl.Result{}, err
+	}
+
+	// An invalid configuration is not rolled out, AttachDefinitions keep the assigned one.
+	if _, err = ParseLinkerdCNIConfig(cniConfigMap, cmRef.Key, ""); err != nil {
+		logger.Info("Linkerd CNI ConfigMap is invalid, the rollout is not changed", "error", err.Error())
+
+		return ctrl.Result{RequeueAfter: rolloutRequeueInterval}, nil
+	}
+
+	var (
+		status          = rollout.Status.DeepCopy()
+		config          = cniConfigMap.Data[cmRef.Key]
+		resourceVersion = cniConfigMap.ResourceVersion
+		now             = metav1.Now()
+	)
+
+	switch {
+	case status.StableConfig == "":
+		// The configuration observed first is used by all Namespaces at once.
+		status.StableConfig, status.StableResourceVersion = config, resourceVersion
+		status.Phase = cniv1alpha1.RolloutPhaseCompleted
+	case config == status.StableConfig:
+		if status.Phase != cniv1alpha1.RolloutPhaseCompleted {
+			RecordEvent(r.Recorder, rollout, corev1.EventTypeNormal, EventReasonRolloutAborted,
+				"Linkerd CNI ConfigMap is reverted to the stable configuration, the rollout of resourceVersion %s is aborted",
+				status.TargetResourceVersion)
+		}
+
+		status.StableResourceVersion = resourceVersion
+		resetRolloutTarget(status)
+	case config == status.TargetConfig:
+		status.TargetResourceVersion = resourceVersion
+	default:
+		status.TargetConfig, status.TargetResourceVersion = config, resourceVersion
+		status.Phase = cniv1alpha1.RolloutPhaseProgressing
+		status.CurrentWave = 0
+		status.UpdatedNamespaces = nil
+		status.WaveStartTime = &now
+
+		RecordEvent(r.Recorder, rollout, corev1.EventTypeNormal, EventReasonRolloutStarted,
+			"Linkerd CNI ConfigMap resourceVersion %s is rolled out", resourceVersion)
+	}
+
+	var result = ctrl.Result{RequeueAfter: rolloutRequeueInterval}
+
+	if status.Phase != cniv1alpha1.RolloutPhaseCompleted {
+		if result, err = r.progress(ctx, rollout, status, now); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, cniv1alpha1.ConditionRolloutHealthy)
+	}
+
+	if apiequality.Semantic.DeepEqual(&rollout.Status, status) {
+		return result, nil
+	}
+
+	rollout.Status = *status
+
+	// AttachDefinitions are reconciled on the status change and render the assigned configuration.
+	if err = r.Status().Update(ctx, rollout); err != nil {
+		logger.Error(err, "can not update CNIRollout status")
+
+		return ctrl.Result{}, err
+	}
+
+	return result, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CNIRolloutReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cniv1alpha1.CNIRollout{}).
+		Named("CNIRolloutReconciler").
+		Complete(r)
+}
+
+// progress - updates the Namespaces of the current wave, pauses the rollout on CNI attachment failures
+// and moves it to the next wave or completes it after the interval.
+// nolint:funlen // the rollout state machine is easier to follow in one place.
+func (r *CNIRolloutReconciler) progress(ctx context.Context, rollout *cniv1alpha1.CNIRollout,
+	status *cniv1alpha1.CNIRolloutStatus, now metav1.Time) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("CNIRollout", rollout.Name)
+
+	namespaces, canaries, err := r.rolloutNamespaces(ctx, rollout)
+	if err != nil {
+		logger.Error(err, "can not list Namespaces of the rollout")
+
+		return ctrl.Result{}, err
+	}
+
+	var waves = rolloutWaves(rollout.Spec.Steps, canaries, len(namespaces))
+
+	if int(status.CurrentWave) >= len(waves) {
+		status.CurrentWave = int32(len(waves) - 1)
+	}
+
+	status.TotalNamespaces = int32(len(namespaces))
+	status.UpdatedNamespaces = mergeNamespaces(status.UpdatedNamespaces, namespaces[:waves[status.CurrentWave]])
+
+	podsWithoutCNI, err := r.podsWithoutCNI(ctx, status.UpdatedNamespaces)
+	if err != nil {
+		logger.Error(err, "can not count Pods without Linkerd CNI network")
+
+		return ctrl.Result{}, err
+	}
+
+	var (
+		healthy = podsWithoutCNI <= rollout.Spec.MaxPodsWithoutCNI
+		paused  = status.Phase == cniv1alpha1.RolloutPhasePaused
+		result  = ctrl.Result{RequeueAfter: rolloutRequeueInterval}
+	)
+
+	setRolloutCondition(status, rollout, newRolloutHealthyCondition(podsWithoutCNI, rollout.Spec.MaxPodsWithoutCNI))
+
+	switch {
+	case rollout.Spec.Paused || !healthy:
+		if !paused && !healthy {
+			RecordEvent(r.Recorder, rollout, corev1.EventTypeWarning, EventReasonRolloutPaused,
+				"%d Pods in the updated Namespaces have no Linkerd CNI network, the rollout is paused at wave %d",
+				podsWithoutCNI, status.CurrentWave)
+		}
+
+		status.Phase = cniv1alpha1.RolloutPhasePaused
+
+		return result, nil
+	case paused:
+		// The wave runs for the whole interval again after the pause.
+		RecordEvent(r.Recorder, rollout, corev1.EventTypeNormal, EventReasonRolloutResumed,
+			"the rollout is resumed at wave %d", status.CurrentWave)
+
+		status.Phase = cniv1alpha1.RolloutPhaseProgressing
+		status.WaveStartTime = &now
+	}
+
+	if status.WaveStartTime == nil {
+		status.WaveStartTime = &now
+	}
+
+	if remaining := status.WaveStartTime.Add(rollout.Spec.Interval.Duration).Sub(now.Time); remaining > 0 {
+		if remaining < result.RequeueAfter {
+			result.RequeueAfter = remaining
+		}
+
+		return result, nil
+	}
+
+	if int(status.CurrentWave) == len(waves)-1 {
+		RecordEvent(r.Recorder, rollout, corev1.EventTypeNormal, EventReasonRolloutCompleted,
+			"Linkerd CNI ConfigMap resourceVersion %s is used by all %d Namespaces",
+			status.TargetResourceVersion, len(namespaces))
+
+		status.StableConfig, status.StableResourceVersion = status.TargetConfig, status.TargetResourceVersion
+		resetRolloutTarget(status)
+		meta.RemoveStatusCondition(&status.Conditions, cniv1alpha1.ConditionRolloutHealthy)
+
+		return result, nil
+	}
+
+	status.CurrentWave++
+	status.WaveStartTime = &now
+	status.UpdatedNamespaces = mergeNamespaces(status.UpdatedNamespaces, namespaces[:waves[status.CurrentWave]])
+
+	RecordEvent(r.Recorder, rollout, corev1.EventTypeNormal, EventReasonRolloutWaveStarted,
+		"wave %d started, %d of %d Namespaces use Linkerd CNI ConfigMap resourceVersion %s",
+		status.CurrentWave, len(status.UpdatedNamespaces), len(namespaces), status.TargetResourceVersion)
+
+	return result, nil
+}
+
+// rolloutNamespaces - returns the Namespaces whose AttachDefinitions render the operator's Linkerd CNI ConfigMap
+// in the rollout order and the number of canary Namespaces at its beginning.
+func (r *CNIRolloutReconciler) rolloutNamespaces(ctx context.Context,
+	rollout *cniv1alpha1.CNIRollout) (namespaces []string, canaries int, err error) {
+	var canarySelector = labels.Nothing()
+
+	if rollout.Spec.CanaryNamespaceSelector != nil {
+		if canarySelector, err = metav1.LabelSelectorAsSelector(rollout.Spec.CanaryNamespaceSelector); err != nil {
+			return nil, 0, fmt.Errorf("invalid canaryNamespaceSelector: %w", err)
+		}
+	}
+
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err = r.List(ctx, attachDefinitions); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		canaryNamespaces, otherNamespaces []string
+		seen                              = map[string]bool{}
+	)
+
+	for i := range attachDefinitions.Items {
+		var ldAttach = &attachDefinitions.Items[i]
+
+		if seen[ldAttach.Namespace] || !ldAttach.Spec.CreateMultusNetworkAttachmentDefinition || usesCNISource(ldAttach) {
+			continue
+		}
+
+		if r.Config != nil && r.Config.Get().IsNamespaceExcluded(ldAttach.Namespace) {
+			continue
+		}
+
+		namespace, err := GetNamespace(ctx, r.Client, ldAttach.Namespace)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if !IsInstance(InstanceOf(ldAttach.Labels, NamespaceInstance(namespace)), r.InstanceName) {
+			continue
+		}
+
+		seen[ldAttach.Namespace] = true
+
+		if canarySelector.Matches(labels.Set(namespace.Labels)) {
+			canaryNamespaces = append(canaryNamespaces, ldAttach.Namespace)
+		} else {
+			otherNamespaces = append(otherNamespaces, ldAttach.Namespace)
+		}
+	}
+
+	sort.Strings(canaryNamespaces)
+	sort.Strings(otherNamespaces)
+
+	return append(canaryNamespaces, otherNamespaces...), len(canaryNamespaces), nil
+}
+
+// podsWithoutCNI - sums the meshed Pods without Linkerd CNI network reported by the AttachDefinitions
+// of the Namespaces.
+func (r *CNIRolloutReconciler) podsWithoutCNI(ctx context.Context, namespaces []string) (int32, error) {
+	var podsWithoutCNI int32
+
+	for _, namespace := range namespaces {
+		var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+		if err := r.List(ctx, attachDefinitions, client.InNamespace(namespace)); err != nil {
+			return 0, err
+		}
+
+		for i := range attachDefinitions.Items {
+			podsWithoutCNI += attachDefinitions.Items[i].Status.PodsWithoutCNI
+		}
+	}
+
+	return podsWithoutCNI, nil
+}
+
+// rolloutWaves - returns the cumulative number of updated Namespaces after every wave. The canary wave
+// is the first one if there are canaries, the steps are percentages of the other Namespaces
+// and the last wave updates all Namespaces.
+func rolloutWaves(steps []cniv1alpha1.RolloutStep, canaries, total int) []int {
+	var (
+		waves  []int
+		others = total - canaries
+	)
+
+	if canaries != 0 {
+		waves = append(waves, canaries)
+	}
+
+	for _, step := range steps {
+		// Rounded up, so every step updates at least one Namespace.
+		var updated = canaries + (others*int(step)+99)/100
+
+		if len(waves) != 0 && updated <= waves[len(waves)-1] {
+			continue
+		}
+
+		waves = append(waves, updated)
+	}
+
+	if len(waves) == 0 || waves[len(waves)-1] != total {
+		waves = append(waves, total)
+	}
+
+	return waves
+}
+
+// mergeNamespaces - returns the sorted union of the Namespaces, the updated Namespaces stay updated
+// even if the rollout order changes.
+func mergeNamespaces(updated, namespaces []string) []string {
+	var (
+		merged []string
+		seen   = map[string]bool{}
+	)
+
+	for _, namespace := range append(append([]string{}, updated...), namespaces...) {
+		if !seen[namespace] {
+			seen[namespace] = true
+			merged = append(merged, namespace)
+		}
+	}
+
+	sort.Strings(merged)
+
+	return merged
+}
+
+// resetRolloutTarget - marks the rollout as completed, all Namespaces use the stable configuration.
+func resetRolloutTarget(status *cniv1alpha1.CNIRolloutStatus) {
+	status.Phase = cniv1alpha1.RolloutPhaseCompleted
+	status.TargetConfig, status.TargetResourceVersion = "", ""
+	status.CurrentWave = 0
+	status.WaveStartTime = nil
+	status.UpdatedNamespaces = nil
+}
+
+// newRolloutHealthyCondition - reports whether the updated Namespaces have more Pods without Linkerd CNI
+// network than the rollout tolerates.
+func newRolloutHealthyCondition(podsWithoutCNI, maxPodsWithoutCNI int32) metav1.Condition {
+	if podsWithoutCNI > maxPodsWithoutCNI {
+		return metav1.Condition{
+			Type:   cniv1alpha1.ConditionRolloutHealthy,
+			Status: metav1.ConditionFalse,
+			Reason: "PodsWithoutCNI",
+			Message: fmt.Sprintf("%d meshed Pods in the updated Namespaces have no Linkerd CNI network, "+
+				"at most %d are tolerated", podsWithoutCNI, maxPodsWithoutCNI),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    cniv1alpha1.ConditionRolloutHealthy,
+		Status:  metav1.ConditionTrue,
+		Reason:  "CNIAttached",
+		Message: fmt.Sprintf("%d meshed Pods in the updated Namespaces have no Linkerd CNI network", podsWithoutCNI),
+	}
+}
+
+func setRolloutCondition(status *cniv1alpha1.CNIRolloutStatus, rollout *cniv1alpha1.CNIRollout,
+	condition metav1.Condition) {
+	condition.ObservedGeneration = rollout.Generation
+
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// instanceRollout - returns the CNIRollout used by the operator instance or nil if there is none.
+// If several CNIRollouts belong to the instance, the first one by name is used.
+func instanceRollout(ctx context.Context, c client.Reader, instance string) (*cniv1alpha1.CNIRollout, error) {
+	var rollouts = &cniv1alpha1.CNIRolloutList{}
+
+	if err := c.List(ctx, rollouts); err != nil {
+		return nil, err
+	}
+
+	var used *cniv1alpha1.CNIRollout
+
+	for i := range rollouts.Items {
+		var rollout = &rollouts.Items[i]
+
+		if !IsInstance(InstanceOf(rollout.Labels, constants.DefaultInstanceName), instance) {
+			continue
+		}
+
+		if used == nil || rollout.Name < used.Name {
+			used = rollout
+		}
+	}
+
+	return used, nil
+}
+
+// rolloutConfigMap - returns the Linkerd CNI ConfigMap with the configuration which the CNIRollout
+// assigns to the Namespace: the target one in the updated Namespaces and the stable one elsewhere.
+// Without a rollout, the ConfigMap is returned as is.
+func rolloutConfigMap(rollout *cniv1alpha1.CNIRollout, namespace string, cmRef CNIConfigMapRef,
+	cniConfigMap *corev1.ConfigMap) *corev1.ConfigMap {
+	if rollout == nil || rollout.Status.StableConfig == "" {
+		return cniConfigMap
+	}
+
+	var config, resourceVersion = rollout.Status.StableConfig, rollout.Status.StableResourceVersion
+
+	if rollout.Status.Phase != cniv1alpha1.RolloutPhaseCompleted &&
+		containsString(rollout.Status.UpdatedNamespaces, namespace) {
+		config, resourceVersion = rollout.Status.TargetConfig, rollout.Status.TargetResourceVersion
+	}
+
+	if config == cniConfigMap.Data[cmRef.Key] {
+		return cniConfigMap
+	}
+
+	var assigned = cniConfigMap.DeepCopy()
+
+	assigned.ResourceVersion = resourceVersion
+
+	if assigned.Data == nil {
+		assigned.Data = map[string]string{}
+	}
+
+	assigned.Data[cmRef.Key] = config
+
+	return assigned
+}
+
+// usesCNISource - checks if the AttachDefinition renders its own Linkerd CNI ConfigMap
+// instead of the operator's one.
+func usesCNISource(ldAttach *cniv1alpha1.AttachDefinition) bool {
+	return ldAttach.Spec.CNISource != nil && ldAttach.Spec.CNISource.ConfigMap != nil
+}
+
+// configuredCNIConfigMapRef - returns the operator's Linkerd CNI ConfigMap reference, the operator
+// configuration, if set, overrides the reference.
+func configuredCNIConfigMapRef(cmRef CNIConfigMapRef, config *operatorconfig.Store) CNIConfigMapRef {
+	if config == nil {
+		return cmRef
+	}
+
+	var cfg = config.Get()
+
+	return CNIConfigMapRef{
+		ObjectKey: client.ObjectKey{Namespace: cfg.CNIConfigMap.Namespace, Name: cfg.CNIConfigMap.Name},
+		Key:       cfg.CNIConfigMap.Key,
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+func TestRolloutWaves(t *testing.T) {
+	var defaultSteps = []cniv1alpha1.RolloutStep{25, 50, 100}
+
+	var tests = []struct {
+		name     string
+		steps    []cniv1alpha1.RolloutStep
+		canaries int
+		total    int
+		want     []int
+	}{
+		{
+			name:  "no namespaces",
+			steps: defaultSteps,
+			want:  []int{0},
+		},
+		{
+			name:  "steps are rounded up",
+			steps: defaultSteps,
+			total: 10,
+			want:  []int{3, 5, 10},
+		},
+		{
+			name:     "canary wave first",
+			steps:    defaultSteps,
+			canaries: 2,
+			total:    10,
+			want:     []int{2, 4, 6, 10},
+		},
+		{
+			name:  "steps updating no new namespaces are skipped",
+			steps: defaultSteps,
+			total: 2,
+			want:  []int{1, 2},
+		},
+		{
+			name:  "last step is treated as 100",
+			steps: []cniv1alpha1.RolloutStep{10, 50},
+			total: 4,
+			want:  []int{1, 2, 4},
+		},
+		{
+			name:     "only canaries",
+			steps:    defaultSteps,
+			canaries: 3,
+			total:    3,
+			want:     []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolloutWaves(tt.steps, tt.canaries, tt.total); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rolloutWaves() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutConfigMap(t *testing.T) {
+	var cmRef = CNIConfigMapRef{Key: "cni_network_config"}
+
+	var newConfigMap = func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "linkerd-cni-config", ResourceVersion: "3"},
+			Data:       data,
+		}
+	}
+
+	var newRollout = func(phase cniv1alpha1.RolloutPhase) *cniv1alpha1.CNIRollout {
+		return &cniv1alpha1.CNIRollout{
+			Status: cniv1alpha1.CNIRolloutStatus{
+				Phase:                 phase,
+				StableConfig:          "stable",
+				StableResourceVersion: "1",
+				TargetConfig:          "target",
+				TargetResourceVersion: "2",
+				UpdatedNamespaces:     []string{"updated"},
+			},
+		}
+	}
+
+	var tests = []struct {
+		name                string
+		rollout             *cniv1alpha1.CNIRollout
+		namespace           string
+		data                map[string]string
+		wantConfig          string
+		wantResourceVersion string
+	}{
+		{
+			name:                "no rollout",
+			namespace:           "updated",
+			data:                map[string]string{cmRef.Key: "target"},
+			wantConfig:          "target",
+			wantResourceVersion: "3",
+		},
+		{
+			name:                "updated namespace gets the target configuration",
+			rollout:             newRollout(cniv1alpha1.RolloutPhaseProgressing),
+			namespace:           "updated",
+			data:                map[string]string{cmRef.Key: "target"},
+			wantConfig:          "target",
+			wantResourceVersion: "3",
+		},
+		{
+			name:                "other namespace keeps the stable configuration",
+			rollout:             newRollout(cniv1alpha1.RolloutPhaseProgressing),
+			namespace:           "other",
+			data:                map[string]string{cmRef.Key: "target"},
+			wantConfig:          "stable",
+			wantResourceVersion: "1",
+		},
+		{
+			name:                "paused rollout keeps the updated namespaces",
+			rollout:             newRollout(cniv1alpha1.RolloutPhasePaused),
+			namespace:           "updated",
+			data:                map[string]string{cmRef.Key: "next"},
+			wantConfig:          "target",
+			wantResourceVersion: "2",
+		},
+		{
+			name:                "completed rollout uses the stable configuration",
+			rollout:             newRollout(cniv1alpha1.RolloutPhaseCompleted),
+			namespace:           "updated",
+			data:                map[string]string{cmRef.Key: "next"},
+			wantConfig:          "stable",
+			wantResourceVersion: "1",
+		},
+		{
+			name:                "configmap without data",
+			rollout:             newRollout(cniv1alpha1.RolloutPhaseProgressing),
+			namespace:           "other",
+			wantConfig:          "stable",
+			wantResourceVersion: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cniConfigMap = newConfigMap(tt.data)
+			var original = cniConfigMap.DeepCopy()
+
+			var got = rolloutConfigMap(tt.rollout, tt.namespace, cmRef, cniConfigMap)
+
+			if got.Data[cmRef.Key] != tt.wantConfig {
+				t.Errorf("config = %q, want %q", got.Data[cmRef.Key], tt.wantConfig)
+			}
+
+			if got.ResourceVersion != tt.wantResourceVersion {
+				t.Errorf("resourceVersion = %q, want %q", got.ResourceVersion, tt.wantResourceVersion)
+			}
+
+			if !reflect.DeepEqual(cniConfigMap, original) {
+				t.Errorf("the Linkerd CNI ConfigMap is modified: %+v", cniConfigMap)
+			}
+		})
+	}
+}
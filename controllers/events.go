@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorderName - name of the operator as the source of Events.
+const EventRecorderName = "linkerd-cni-attach-operator"
+
+// NamespaceReference - returns a reference to a Namespace for Events. The Event is stored
+// in the Namespace itself, so its users can list it without cluster-wide permissions.
+func NamespaceReference(name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: name, Namespace: name}
+}
+
+// ControllerReference - returns a reference to the controller of an object, for example,
+// a ReplicaSet of a Pod, or nil if the object is not controlled.
+func ControllerReference(obj metav1.Object) *corev1.ObjectReference {
+	var owner = metav1.GetControllerOf(obj)
+	if owner == nil {
+		return nil
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+		Namespace:  obj.GetNamespace(),
+	}
+}
+
+// RecordEvent - records an Event if the recorder is set, command-line tools run reconcilers without it.
+func RecordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestControllerReference(t *testing.T) {
+	var isController = true
+
+	var tests = []struct {
+		name   string
+		owners []metav1.OwnerReference
+		want   *corev1.ObjectReference
+	}{
+		{
+			name: "controlled Pod",
+			owners: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "web-config", UID: "configmap-uid"},
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d4f", UID: "replicaset-uid", Controller: &isController},
+			},
+			want: &corev1.ObjectReference{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d4f", UID: "replicaset-uid", Namespace: "app",
+			},
+		},
+		{
+			name:   "owned, but not controlled Pod",
+			owners: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "web-config"}},
+		},
+		{
+			name: "standalone Pod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web-0", OwnerReferences: tt.owners}}
+
+			if got := ControllerReference(pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ControllerReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordEvent(t *testing.T) {
+	var recorder = record.NewFakeRecorder(1)
+
+	// Command-line tools run without a recorder.
+	RecordEvent(nil, NamespaceReference("app"), corev1.EventTypeNormal, "Created", "created %s", "linkerd-cni")
+
+	RecordEvent(recorder, NamespaceReference("app"), corev1.EventTypeWarning, "PolicyViolation", "rejected by %s", "restricted")
+
+	select {
+	case event := <-recorder.Events:
+		if want := "Warning PolicyViolation rejected by restricted"; event != want {
+			t.Errorf("event = %q, want %q", event, want)
+		}
+	default:
+		t.Error("event is not recorded")
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// findRevision - returns the revision from the AttachDefinition's history or nil if it is not kept.
+func findRevision(ldAttach *cniv1alpha1.AttachDefinition, revision int64) *cniv1alpha1.RenderedRevision {
+	for i := range ldAttach.Status.History {
+		if ldAttach.Status.History[i].Revision == revision {
+			return &ldAttach.Status.History[i]
+		}
+	}
+
+	return nil
+}
+
+// parseRevisionConfig - parses the CNI configuration of a revision.
+func parseRevisionConfig(revision *cniv1alpha1.RenderedRevision) (*CNIPluginConf, error) {
+	var cniConfig = newCNIPluginConf()
+
+	if err := json.Unmarshal([]byte(revision.Config), cniConfig); err != nil {
+		return nil, fmt.Errorf("can not parse the CNI configuration of revision %d: %w", revision.Revision, err)
+	}
+
+	return cniConfig, nil
+}
+
+// renderRevision - renders the NetworkAttachmentDefinition pinned to the spec.rollbackTo revision.
+func renderRevision(ldAttach *cniv1alpha1.AttachDefinition) (*netattachv1.NetworkAttachmentDefinition,
+	*cniv1alpha1.RenderedRevision, error) {
+	var revision = findRevision(ldAttach, *ldAttach.Spec.RollbackTo)
+	if revision == nil {
+		return nil, nil, fmt.Errorf("revision %d is not in the history", *ldAttach.Spec.RollbackTo)
+	}
+
+	cniConfig, err := parseRevisionConfig(revision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var multusRef = client.ObjectKey{
+		Namespace: ldAttach.Namespace,
+		Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
+	}
+
+	multusNetAttach, err := newMultusNetworkAttachDefinition(multusRef, cniConfig, &Provenance{
+		AttachDefinitionGeneration:  revision.AttachDefinitionGeneration,
+		CNIConfigMapResourceVersion: revision.CNIConfigMapResourceVersion,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return multusNetAttach, revision, nil
+}
+
+// revisionSpec - returns the AttachDefinition spec which renders the revision's configuration over the defaults,
+// so AttachDefinitionPolicies check a rollback like a spec. Without the defaults every value of the revision is set.
+func revisionSpec(cniConfig, defaults *CNIPluginConf) *cniv1alpha1.AttachDefinitionSpec {
+	if defaults == nil {
+		defaults = &CNIPluginConf{}
+	}
+
+	var (
+		proxy = cniConfig.Linkerd
+		args  = map[string]interface{}{
+			CNIArgInboundPortsToIgnore:  addedStrings(proxy.InboundPortsToIgnore, defaults.Linkerd.InboundPortsToIgnore),
+			CNIArgOutboundPortsToIgnore: addedStrings(proxy.OutboundPortsToIgnore, defaults.Linkerd.OutboundPortsToIgnore),
+		}
+	)
+
+	if proxy.IncomingProxyPort != 0 && proxy.IncomingProxyPort != defaults.Linkerd.IncomingProxyPort {
+		args[CNIArgIncomingProxyPort] = proxy.IncomingProxyPort
+	}
+
+	if proxy.OutgoingProxyPort != 0 && proxy.OutgoingProxyPort != defaults.Linkerd.OutgoingProxyPort {
+		args[CNIArgOutgoingProxyPort] = proxy.OutgoingProxyPort
+	}
+
+	if proxy.ProxyUID != 0 && proxy.ProxyUID != defaults.Linkerd.ProxyUID {
+		args[CNIArgProxyUID] = proxy.ProxyUID
+	}
+
+	var spec = CNIArgsSpec(args)
+
+	if cniConfig.LogLevel != defaults.LogLevel {
+		spec.Config.LogLevel = cniConfig.LogLevel
+	}
+
+	return spec
+}
+
+// addedStrings - returns the values which are not in the defaults.
+func addedStrings(values, defaults []string) []string {
+	var added []string
+
+	for _, value := range values {
+		if !containsString(defaults, value) {
+			added = append(added, value)
+		}
+	}
+
+	return added
+}
+
+// newRolledBackCondition - reports the revision which the NetworkAttachmentDefinition is pinned to.
+func newRolledBackCondition(ldAttach *cniv1alpha1.AttachDefinition, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    cniv1alpha1.ConditionRolledBack,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RevisionUnavailable",
+			Message: err.Error() + ", the NetworkAttachmentDefinition is not changed",
+		}
+	}
+
+	return metav1.Condition{
+		Type:    cniv1alpha1.ConditionRolledBack,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Pinned",
+		Message: fmt.Sprintf("NetworkAttachmentDefinition is pinned to revision %d", *ldAttach.Spec.RollbackTo),
+	}
+}
+
+// revisionHistoryLimit - returns the number of revisions kept in the AttachDefinition's history.
+func revisionHistoryLimit(ldAttach *cniv1alpha1.AttachDefinition) int {
+	if ldAttach.Spec.RevisionHistoryLimit == nil {
+		return cniv1alpha1.DefaultRevisionHistoryLimit
+	}
+
+	return int(*ldAttach.Spec.RevisionHistoryLimit)
+}
+
+// recordRevision - adds the NetworkAttachmentDefinition's configuration to the AttachDefinition's history
+// if it differs from the current revision. An empty trigger is derived from the provenance annotations.
+func (r *AttachDefinitionReconciler) recordRevision(ctx context.Context, ldAttach *cniv1alpha1.AttachDefinition,
+	multusNetAttach *netattachv1.NetworkAttachmentDefinition, trigger string) error {
+	logger := log.FromContext(ctx).WithValues("AttachDefinition", ldAttach.Namespace+"/"+ldAttach.Name)
+
+	var (
+		history = ldAttach.Status.History
+		limit   = revisionHistoryLimit(ldAttach)
+		current *cniv1alpha1.RenderedRevision
+	)
+
+	// The history is disabled, only the kept revisions are removed.
+	if limit == 0 {
+		if len(history) == 0 {
+			return nil
+		}
+
+		ldAttach.Status.History = nil
+
+		return r.Status().Update(ctx, ldAttach)
+	}
+
+	if len(history) != 0 {
+		current = &history[len(history)-1]
+	}
+
+	if current != nil && current.Config == multusNetAttach.Spec.Config {
+		return nil
+	}
+
+	var revision = cniv1alpha1.RenderedRevision{
+		Revision:                    ldAttach.Status.CurrentRevision + 1,
+		Config:                      multusNetAttach.Spec.Config,
+		Trigger:                     trigger,
+		CNIConfigMapResourceVersion: multusNetAttach.Annotations[constants.CNIConfigMapResourceVersionAnnotation],
+		Time:                        metav1.Now(),
+	}
+
+	revision.AttachDefinitionGeneration, _ = strconv.ParseInt(
+		multusNetAttach.Annotations[constants.AttachDefinitionGenerationAnnotation], 10, 64)
+
+	if revision.Trigger == "" {
+		revision.Trigger = revisionTrigger(ldAttach, current, &revision)
+	}
+
+	history = append(history, revision)
+
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+
+	ldAttach.Status.History = history
+	ldAttach.Status.CurrentRevision = revision.Revision
+
+	if err := r.Status().Update(ctx, ldAttach); err != nil {
+		logger.Error(err, "can not record rendered revision", "revision", revision.Revision)
+
+		return err
+	}
+
+	return nil
+}
+
+// revisionTrigger - describes what changed since the previous revision.
+func revisionTrigger(ldAttach *cniv1alpha1.AttachDefinition,
+	previous, revision *cniv1alpha1.RenderedRevision) string {
+	switch {
+	case previous == nil:
+		return "NetworkAttachmentDefinition is created"
+	case previous.AttachDefinitionGeneration != revision.AttachDefinitionGeneration:
+		var trigger = fmt.Sprintf("AttachDefinition generation %d", revision.AttachDefinitionGeneration)
+
+		if manager := specManager(ldAttach); manager != "" {
+			trigger += " by " + manager
+		}
+
+		return trigger
+	case previous.CNIConfigMapResourceVersion != revision.CNIConfigMapResourceVersion:
+		return "Linkerd CNI ConfigMap resourceVersion " + revision.CNIConfigMapResourceVersion
+	default:
+		return "skipped Services, linkerd-config or operator configuration"
+	}
+}
+
+// specManager - returns the field manager which changed the AttachDefinition most recently,
+// status updates are ignored.
+func specManager(ldAttach *cniv1alpha1.AttachDefinition) string {
+	var (
+		manager string
+		latest  *metav1.Time
+	)
+
+	for i := range ldAttach.ManagedFields {
+		var entry = &ldAttach.ManagedFields[i]
+
+		if entry.Subresource != "" || entry.Time == nil {
+			continue
+		}
+
+		if latest == nil || !entry.Time.Before(latest) {
+			manager, latest = entry.Manager, entry.Time
+		}
+	}
+
+	return manager
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// historyOf - revisions with the numbers, the CNI configuration of each one is its number.
+func historyOf(revisions ...int64) []cniv1alpha1.RenderedRevision {
+	var history = make([]cniv1alpha1.RenderedRevision, 0, len(revisions))
+
+	for _, revision := range revisions {
+		history = append(history, cniv1alpha1.RenderedRevision{Revision: revision, Config: configOf(revision)})
+	}
+
+	return history
+}
+
+// configOf - a CNI configuration which differs for every revision.
+func configOf(revision int64) string {
+	var cfg = newTestCNIPluginConf()
+
+	cfg.Linkerd.ProxyUID = int(revision)
+
+	raw, _ := json.Marshal(cfg)
+
+	return string(raw)
+}
+
+func revisionNumbers(history []cniv1alpha1.RenderedRevision) []int64 {
+	var numbers []int64
+
+	for i := range history {
+		numbers = append(numbers, history[i].Revision)
+	}
+
+	return numbers
+}
+
+func TestRecordRevision(t *testing.T) {
+	var limitTwo, limitThree, disabled = int32(2), int32(3), int32(0)
+
+	var tests = []struct {
+		name        string
+		history     []int64
+		limit       *int32
+		config      string
+		trigger     string
+		want        []int64
+		wantTrigger string
+	}{
+		{
+			name:        "first revision",
+			config:      configOf(1),
+			want:        []int64{1},
+			wantTrigger: "NetworkAttachmentDefinition is created",
+		},
+		{
+			name:    "same configuration is not recorded",
+			history: []int64{1, 2},
+			config:  configOf(2),
+			want:    []int64{1, 2},
+		},
+		{
+			name:        "configuration returns to an older revision",
+			history:     []int64{1, 2},
+			config:      configOf(1),
+			want:        []int64{1, 2, 3},
+			trigger:     "test",
+			wantTrigger: "test",
+		},
+		{
+			name:        "oldest revision is trimmed",
+			history:     []int64{1, 2, 3},
+			limit:       &limitThree,
+			config:      configOf(4),
+			want:        []int64{2, 3, 4},
+			trigger:     "test",
+			wantTrigger: "test",
+		},
+		{
+			name:        "history is trimmed to a lowered limit",
+			history:     []int64{1, 2, 3, 4, 5},
+			limit:       &limitTwo,
+			config:      configOf(6),
+			want:        []int64{5, 6},
+			trigger:     "test",
+			wantTrigger: "test",
+		},
+		{
+			name:    "history is disabled",
+			history: []int64{1, 2},
+			limit:   &disabled,
+			config:  configOf(3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ldAttach = &cniv1alpha1.AttachDefinition{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+				Spec:       cniv1alpha1.AttachDefinitionSpec{RevisionHistoryLimit: tt.limit},
+				Status:     cniv1alpha1.AttachDefinitionStatus{History: historyOf(tt.history...)},
+			}
+
+			if len(tt.history) != 0 {
+				ldAttach.Status.CurrentRevision = tt.history[len(tt.history)-1]
+			}
+
+			var r = reconcilerWith(t, ldAttach)
+
+			var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{
+				Spec: netattachv1.NetworkAttachmentDefinitionSpec{Config: tt.config},
+			}
+
+			if err := r.recordRevision(context.Background(), ldAttach, multusNetAttach, tt.trigger); err != nil {
+				t.Fatalf("recordRevision() error = %v", err)
+			}
+
+			var stored = &cniv1alpha1.AttachDefinition{}
+
+			if err := r.Get(context.Background(), client.ObjectKeyFromObject(ldAttach), stored); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := revisionNumbers(stored.Status.History); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("history = %v, want %v", got, tt.want)
+			}
+
+			if tt.wantTrigger == "" {
+				return
+			}
+
+			var current = stored.Status.History[len(stored.Status.History)-1]
+
+			if current.Config != tt.config || current.Trigger != tt.wantTrigger ||
+				stored.Status.CurrentRevision != current.Revision {
+				t.Errorf("current revision = %d with trigger %q, currentRevision = %d, want the recorded configuration with trigger %q",
+					current.Revision, current.Trigger, stored.Status.CurrentRevision, tt.wantTrigger)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var tests = []struct {
+		name string
+		// current - the revision of the existing NetworkAttachmentDefinition, 0 if it does not exist.
+		current    int64
+		rollbackTo int64
+		wantStatus metav1.ConditionStatus
+		// wantConfig - the revision of the NetworkAttachmentDefinition after the rollback, 0 if it does not exist.
+		wantConfig  int64
+		wantHistory []int64
+		wantTrigger string
+		// policy - if set, an AttachDefinitionPolicy which allows proxy UIDs 2-3 is created.
+		policy bool
+		// cniProxyUID - if set, the proxy UID of the Linkerd CNI ConfigMap, 0 if the ConfigMap does not exist.
+		cniProxyUID   int
+		wantCompliant metav1.ConditionStatus
+	}{
+		{
+			name:        "NetworkAttachmentDefinition is updated to the revision",
+			current:     3,
+			rollbackTo:  2,
+			wantStatus:  metav1.ConditionTrue,
+			wantConfig:  2,
+			wantHistory: []int64{1, 2, 3, 4},
+			wantTrigger: "rollback to revision 2",
+		},
+		{
+			name:        "missing NetworkAttachmentDefinition is created from the revision",
+			rollbackTo:  1,
+			wantStatus:  metav1.ConditionTrue,
+			wantConfig:  1,
+			wantHistory: []int64{1, 2, 3, 4},
+			wantTrigger: "rollback to revision 1",
+		},
+		{
+			name:        "revision is not kept",
+			current:     3,
+			rollbackTo:  7,
+			wantStatus:  metav1.ConditionFalse,
+			wantConfig:  3,
+			wantHistory: []int64{1, 2, 3},
+		},
+		{
+			name:        "missing NetworkAttachmentDefinition is not created without the revision",
+			rollbackTo:  7,
+			wantStatus:  metav1.ConditionFalse,
+			wantHistory: []int64{1, 2, 3},
+		},
+		{
+			name:          "revision which violates a policy is not applied",
+			current:       3,
+			rollbackTo:    1,
+			wantStatus:    metav1.ConditionFalse,
+			wantConfig:    3,
+			wantHistory:   []int64{1, 2, 3},
+			policy:        true,
+			wantCompliant: metav1.ConditionFalse,
+		},
+		{
+			name:          "revision which complies with a policy is applied",
+			current:       3,
+			rollbackTo:    2,
+			wantStatus:    metav1.ConditionTrue,
+			wantConfig:    2,
+			wantHistory:   []int64{1, 2, 3, 4},
+			wantTrigger:   "rollback to revision 2",
+			policy:        true,
+			wantCompliant: metav1.ConditionTrue,
+		},
+		{
+			name:          "revision value of the Linkerd CNI defaults is not checked",
+			current:       3,
+			rollbackTo:    1,
+			wantStatus:    metav1.ConditionTrue,
+			wantConfig:    1,
+			wantHistory:   []int64{1, 2, 3, 4},
+			wantTrigger:   "rollback to revision 1",
+			policy:        true,
+			cniProxyUID:   1,
+			wantCompliant: metav1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ldAttach = &cniv1alpha1.AttachDefinition{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+				Spec:       cniv1alpha1.AttachDefinitionSpec{RollbackTo: &tt.rollbackTo},
+				Status: cniv1alpha1.AttachDefinitionStatus{
+					History:         historyOf(1, 2, 3),
+					CurrentRevision: 3,
+				},
+			}
+
+			var objects = []client.Object{ldAttach}
+
+			if tt.current != 0 {
+				objects = append(objects, &netattachv1.NetworkAttachmentDefinition{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+					Spec:       netattachv1.NetworkAttachmentDefinitionSpec{Config: configOf(tt.current)},
+				})
+			}
+
+			if tt.policy {
+				objects = append(objects, &cniv1alpha1.AttachDefinitionPolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "allow-uids"},
+					Spec: cniv1alpha1.AttachDefinitionPolicySpec{
+						ProxyUIDs: &cniv1alpha1.UIDRestriction{Allowed: []cniv1alpha1.UIDRange{{Min: 2, Max: 3}}},
+					},
+				})
+			}
+
+			if tt.cniProxyUID != 0 {
+				objects = append(objects, linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, tt.cniProxyUID))
+			}
+
+			var r = reconcilerWith(t, objects...)
+
+			r.CNIConfigMapRef = CNIConfigMapRef{
+				ObjectKey: client.ObjectKey{
+					Namespace: constants.DefaultLinkerdCNICMNamespace,
+					Name:      constants.DefaultLinkerdCNICMName,
+				},
+				Key: constants.DefaultLinkerdCNICMKey,
+			}
+
+			if err := r.rollback(context.Background(), ldAttach, constants.DefaultInstanceName); err != nil {
+				t.Fatalf("rollback() error = %v", err)
+			}
+
+			var stored = &cniv1alpha1.AttachDefinition{}
+
+			if err := r.Get(context.Background(), client.ObjectKeyFromObject(ldAttach), stored); err != nil {
+				t.Fatal(err)
+			}
+
+			if condition := meta.FindStatusCondition(stored.Status.Conditions, cniv1alpha1.ConditionRolledBack); condition == nil ||
+				condition.Status != tt.wantStatus {
+				t.Errorf("RolledBack condition = %v, want status %s", condition, tt.wantStatus)
+			}
+
+			if tt.wantCompliant != "" {
+				if condition := meta.FindStatusCondition(stored.Status.Conditions, cniv1alpha1.ConditionPolicyCompliant); condition == nil ||
+					condition.Status != tt.wantCompliant {
+					t.Errorf("PolicyCompliant condition = %v, want status %s", condition, tt.wantCompliant)
+				}
+			}
+
+			if got := revisionNumbers(stored.Status.History); !reflect.DeepEqual(got, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", got, tt.wantHistory)
+			}
+
+			if tt.wantTrigger != "" {
+				if got := stored.Status.History[len(stored.Status.History)-1].Trigger; got != tt.wantTrigger {
+					t.Errorf("trigger = %q, want %q", got, tt.wantTrigger)
+				}
+			}
+
+			var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{}
+
+			err := r.Get(context.Background(), client.ObjectKeyFromObject(ldAttach), multusNetAttach)
+
+			switch {
+			case tt.wantConfig == 0 && !apierrors.IsNotFound(err):
+				t.Errorf("NetworkAttachmentDefinition get error = %v, want it not to exist", err)
+			case tt.wantConfig != 0 && err != nil:
+				t.Fatal(err)
+			case tt.wantConfig != 0 && multusNetAttach.Spec.Config != configOf(tt.wantConfig):
+				t.Errorf("NetworkAttachmentDefinition config = %s, want the one of revision %d",
+					multusNetAttach.Spec.Config, tt.wantConfig)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+// InstanceOf - returns the operator instance which owns an object with the labels.
+// If the object is not labelled, it belongs to the parent's instance.
+func InstanceOf(labels map[string]string, parent string) string {
+	if instance := labels[constants.InstanceLabel]; instance != "" {
+		return instance
+	}
+
+	return parent
+}
+
+// NamespaceInstance - returns the operator instance which owns the Namespace.
+func NamespaceInstance(namespace *corev1.Namespace) string {
+	return InstanceOf(namespace.Labels, constants.DefaultInstanceName)
+}
+
+// IsInstance - checks if the instance name is the operator's one, empty operator's name means the default instance.
+func IsInstance(instance, operatorInstance string) bool {
+	if operatorInstance == "" {
+		operatorInstance = constants.DefaultInstanceName
+	}
+
+	return instance == operatorInstance
+}
+
+// GetNamespace - gets a Namespace. If the operator is not permitted to read it, for example, when it runs
+// with namespaced Roles, the Namespace is returned without labels and annotations, so it belongs
+// to the default instance and does not request Linkerd proxy injection.
+func GetNamespace(ctx context.Context, c client.Reader, name string) (*corev1.Namespace, error) {
+	var namespace = &corev1.Namespace{}
+
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, namespace); err != nil {
+		if !apierrors.IsForbidden(err) {
+			return nil, err
+		}
+
+		log.FromContext(ctx).V(1).Info("Namespace read is not permitted, use a Namespace without labels and annotations",
+			"namespace", name)
+
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+
+	return namespace, nil
+}
+
+// getNamespaceInstance - returns the operator instance which owns the Namespace by its name.
+// A deleted Namespace belongs to the default instance.
+func getNamespaceInstance(ctx context.Context, c client.Reader, namespace string) (string, error) {
+	ns, err := GetNamespace(ctx, c, namespace)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return constants.DefaultInstanceName, nil
+		}
+
+		return "", err
+	}
+
+	return NamespaceInstance(ns), nil
+}
+
+// setInstanceLabel - assigns the object to the operator instance.
+func setInstanceLabel(obj client.Object, instance string) {
+	var labels = obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[constants.InstanceLabel] = instance
+
+	obj.SetLabels(labels)
+}
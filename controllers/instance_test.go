@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+func TestInstanceOf(t *testing.T) {
+	var tests = []struct {
+		name   string
+		labels map[string]string
+		parent string
+		want   string
+	}{
+		{
+			name:   "labelled",
+			labels: map[string]string{constants.InstanceLabel: "canary"},
+			parent: constants.DefaultInstanceName,
+			want:   "canary",
+		},
+		{
+			name:   "parent's instance",
+			parent: "canary",
+			want:   "canary",
+		},
+		{
+			name:   "empty label",
+			labels: map[string]string{constants.InstanceLabel: ""},
+			parent: constants.DefaultInstanceName,
+			want:   constants.DefaultInstanceName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InstanceOf(tt.labels, tt.parent); got != tt.want {
+				t.Errorf("InstanceOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInstance(t *testing.T) {
+	var tests = []struct {
+		instance         string
+		operatorInstance string
+		want             bool
+	}{
+		{instance: "canary", operatorInstance: "canary", want: true},
+		{instance: constants.DefaultInstanceName, operatorInstance: "", want: true},
+		{instance: "canary", operatorInstance: ""},
+		{instance: constants.DefaultInstanceName, operatorInstance: "canary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.instance+"/"+tt.operatorInstance, func(t *testing.T) {
+			if got := IsInstance(tt.instance, tt.operatorInstance); got != tt.want {
+				t.Errorf("IsInstance(%q, %q) = %t, want %t", tt.instance, tt.operatorInstance, got, tt.want)
+			}
+		})
+	}
+}
+
+// forbiddenReader - a client.Reader which is not permitted to read anything.
+type forbiddenReader struct {
+	client.Reader
+}
+
+func (forbiddenReader) Get(_ context.Context, key client.ObjectKey, _ client.Object) error {
+	return apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, key.Name, errors.New("namespaced Role"))
+}
+
+func TestGetNamespaceInstance(t *testing.T) {
+	var canary = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "canary",
+		Labels: map[string]string{constants.InstanceLabel: "canary"},
+	}}
+
+	var tests = []struct {
+		name      string
+		reader    client.Reader
+		namespace string
+		want      string
+	}{
+		{
+			name:      "labelled Namespace",
+			reader:    fake.NewClientBuilder().WithObjects(canary).Build(),
+			namespace: "canary",
+			want:      "canary",
+		},
+		{
+			name: "Namespace without the label",
+			reader: fake.NewClientBuilder().WithObjects(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}},
+			).Build(),
+			namespace: "app",
+			want:      constants.DefaultInstanceName,
+		},
+		{
+			name:      "deleted Namespace",
+			reader:    fake.NewClientBuilder().Build(),
+			namespace: "app",
+			want:      constants.DefaultInstanceName,
+		},
+		{
+			name:      "Namespace read is not permitted",
+			reader:    forbiddenReader{},
+			namespace: "canary",
+			want:      constants.DefaultInstanceName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getNamespaceInstance(context.Background(), tt.reader, tt.namespace)
+			if err != nil {
+				t.Fatalf("getNamespaceInstance() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("getNamespaceInstance() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
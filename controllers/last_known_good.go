@@ -0,0 +1,218 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups="",namespace=system,resources=secrets,verbs=get;create;update
+
+// lastKnownGoodRequeueInterval - AttachDefinitions rendered from the last known good configuration
+// are reconciled periodically to notice that their CNI source is fixed.
+const lastKnownGoodRequeueInterval = time.Minute
+
+// LastKnownGood - stores the last successfully parsed configuration of every Linkerd CNI source
+// in an operator-owned Secret, so NetworkAttachmentDefinitions are still rendered while the source is invalid.
+type LastKnownGood struct {
+	// Client - reads and writes the Secret directly, the manager's cache does not watch Secrets.
+	Client client.Client
+	Secret client.ObjectKey
+
+	mu sync.Mutex
+	// saved - resourceVersions of the sources which are already stored in the Secret.
+	saved map[string]string
+}
+
+// lastKnownGoodEntry - a Secret data item, the raw source configuration and where it comes from.
+type lastKnownGoodEntry struct {
+	Namespace       string      `json:"namespace"`
+	Name            string      `json:"name"`
+	Key             string      `json:"key"`
+	ResourceVersion string      `json:"resourceVersion"`
+	SavedAt         metav1.Time `json:"savedAt"`
+	Config          string      `json:"config"`
+}
+
+// lastKnownGoodKey - returns the Secret data key of the CNI source. Namespaces and names
+// can not contain "_", so the key is unique.
+func lastKnownGoodKey(cmRef CNIConfigMapRef) string {
+	return cmRef.Namespace + "_" + cmRef.Name + "_" + cmRef.Key
+}
+
+// isCNISourceInvalid - checks if the CNI source error is caused by the source's content rather than
+// by the API server, so the last known good configuration can replace the source.
+func isCNISourceInvalid(err error) bool {
+	var syntaxErr *json.SyntaxError
+
+	var typeErr *json.UnmarshalTypeError
+
+	return apierrors.IsNotFound(err) || errors.Is(err, ErrCNIConfigMapKeyNotFound) ||
+		errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// Save - stores the source ConfigMap's configuration if its resourceVersion is not stored yet.
+func (s *LastKnownGood) Save(ctx context.Context, cmRef CNIConfigMapRef, cniConfigMap *corev1.ConfigMap) error {
+	var key = lastKnownGoodKey(cmRef)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saved != nil && s.saved[key] == cniConfigMap.ResourceVersion {
+		return nil
+	}
+
+	var secret = &corev1.Secret{}
+
+	err := s.Client.Get(ctx, s.Secret, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	var create = err != nil
+
+	if entry, err := decodeLastKnownGood(secret, key); err == nil && entry != nil &&
+		entry.ResourceVersion == cniConfigMap.ResourceVersion {
+		s.remember(key, entry.ResourceVersion)
+
+		return nil
+	}
+
+	raw, err := json.Marshal(&lastKnownGoodEntry{
+		Namespace:       cmRef.Namespace,
+		Name:            cmRef.Name,
+		Key:             cmRef.Key,
+		ResourceVersion: cniConfigMap.ResourceVersion,
+		SavedAt:         metav1.Now(),
+		Config:          cniConfigMap.Data[cmRef.Key],
+	})
+	if err != nil {
+		return err
+	}
+
+	if create {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.Secret.Namespace, Name: s.Secret.Name},
+			Type:       corev1.SecretTypeOpaque,
+		}
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+
+	secret.Data[key] = raw
+
+	if create {
+		err = s.Client.Create(ctx, secret)
+	} else {
+		err = s.Client.Update(ctx, secret)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.remember(key, cniConfigMap.ResourceVersion)
+
+	return nil
+}
+
+// Load - returns the last known good ConfigMap of the source with the stored configuration
+// and resourceVersion or nil if it is not stored.
+func (s *LastKnownGood) Load(ctx context.Context, cmRef CNIConfigMapRef) (*corev1.ConfigMap, error) {
+	var secret = &corev1.Secret{}
+
+	if err := s.Client.Get(ctx, s.Secret, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	entry, err := decodeLastKnownGood(secret, lastKnownGoodKey(cmRef))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       entry.Namespace,
+			Name:            entry.Name,
+			ResourceVersion: entry.ResourceVersion,
+		},
+		Data: map[string]string{entry.Key: entry.Config},
+	}, nil
+}
+
+func (s *LastKnownGood) remember(key, resourceVersion string) {
+	if s.saved == nil {
+		s.saved = map[string]string{}
+	}
+
+	s.saved[key] = resourceVersion
+}
+
+func decodeLastKnownGood(secret *corev1.Secret, key string) (*lastKnownGoodEntry, error) {
+	raw, ok := secret.Data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var entry = &lastKnownGoodEntry{}
+
+	if err := json.Unmarshal(raw, entry); err != nil {
+		return nil, fmt.Errorf("can not decode last known good configuration %s of Secret %s/%s: %w",
+			key, secret.Namespace, secret.Name, err)
+	}
+
+	return entry, nil
+}
+
+// newDegradedCondition - reports whether the NetworkAttachmentDefinition is rendered
+// from the last known good configuration because the CNI source is invalid.
+func newDegradedCondition(source *cniSourceStatus) metav1.Condition {
+	if source.Degraded != nil {
+		return metav1.Condition{
+			Type:   cniv1alpha1.ConditionDegraded,
+			Status: metav1.ConditionTrue,
+			Reason: "LastKnownGood",
+			Message: fmt.Sprintf("Linkerd CNI source is invalid, the last known good configuration "+
+				"of resourceVersion %s is used: %v", source.ConfigMap.ResourceVersion, source.Degraded),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    cniv1alpha1.ConditionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "SourceValid",
+		Message: "Linkerd CNI configuration is loaded from its source",
+	}
+}
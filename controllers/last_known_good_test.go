@@ -0,0 +1,261 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// lastKnownGoodSecret - the Secret which the tests store the last known good configurations in.
+var lastKnownGoodSecret = client.ObjectKey{Namespace: "linkerd-cni-attach-operator", Name: "last-known-good"}
+
+// operatorCNIConfigMapRef - the operator's Linkerd CNI ConfigMap key.
+var operatorCNIConfigMapRef = CNIConfigMapRef{
+	ObjectKey: client.ObjectKey{Namespace: constants.DefaultLinkerdCNICMNamespace, Name: constants.DefaultLinkerdCNICMName},
+	Key:       constants.DefaultLinkerdCNICMKey,
+}
+
+func TestIsCNISourceInvalid(t *testing.T) {
+	var configMaps = schema.GroupResource{Resource: "configmaps"}
+
+	var syntaxErr = json.Unmarshal([]byte("{"), &CNIPluginConf{})
+
+	var typeErr = json.Unmarshal([]byte(`{"linkerd": {"proxy-uid": "2102"}}`), &CNIPluginConf{})
+
+	var tests = []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "ConfigMap is deleted", err: apierrors.NewNotFound(configMaps, "linkerd-cni-config"), want: true},
+		{name: "key is missing", err: fmt.Errorf("%w: expected key %q", ErrCNIConfigMapKeyNotFound, "cni"), want: true},
+		{name: "invalid JSON", err: syntaxErr, want: true},
+		{name: "invalid field type", err: typeErr, want: true},
+		{name: "API server error", err: apierrors.NewForbidden(configMaps, "linkerd-cni-config", nil)},
+		{name: "source is not allowed", err: ErrCNISourceNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCNISourceInvalid(tt.err); got != tt.want {
+				t.Errorf("isCNISourceInvalid(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastKnownGoodSaveLoad(t *testing.T) {
+	var (
+		ctx           = context.Background()
+		kubeClient    = reconcilerWith(t).Client
+		lastKnownGood = &LastKnownGood{Client: kubeClient, Secret: lastKnownGoodSecret}
+		canaryRef     = operatorCNIConfigMapRef
+	)
+
+	canaryRef.Namespace = "linkerd-canary"
+
+	var save = func(cmRef CNIConfigMapRef, resourceVersion string, proxyUID int) {
+		t.Helper()
+
+		var cm = linkerdCNIConfigMap(cmRef.Namespace, proxyUID)
+		cm.ResourceVersion = resourceVersion
+
+		if err := lastKnownGood.Save(ctx, cmRef, cm); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	var load = func(cmRef CNIConfigMapRef) *corev1.ConfigMap {
+		t.Helper()
+
+		cm, err := lastKnownGood.Load(ctx, cmRef)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+
+		return cm
+	}
+
+	var secretVersion = func() string {
+		t.Helper()
+
+		var secret = &corev1.Secret{}
+		if err := kubeClient.Get(ctx, lastKnownGoodSecret, secret); err != nil {
+			t.Fatal(err)
+		}
+
+		return secret.ResourceVersion
+	}
+
+	if cm := load(operatorCNIConfigMapRef); cm != nil {
+		t.Fatalf("Load() without the Secret = %v, want nil", cm)
+	}
+
+	save(operatorCNIConfigMapRef, "1", 2102)
+
+	var stored = load(operatorCNIConfigMapRef)
+	if stored == nil || stored.ResourceVersion != "1" ||
+		stored.Data[constants.DefaultLinkerdCNICMKey] != linkerdCNIConfigMap("", 2102).Data[constants.DefaultLinkerdCNICMKey] {
+		t.Fatalf("Load() = %v, want the configuration of resourceVersion 1", stored)
+	}
+
+	if cm := load(canaryRef); cm != nil {
+		t.Fatalf("Load() of a source which is not stored = %v, want nil", cm)
+	}
+
+	// The same resourceVersion is not written again.
+	var version = secretVersion()
+
+	save(operatorCNIConfigMapRef, "1", 2102)
+
+	if got := secretVersion(); got != version {
+		t.Errorf("Secret is updated for a stored resourceVersion, resourceVersion %s -> %s", version, got)
+	}
+
+	save(canaryRef, "5", 2103)
+	save(operatorCNIConfigMapRef, "2", 2104)
+
+	if cm := load(operatorCNIConfigMapRef); cm == nil || cm.ResourceVersion != "2" {
+		t.Errorf("Load() = %v, want resourceVersion 2", cm)
+	}
+
+	if cm := load(canaryRef); cm == nil || cm.ResourceVersion != "5" || cm.Namespace != "linkerd-canary" {
+		t.Errorf("Load() = %v, want linkerd-canary ConfigMap of resourceVersion 5", cm)
+	}
+}
+
+func TestGetLinkerdCNIConfigLastKnownGood(t *testing.T) {
+	var tests = []struct {
+		name string
+		// source - the operator's Linkerd CNI ConfigMap, nil if it is deleted.
+		source *corev1.ConfigMap
+		// stored - if set, the configuration with proxy UID 2101 is the last known good one.
+		stored       bool
+		wantProxyUID int
+		wantDegraded bool
+		wantErr      bool
+	}{
+		{
+			name:         "valid source",
+			source:       linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, 2102),
+			stored:       true,
+			wantProxyUID: 2102,
+		},
+		{
+			name: "invalid source",
+			source: func() *corev1.ConfigMap {
+				var cm = linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, 2102)
+				cm.Data[constants.DefaultLinkerdCNICMKey] = "{"
+
+				return cm
+			}(),
+			stored:       true,
+			wantProxyUID: 2101,
+			wantDegraded: true,
+		},
+		{
+			name: "missing key",
+			source: func() *corev1.ConfigMap {
+				var cm = linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, 2102)
+				cm.Data = map[string]string{"cni": cm.Data[constants.DefaultLinkerdCNICMKey]}
+
+				return cm
+			}(),
+			stored:       true,
+			wantProxyUID: 2101,
+			wantDegraded: true,
+		},
+		{
+			name:         "deleted source",
+			stored:       true,
+			wantProxyUID: 2101,
+			wantDegraded: true,
+		},
+		{
+			name:    "nothing is stored",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				objects []client.Object
+			)
+
+			if tt.source != nil {
+				objects = append(objects, tt.source)
+			}
+
+			var r = reconcilerWith(t, objects...)
+			r.Config = operatorconfig.NewStore(operatorconfig.Default(), "", nil)
+			r.LastKnownGood = &LastKnownGood{Client: r.Client, Secret: lastKnownGoodSecret}
+
+			if tt.stored {
+				var cm = linkerdCNIConfigMap(constants.DefaultLinkerdCNICMNamespace, 2101)
+				cm.ResourceVersion = "1"
+
+				if err := r.LastKnownGood.Save(ctx, operatorCNIConfigMapRef, cm); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cniConfig, source, err := r.getLinkerdCNIConfig(ctx, &cniv1alpha1.AttachDefinition{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getLinkerdCNIConfig() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if cniConfig.Linkerd.ProxyUID != tt.wantProxyUID {
+				t.Errorf("proxy UID = %d, want %d", cniConfig.Linkerd.ProxyUID, tt.wantProxyUID)
+			}
+
+			if (source.Degraded != nil) != tt.wantDegraded {
+				t.Errorf("degraded = %v, want degraded %t", source.Degraded, tt.wantDegraded)
+			}
+
+			// A valid source replaces the last known good configuration.
+			if !tt.wantDegraded {
+				var current = &corev1.ConfigMap{}
+				if err := r.Get(ctx, operatorCNIConfigMapRef.ObjectKey, current); err != nil {
+					t.Fatal(err)
+				}
+
+				stored, err := r.LastKnownGood.Load(ctx, operatorCNIConfigMapRef)
+				if err != nil || stored == nil || stored.ResourceVersion != current.ResourceVersion {
+					t.Errorf("last known good = %v, %v, want resourceVersion %s", stored, err, current.ResourceVersion)
+				}
+			}
+		})
+	}
+}
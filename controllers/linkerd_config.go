@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// nolint:stylecheck // The error text starts from the name of the ConfigMap.
+var (
+	// ErrLinkerdConfigKeyNotFound - the Linkerd control plane ConfigMap does not contain the Helm values key.
+	ErrLinkerdConfigKeyNotFound = errors.New("linkerd-config ConfigMap does not contain required key")
+	// ErrLinkerdValueOutOfRange - a port or the proxy UID of the control plane values is out of range.
+	ErrLinkerdValueOutOfRange = errors.New("linkerd-config value is out of range")
+)
+
+// LinkerdValues - proxy settings of the Linkerd control plane Helm values
+// stored in the linkerd-config ConfigMap.
+type LinkerdValues struct {
+	Proxy struct {
+		UID   int `json:"uid,omitempty"`
+		Ports struct {
+			Inbound  int `json:"inbound,omitempty"`
+			Outbound int `json:"outbound,omitempty"`
+		} `json:"ports,omitempty"`
+		// OpaquePorts - default opaque ports, they are handled by the proxy
+		// and are not a part of Linkerd CNI configuration.
+		OpaquePorts string `json:"opaquePorts,omitempty"`
+	} `json:"proxy,omitempty"`
+	ProxyInit struct {
+		IgnoreInboundPorts  string `json:"ignoreInboundPorts,omitempty"`
+		IgnoreOutboundPorts string `json:"ignoreOutboundPorts,omitempty"`
+	} `json:"proxyInit,omitempty"`
+}
+
+// ParseLinkerdConfig - parses Helm values stored under the key of the Linkerd control plane ConfigMap.
+// Unknown values are ignored.
+func ParseLinkerdConfig(linkerdConfigMap *corev1.ConfigMap, key string) (*LinkerdValues, error) {
+	rawValues, ok := linkerdConfigMap.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: expected key %q", ErrLinkerdConfigKeyNotFound, key)
+	}
+
+	var values = &LinkerdValues{}
+
+	if err := yaml.Unmarshal([]byte(rawValues), values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// ProxyConfig - converts the control plane values to a ProxyConfig layer.
+// Ports and the proxy UID which do not fit the ProxyConfig are reported instead of being truncated.
+func (v *LinkerdValues) ProxyConfig() (*cniv1alpha1.ProxyConfig, error) {
+	for _, value := range []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"proxy.ports.inbound", v.Proxy.Ports.Inbound, 1, math.MaxUint16},
+		{"proxy.ports.outbound", v.Proxy.Ports.Outbound, 1, math.MaxUint16},
+		{"proxy.uid", v.Proxy.UID, 1, math.MaxUint32},
+	} {
+		// Zero means the value is not set.
+		if value.value != 0 && (value.value < value.min || value.value > value.max) {
+			return nil, fmt.Errorf("%w: %s %d is not within %d-%d",
+				ErrLinkerdValueOutOfRange, value.name, value.value, value.min, value.max)
+		}
+	}
+
+	var cfg = &cniv1alpha1.ProxyConfig{
+		InboundPort:  cniv1alpha1.Port(v.Proxy.Ports.Inbound),
+		OutboundPort: cniv1alpha1.Port(v.Proxy.Ports.Outbound),
+	}
+
+	if v.Proxy.UID != 0 {
+		var uid = uint32(v.Proxy.UID)
+
+		cfg.ProxyUID = &uid
+	}
+
+	var err error
+
+	if cfg.SkipInboundPorts, err = parsePortList(v.ProxyInit.IgnoreInboundPorts); err != nil {
+		return nil, fmt.Errorf("proxyInit.ignoreInboundPorts: %w", err)
+	}
+
+	if cfg.SkipOutboundPorts, err = parsePortList(v.ProxyInit.IgnoreOutboundPorts); err != nil {
+		return nil, fmt.Errorf("proxyInit.ignoreOutboundPorts: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Disagreements - returns descriptions of the proxy settings which differ between
+// the Linkerd CNI configuration and the control plane values.
+func (v *LinkerdValues) Disagreements(cni *CNIPluginConf) []string {
+	var result []string
+
+	for _, setting := range []struct {
+		name              string
+		cniValue, cpValue int
+	}{
+		{"proxy UID", cni.Linkerd.ProxyUID, v.Proxy.UID},
+		{"inbound proxy port", cni.Linkerd.IncomingProxyPort, v.Proxy.Ports.Inbound},
+		{"outbound proxy port", cni.Linkerd.OutgoingProxyPort, v.Proxy.Ports.Outbound},
+	} {
+		if setting.cpValue != 0 && setting.cniValue != 0 && setting.cniValue != setting.cpValue {
+			result = append(result, fmt.Sprintf("%s: linkerd-cni %d, control plane %d",
+				setting.name, setting.cniValue, setting.cpValue))
+		}
+	}
+
+	return result
+}
+
+// parsePortList - parses a comma separated list of ports and port ranges.
+func parsePortList(list string) ([]cniv1alpha1.Ports, error) {
+	var result []cniv1alpha1.Ports
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "-") {
+			if _, _, err := operatorconfig.ParsePortRange(item); err != nil {
+				return nil, err
+			}
+
+			result = append(result, cniv1alpha1.Ports{Range: item})
+
+			continue
+		}
+
+		port, err := strconv.ParseUint(item, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+
+		if port == 0 {
+			return nil, fmt.Errorf("%w: port 0", ErrLinkerdValueOutOfRange)
+		}
+
+		result = append(result, cniv1alpha1.Ports{Port: cniv1alpha1.Port(port)})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+func TestParsePortList(t *testing.T) {
+	var tests = []struct {
+		name    string
+		list    string
+		want    []cniv1alpha1.Ports
+		wantErr bool
+	}{
+		{
+			name: "empty list",
+		},
+		{
+			name: "ports and ranges",
+			list: "25, 443,4567-4568",
+			want: []cniv1alpha1.Ports{{Port: 25}, {Port: 443}, {Range: "4567-4568"}},
+		},
+		{
+			name: "empty items are skipped",
+			list: ",25,,",
+			want: []cniv1alpha1.Ports{{Port: 25}},
+		},
+		{
+			name:    "port out of range",
+			list:    "25,65536",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			list:    "smtp",
+			wantErr: true,
+		},
+		{
+			name:    "zero port",
+			list:    "25,0",
+			wantErr: true,
+		},
+		{
+			name:    "reversed range",
+			list:    "4568-4567",
+			wantErr: true,
+		},
+		{
+			name:    "range out of range",
+			list:    "60000-70000",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePortList(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortList() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePortList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkerdValuesProxyConfig(t *testing.T) {
+	var uid uint32 = 2102
+
+	var tests = []struct {
+		name     string
+		uid      int
+		inbound  int
+		outbound int
+		want     *cniv1alpha1.ProxyConfig
+		wantErr  bool
+	}{
+		{
+			name: "unset values",
+			want: &cniv1alpha1.ProxyConfig{},
+		},
+		{
+			name:     "valid values",
+			uid:      2102,
+			inbound:  4143,
+			outbound: 4140,
+			want:     &cniv1alpha1.ProxyConfig{InboundPort: 4143, OutboundPort: 4140, ProxyUID: &uid},
+		},
+		{
+			name:    "inbound port out of range",
+			inbound: 70000,
+			wantErr: true,
+		},
+		{
+			name:     "negative outbound port",
+			outbound: -1,
+			wantErr:  true,
+		},
+		{
+			name:    "negative UID",
+			uid:     -1,
+			wantErr: true,
+		},
+		{
+			name:    "UID out of range",
+			uid:     1 << 32,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values = &LinkerdValues{}
+
+			values.Proxy.UID = tt.uid
+			values.Proxy.Ports.Inbound = tt.inbound
+			values.Proxy.Ports.Outbound = tt.outbound
+
+			got, err := values.ProxyConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProxyConfig() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrLinkerdValueOutOfRange) {
+				t.Errorf("ProxyConfig() error = %v, want %v", err, ErrLinkerdValueOutOfRange)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProxyConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkerdValuesDisagreements(t *testing.T) {
+	var tests = []struct {
+		name                   string
+		uid, inbound, outbound int
+		want                   []string
+	}{
+		{
+			name:     "same settings",
+			uid:      2102,
+			inbound:  4143,
+			outbound: 4140,
+		},
+		{
+			name: "unset control plane settings are not compared",
+		},
+		{
+			name:     "every setting differs",
+			uid:      2103,
+			inbound:  5143,
+			outbound: 5140,
+			want: []string{
+				"proxy UID: linkerd-cni 2102, control plane 2103",
+				"inbound proxy port: linkerd-cni 4143, control plane 5143",
+				"outbound proxy port: linkerd-cni 4140, control plane 5140",
+			},
+		},
+		{
+			name:    "one setting differs",
+			uid:     2102,
+			inbound: 5143,
+			want:    []string{"inbound proxy port: linkerd-cni 4143, control plane 5143"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values = &LinkerdValues{}
+
+			values.Proxy.UID = tt.uid
+			values.Proxy.Ports.Inbound = tt.inbound
+			values.Proxy.Ports.Outbound = tt.outbound
+
+			var cni = newCNIPluginConf()
+
+			cni.Linkerd.ProxyUID = 2102
+			cni.Linkerd.IncomingProxyPort = 4143
+			cni.Linkerd.OutgoingProxyPort = 4140
+
+			if got := values.Disagreements(cni); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Disagreements() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
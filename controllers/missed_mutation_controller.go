@@ -0,0 +1,400 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/metrics"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+const (
+	// EventReasonMissedMutation - a meshed Pod was created without Linkerd CNI network.
+	EventReasonMissedMutation = "MissedMutation"
+	// EventReasonEvicted - a Pod which missed mutation has been evicted.
+	EventReasonEvicted = "EvictedForMutation"
+	// EventReasonEvictionFailed - a Pod which missed mutation can not be evicted.
+	EventReasonEvictionFailed = "EvictionFailed"
+
+	// evictionRetryPeriod - delay before the next eviction attempt if it has been refused,
+	// for example, by a PodDisruptionBudget.
+	evictionRetryPeriod = 30 * time.Second
+
+	// evictionCooldown and evictionMaxCooldown - after an eviction, the next Pod of the same controller
+	// is evicted not earlier than after the cooldown, which doubles with every eviction up to the maximum.
+	// If the recreated Pods keep missing the mutation, the controller's Pods are not evicted in a loop.
+	evictionCooldown    = time.Minute
+	evictionMaxCooldown = 30 * time.Minute
+)
+
+// MissedMutationReconciler detects Pods which requested Linkerd proxy injection, but
+// were created without Linkerd CNI network, for example, because the webhook with
+// failurePolicy=ignore was not available. Such Pods run Linkerd proxy whose traffic
+// is never redirected.
+type MissedMutationReconciler struct {
+	client.Client
+	Scheme     *runtime.Scheme
+	Recorder   record.EventRecorder
+	KubeClient kubernetes.Interface
+	// InstanceName - only Pods in Namespaces of this operator instance are checked.
+	InstanceName string
+	// WebhookConfigurationName - MutatingWebhookConfiguration of the pod webhook, Pods are evicted
+	// only if the webhook has ready endpoints, otherwise the recreated Pods would miss the mutation again.
+	WebhookConfigurationName string
+
+	mu sync.Mutex
+	// reported - UIDs of the Pods whose missed mutation has been reported, so an Event is recorded once per Pod.
+	reported map[types.NamespacedName]types.UID
+	// cooldowns - eviction cooldowns of the Pods' controllers.
+	cooldowns map[types.UID]evictionCooldownState
+}
+
+// evictionCooldownState - evictions of a controller's Pods.
+type evictionCooldownState struct {
+	lastEviction time.Time
+	cooldown     time.Duration
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile reports a Pod which missed the webhook mutation and evicts it
+// if its Namespace's AttachDefinition has MissedPodPolicy=Evict.
+func (r *MissedMutationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("Pod", req.NamespacedName)
+
+	var pod = &corev1.Pod{}
+
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName)
+		}
+
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	namespace, err := GetNamespace(ctx, r.Client, req.Namespace)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !IsInstance(NamespaceInstance(namespace), r.InstanceName) || !isPodMissedMutation(pod, namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	attach, err := r.getNamespaceAttachDefinition(ctx, req.Namespace)
+	if err != nil || attach == nil {
+		// Namespaces without AttachDefinition are not managed by the operator.
+		return ctrl.Result{}, err
+	}
+
+	// The Pod is reconciled on its every update and on eviction retries, it is reported once.
+	var firstReport = r.report(req.NamespacedName, pod.UID)
+
+	if firstReport {
+		logger.Info("Pod requested Linkerd proxy injection, but was created without Linkerd CNI network")
+
+		r.Recorder.Event(pod, corev1.EventTypeWarning, EventReasonMissedMutation,
+			"Pod runs Linkerd proxy without Linkerd CNI network, proxy traffic is not redirected. "+
+				"The Pod must be recreated to be mutated by the webhook")
+	}
+
+	if attach.Spec.MissedPodPolicy != cniv1alpha1.MissedPodPolicyEvict {
+		return ctrl.Result{}, nil
+	}
+
+	return r.evict(ctx, pod, firstReport)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MissedMutationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}).
+		Named("MissedMutationReconciler").
+		Complete(r)
+}
+
+// getNamespaceAttachDefinition - returns an AttachDefinition of a Namespace which
+// requests Multus NetworkAttachmentDefinition or nil if there is no such AttachDefinition.
+func (r *MissedMutationReconciler) getNamespaceAttachDefinition(
+	ctx context.Context, namespace string) (*cniv1alpha1.AttachDefinition, error) {
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := r.List(ctx, attachDefinitions, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	for i := range attachDefinitions.Items {
+		if attachDefinitions.Items[i].Spec.CreateMultusNetworkAttachmentDefinition {
+			return &attachDefinitions.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// evict - evicts a Pod via Eviction API, so PodDisruptionBudgets are respected.
+// Only Pods managed by a controller are evicted as otherwise they would not be recreated.
+// nolint:funlen // sequential preconditions of the eviction.
+func (r *MissedMutationReconciler) evict(ctx context.Context, pod *corev1.Pod, firstReport bool) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("Pod", client.ObjectKeyFromObject(pod))
+
+	var owner = metav1.GetControllerOf(pod)
+
+	if owner == nil {
+		if firstReport {
+			logger.Info("Pod is not managed by a controller, skip eviction")
+
+			r.Recorder.Event(pod, corev1.EventTypeWarning, EventReasonEvictionFailed,
+				"Pod is not managed by a controller and would not be recreated, delete and create it manually")
+			metrics.PodEvictions.WithLabelValues(pod.Namespace, "skipped-no-controller").Inc()
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	// Without the NetworkAttachmentDefinition the recreated Pod would miss the network again.
+	var multus = &netattachv1.NetworkAttachmentDefinition{}
+
+	if err := r.Get(ctx, client.ObjectKey{
+		Namespace: pod.Namespace,
+		Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
+	}, multus); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("Multus NetworkAttachmentDefinition is not created yet, postpone eviction")
+
+			return ctrl.Result{RequeueAfter: evictionRetryPeriod}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	// Without the webhook the recreated Pod would miss the mutation again.
+	if err := r.checkWebhookAvailable(ctx); err != nil {
+		logger.Info("Pod webhook is not available, postpone eviction", "reason", err.Error())
+
+		metrics.PodEvictions.WithLabelValues(pod.Namespace, "skipped-webhook-unavailable").Inc()
+
+		return ctrl.Result{RequeueAfter: evictionRetryPeriod}, nil
+	}
+
+	if wait := r.cooldownRemaining(owner.UID, time.Now()); wait > 0 {
+		logger.Info("Pod of the same controller has been evicted recently, postpone eviction",
+			"controller", owner.Kind+"/"+owner.Name, "after", wait.String())
+
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	var eviction = &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+
+	if err := r.KubeClient.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		// PodDisruptionBudget does not allow the eviction now.
+		if apierrors.IsTooManyRequests(err) {
+			logger.Info("Eviction is refused, retry later", "error", err.Error())
+
+			metrics.PodEvictions.WithLabelValues(pod.Namespace, "refused").Inc()
+
+			return ctrl.Result{RequeueAfter: evictionRetryPeriod}, nil
+		}
+
+		logger.Error(err, "can not evict Pod")
+
+		r.Recorder.Event(pod, corev1.EventTypeWarning, EventReasonEvictionFailed, err.Error())
+		metrics.PodEvictions.WithLabelValues(pod.Namespace, "error").Inc()
+
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("Pod has been evicted to be recreated through the webhook")
+
+	r.startCooldown(owner.UID, time.Now())
+
+	r.Recorder.Event(pod, corev1.EventTypeNormal, EventReasonEvicted,
+		"Pod has been evicted to be recreated with Linkerd CNI network")
+	metrics.PodEvictions.WithLabelValues(pod.Namespace, "evicted").Inc()
+
+	return ctrl.Result{}, nil
+}
+
+// checkWebhookAvailable - returns an error if the MutatingWebhookConfiguration does not contain the instance's
+// pod webhook or its Service has no ready endpoints. The check is skipped if the configuration name is not set.
+func (r *MissedMutationReconciler) checkWebhookAvailable(ctx context.Context) error {
+	if r.WebhookConfigurationName == "" {
+		return nil
+	}
+
+	configuration, err := r.KubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
+		ctx, r.WebhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("can not get MutatingWebhookConfiguration %s: %w", r.WebhookConfigurationName, err)
+	}
+
+	var webhookName = operatorconfig.PodWebhookName(r.InstanceName)
+
+	for i := range configuration.Webhooks {
+		var webhook = &configuration.Webhooks[i]
+
+		if webhook.Name != webhookName {
+			continue
+		}
+
+		var service = webhook.ClientConfig.Service
+		if service == nil {
+			// A URL webhook is outside of the cluster, its availability is not known.
+			return nil
+		}
+
+		endpoints, err := r.KubeClient.CoreV1().Endpoints(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("can not get webhook Service %s/%s endpoints: %w", service.Namespace, service.Name, err)
+		}
+
+		for j := range endpoints.Subsets {
+			if len(endpoints.Subsets[j].Addresses) != 0 {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("webhook Service %s/%s has no ready endpoints", service.Namespace, service.Name)
+	}
+
+	return fmt.Errorf("MutatingWebhookConfiguration %s has no webhook %s", r.WebhookConfigurationName, webhookName)
+}
+
+// report - remembers that the Pod's missed mutation is reported,
+// returns true if it has not been reported before.
+func (r *MissedMutationReconciler) report(key types.NamespacedName, uid types.UID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reported == nil {
+		r.reported = map[types.NamespacedName]types.UID{}
+	}
+
+	if r.reported[key] == uid {
+		return false
+	}
+
+	r.reported[key] = uid
+
+	return true
+}
+
+// forget - removes a deleted Pod from the reported ones.
+func (r *MissedMutationReconciler) forget(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.reported, key)
+}
+
+// cooldownRemaining - returns how long the controller's Pods must not be evicted.
+func (r *MissedMutationReconciler) cooldownRemaining(owner types.UID, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var state, ok = r.cooldowns[owner]
+	if !ok {
+		return 0
+	}
+
+	var remaining = state.lastEviction.Add(state.cooldown).Sub(now)
+
+	// The cooldown is forgotten if no Pods of the controller have been evicted for a long time.
+	if now.Sub(state.lastEviction) > 2*evictionMaxCooldown {
+		delete(r.cooldowns, owner)
+	}
+
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// startCooldown - starts the controller's cooldown after its Pod has been evicted,
+// the cooldown doubles if the previous eviction has been recently.
+func (r *MissedMutationReconciler) startCooldown(owner types.UID, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cooldowns == nil {
+		r.cooldowns = map[types.UID]evictionCooldownState{}
+	}
+
+	var state, ok = r.cooldowns[owner]
+
+	switch {
+	case !ok || now.Sub(state.lastEviction) > 2*evictionMaxCooldown:
+		state.cooldown = evictionCooldown
+	case state.cooldown*2 > evictionMaxCooldown:
+		state.cooldown = evictionMaxCooldown
+	default:
+		state.cooldown *= 2
+	}
+
+	state.lastEviction = now
+	r.cooldowns[owner] = state
+}
+
+// isPodMissedMutation - checks if a Pod runs Linkerd proxy and requested injection
+// (by itself or via its Namespace), but does not request Linkerd CNI network.
+func isPodMissedMutation(pod *corev1.Pod, namespace *corev1.Namespace) bool {
+	if pod.DeletionTimestamp != nil || !HasLinkerdProxy(pod) || PodRequestsLinkerdCNI(pod) {
+		return false
+	}
+
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+
+	if IsLinkerdInjectRequested(pod.Annotations) {
+		return true
+	}
+
+	return IsLinkerdInjectRequested(namespace.Annotations) && !IsLinkerdInjectDisabled(pod.Annotations)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+// meshedPod - a running Pod with Linkerd proxy and the annotations.
+func meshedPod(annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web-0", Annotations: annotations},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "web"},
+			{Name: constants.LinkerdProxyContainerName},
+		}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestIsPodMissedMutation(t *testing.T) {
+	var (
+		injectEnabled  = map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectEnabled}
+		injectDisabled = map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectDisabled}
+	)
+
+	var tests = []struct {
+		name                 string
+		pod                  *corev1.Pod
+		namespaceAnnotations map[string]string
+		want                 bool
+	}{
+		{
+			name: "Pod requests injection",
+			pod:  meshedPod(injectEnabled),
+			want: true,
+		},
+		{
+			name: "ingress mode",
+			pod:  meshedPod(map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectIngress}),
+			want: true,
+		},
+		{
+			name:                 "Namespace requests injection",
+			pod:                  meshedPod(nil),
+			namespaceAnnotations: injectEnabled,
+			want:                 true,
+		},
+		{
+			name:                 "Pod opts out of Namespace injection",
+			pod:                  meshedPod(injectDisabled),
+			namespaceAnnotations: injectEnabled,
+		},
+		{
+			name: "injection is not requested",
+			pod:  meshedPod(nil),
+		},
+		{
+			name: "Pod requests Linkerd CNI network",
+			pod: meshedPod(map[string]string{
+				constants.LinkerdInjectAnnotation:       constants.LinkerdInjectEnabled,
+				constants.MultusNetworkAttachAnnotation: "macvlan," + constants.LinkerdCNINetworkAttachmentDefinitionName,
+			}),
+		},
+		{
+			name: "Pod without Linkerd proxy",
+			pod: func() *corev1.Pod {
+				var pod = meshedPod(injectEnabled)
+				pod.Spec.Containers = pod.Spec.Containers[:1]
+
+				return pod
+			}(),
+		},
+		{
+			name: "Linkerd proxy as a native sidecar",
+			pod: func() *corev1.Pod {
+				var pod = meshedPod(injectEnabled)
+				pod.Spec.InitContainers, pod.Spec.Containers = pod.Spec.Containers[1:], pod.Spec.Containers[:1]
+
+				return pod
+			}(),
+			want: true,
+		},
+		{
+			name: "completed Pod",
+			pod: func() *corev1.Pod {
+				var pod = meshedPod(injectEnabled)
+				pod.Status.Phase = corev1.PodSucceeded
+
+				return pod
+			}(),
+		},
+		{
+			name: "terminating Pod",
+			pod: func() *corev1.Pod {
+				var pod = meshedPod(injectEnabled)
+				pod.DeletionTimestamp = &metav1.Time{}
+
+				return pod
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var namespace = &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: tt.namespaceAnnotations},
+			}
+
+			if got := isPodMissedMutation(tt.pod, namespace); got != tt.want {
+				t.Errorf("isPodMissedMutation() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictionCooldown(t *testing.T) {
+	var start = time.Date(2022, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name string
+		// evictions - offsets from the start of the evictions of the controller's Pods.
+		evictions []time.Duration
+		// at - offset from the start when the cooldown is checked.
+		at   time.Duration
+		want time.Duration
+	}{
+		{
+			name: "no evictions",
+			at:   time.Minute,
+		},
+		{
+			name:      "first eviction",
+			evictions: []time.Duration{0},
+			at:        20 * time.Second,
+			want:      40 * time.Second,
+		},
+		{
+			name:      "cooldown is over",
+			evictions: []time.Duration{0},
+			at:        2 * time.Minute,
+		},
+		{
+			name:      "repeated evictions double the cooldown",
+			evictions: []time.Duration{0, time.Minute, 3 * time.Minute},
+			at:        3 * time.Minute,
+			want:      4 * time.Minute,
+		},
+		{
+			name: "cooldown is limited",
+			evictions: []time.Duration{
+				0, time.Minute, 3 * time.Minute, 7 * time.Minute, 15 * time.Minute, 31 * time.Minute, 61 * time.Minute,
+			},
+			at:   61 * time.Minute,
+			want: evictionMaxCooldown,
+		},
+		{
+			name:      "cooldown is reset after a quiet period",
+			evictions: []time.Duration{0, time.Minute, 3 * time.Minute, 2 * time.Hour},
+			at:        2 * time.Hour,
+			want:      evictionCooldown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				r     = &MissedMutationReconciler{}
+				owner = types.UID("replicaset-uid")
+			)
+
+			for _, eviction := range tt.evictions {
+				r.startCooldown(owner, start.Add(eviction))
+			}
+
+			if got := r.cooldownRemaining(owner, start.Add(tt.at)); got != tt.want {
+				t.Errorf("cooldownRemaining() = %s, want %s", got, tt.want)
+			}
+
+			if got := r.cooldownRemaining("another-replicaset-uid", start.Add(tt.at)); got != 0 {
+				t.Errorf("cooldownRemaining() of another controller = %s, want 0", got)
+			}
+		})
+	}
+}
+
+func TestMissedMutationReportedOnce(t *testing.T) {
+	var (
+		r   = &MissedMutationReconciler{}
+		key = types.NamespacedName{Namespace: "app", Name: "web-0"}
+	)
+
+	for _, step := range []struct {
+		uid    types.UID
+		forget bool
+		want   bool
+	}{
+		{uid: "first", want: true},
+		{uid: "first"},
+		{uid: "recreated", want: true},
+		{uid: "recreated", forget: true, want: true},
+	} {
+		if step.forget {
+			r.forget(key)
+		}
+
+		if got := r.report(key, step.uid); got != step.want {
+			t.Errorf("report(%s) = %t, want %t", step.uid, got, step.want)
+		}
+	}
+}
@@ -21,6 +21,7 @@ type ProxyInit struct {
 	PortsToRedirect       []int    `json:"ports-to-redirect,omitempty"`
 	InboundPortsToIgnore  []string `json:"inbound-ports-to-ignore,omitempty"`
 	OutboundPortsToIgnore []string `json:"outbound-ports-to-ignore,omitempty"`
+	SubnetsToIgnore       []string `json:"subnets-to-ignore,omitempty"`
 }
 
 // Kubernetes a K8s specific struct to hold config.
@@ -49,8 +50,10 @@ func newCNIPluginConf() *CNIPluginConf {
 	}
 }
 
-func newMultusNetworkAttachDefinition(
-	multusRef client.ObjectKey, config *CNIPluginConf) (*netattachv1.NetworkAttachmentDefinition, error) {
+// newMultusNetworkAttachDefinition - returns the NetworkAttachmentDefinition with the CNI configuration
+// and its provenance annotations.
+func newMultusNetworkAttachDefinition(multusRef client.ObjectKey, config *CNIPluginConf,
+	provenance *Provenance) (*netattachv1.NetworkAttachmentDefinition, error) {
 	var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{
 		TypeMeta: v1.TypeMeta{
 			Kind:       constants.MultusNetworkAttachmentDefinitionResourceKind,
@@ -68,14 +71,36 @@ func newMultusNetworkAttachDefinition(
 	}
 
 	multusNetAttach.Spec.Config = string(cfg)
+	multusNetAttach.Annotations = provenance.annotations(multusNetAttach.Spec.Config)
 
 	return multusNetAttach, nil
 }
 
+// renderMultusNetAttach - produces the Multus NetworkAttachmentDefinition of the AttachDefinition
+// from the base Linkerd CNI configuration: the AttachDefinition's settings and the skipped Services
+// are applied on top of it. The base configuration is modified.
+func renderMultusNetAttach(ldAttach *cniv1alpha1.AttachDefinition, base *CNIPluginConf, services *skippedServices,
+	provenance *Provenance) (*netattachv1.NetworkAttachmentDefinition, error) {
+	var multusRef = client.ObjectKey{
+		Namespace: ldAttach.Namespace,
+		Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
+	}
+
+	return newMultusNetworkAttachDefinition(multusRef,
+		applySkippedServices(applyAttachDefinition(base, ldAttach), services), provenance)
+}
+
 // applyAttachDefinition configures provided CNIPluginConf with defined values from AttachDefinition.
 func applyAttachDefinition(cfg *CNIPluginConf, ldAttach *cniv1alpha1.AttachDefinition) *CNIPluginConf {
-	var ldCfg = ldAttach.Spec.Config
+	if source := ldAttach.Spec.CNISource; source != nil && source.Kubeconfig != "" {
+		cfg.Kubernetes.Kubeconfig = source.Kubeconfig
+	}
 
+	return applyProxyConfig(cfg, &ldAttach.Spec.Config)
+}
+
+// applyProxyConfig configures provided CNIPluginConf with defined values from ProxyConfig.
+func applyProxyConfig(cfg *CNIPluginConf, ldCfg *cniv1alpha1.ProxyConfig) *CNIPluginConf {
 	if ldCfg.InboundPort != 0 {
 		cfg.Linkerd.IncomingProxyPort = int(ldCfg.InboundPort)
 	}
@@ -88,29 +113,45 @@ func applyAttachDefinition(cfg *CNIPluginConf, ldAttach *cniv1alpha1.AttachDefin
 		cfg.Linkerd.ProxyUID = int(*ldCfg.ProxyUID)
 	}
 
-	if len(ldCfg.SkipInboundPorts) != 0 {
-		for _, port := range ldCfg.SkipInboundPorts {
-			if port.Port != 0 {
-				cfg.Linkerd.InboundPortsToIgnore = append(cfg.Linkerd.InboundPortsToIgnore, strconv.Itoa(int(port.Port)))
-			}
+	cfg.Linkerd.InboundPortsToIgnore = appendPorts(cfg.Linkerd.InboundPortsToIgnore, ldCfg.SkipInboundPorts)
+	cfg.Linkerd.OutboundPortsToIgnore = appendPorts(cfg.Linkerd.OutboundPortsToIgnore, ldCfg.SkipOutboundPorts)
 
-			if port.Range != "" {
-				cfg.Linkerd.InboundPortsToIgnore = append(cfg.Linkerd.InboundPortsToIgnore, port.Range)
-			}
+	return cfg
+}
+
+// appendPorts - appends ports and port ranges which are not in the list yet,
+// as the same ports may come from several configuration layers.
+func appendPorts(list []string, ports []cniv1alpha1.Ports) []string {
+	for _, port := range ports {
+		if port.Port != 0 {
+			list = appendUnique(list, strconv.Itoa(int(port.Port)))
+		}
+
+		if port.Range != "" {
+			list = appendUnique(list, port.Range)
 		}
 	}
 
-	if len(ldCfg.SkipOutboundPorts) != 0 {
-		for _, port := range ldCfg.SkipOutboundPorts {
-			if port.Port != 0 {
-				cfg.Linkerd.OutboundPortsToIgnore = append(cfg.Linkerd.OutboundPortsToIgnore, strconv.Itoa(int(port.Port)))
-			}
+	return list
+}
 
-			if port.Range != "" {
-				cfg.Linkerd.OutboundPortsToIgnore = append(cfg.Linkerd.OutboundPortsToIgnore, port.Range)
+// appendUnique - appends items which are not in the list yet.
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		var found bool
+
+		for _, existing := range list {
+			if existing == item {
+				found = true
+
+				break
 			}
 		}
+
+		if !found {
+			list = append(list, item)
+		}
 	}
 
-	return cfg
+	return list
 }
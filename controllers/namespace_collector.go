@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/metrics"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// namespaceCollectTimeout - how long a scrape waits for the Namespaces and their objects.
+const namespaceCollectTimeout = 5 * time.Second
+
+// NamespaceCollector - Prometheus collector of Namespaces of the operator instance which expect
+// the Linkerd CNI NetworkAttachmentDefinition by its presence. A Namespace expects it if it requests
+// Linkerd injection or has an AttachDefinition.
+type NamespaceCollector struct {
+	Client       client.Reader
+	InstanceName string
+	Config       *operatorconfig.Store
+}
+
+// Describe - implements prometheus.Collector.
+func (c *NamespaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metrics.NamespacesDesc
+}
+
+// Collect - implements prometheus.Collector.
+func (c *NamespaceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), namespaceCollectTimeout)
+	defer cancel()
+
+	withNAD, withoutNAD, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(metrics.NamespacesDesc, err)
+
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(metrics.NamespacesDesc, prometheus.GaugeValue, float64(withNAD), "present")
+	ch <- prometheus.MustNewConstMetric(metrics.NamespacesDesc, prometheus.GaugeValue, float64(withoutNAD), "missing")
+}
+
+// count - counts Namespaces which expect the NetworkAttachmentDefinition with and without it.
+func (c *NamespaceCollector) count(ctx context.Context) (withNAD, withoutNAD int, err error) {
+	namespaces, err := c.listNamespaces(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		nads              = &netattachv1.NetworkAttachmentDefinitionList{}
+		attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+		hasNAD            = map[string]bool{}
+		hasAttach         = map[string]bool{}
+	)
+
+	if err = c.Client.List(ctx, nads); err != nil {
+		return 0, 0, err
+	}
+
+	for i := range nads.Items {
+		if nads.Items[i].Name == constants.LinkerdCNINetworkAttachmentDefinitionName {
+			hasNAD[nads.Items[i].Namespace] = true
+		}
+	}
+
+	if err = c.Client.List(ctx, attachDefinitions); err != nil {
+		return 0, 0, err
+	}
+
+	for i := range attachDefinitions.Items {
+		hasAttach[attachDefinitions.Items[i].Namespace] = true
+	}
+
+	for _, namespace := range namespaces {
+		if !IsInstance(NamespaceInstance(namespace), c.InstanceName) ||
+			(c.Config != nil && c.Config.Get().IsNamespaceExcluded(namespace.Name)) {
+			continue
+		}
+
+		if !hasAttach[namespace.Name] && !IsLinkerdInjectRequested(namespace.Annotations) {
+			continue
+		}
+
+		if hasNAD[namespace.Name] {
+			withNAD++
+		} else {
+			withoutNAD++
+		}
+	}
+
+	return withNAD, withoutNAD, nil
+}
+
+// listNamespaces - returns the watched Namespaces in the namespace-scoped mode or all Namespaces.
+func (c *NamespaceCollector) listNamespaces(ctx context.Context) ([]*corev1.Namespace, error) {
+	var namespaces []*corev1.Namespace
+
+	if c.Config != nil && len(c.Config.Get().Manager.WatchNamespaces) != 0 {
+		for _, name := range c.Config.Get().Manager.WatchNamespaces {
+			namespace, err := GetNamespace(ctx, c.Client, name)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			namespaces = append(namespaces, namespace)
+		}
+
+		return namespaces, nil
+	}
+
+	var list = &corev1.NamespaceList{}
+
+	if err := c.Client.List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	for i := range list.Items {
+		namespaces = append(namespaces, &list.Items[i])
+	}
+
+	return namespaces, nil
+}
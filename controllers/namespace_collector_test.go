@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+func TestNamespaceCollectorCount(t *testing.T) {
+	var (
+		injected = func(name string, labels map[string]string) *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      labels,
+				Annotations: map[string]string{constants.LinkerdInjectAnnotation: constants.LinkerdInjectEnabled},
+			}}
+		}
+		nadIn = func(namespace, name string) *netattachv1.NetworkAttachmentDefinition {
+			return &netattachv1.NetworkAttachmentDefinition{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		}
+	)
+
+	var objects = []client.Object{
+		injected("app", nil),
+		nadIn("app", constants.LinkerdCNINetworkAttachmentDefinitionName),
+		injected("web", nil),
+		nadIn("web", "macvlan"),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "db"}},
+		&cniv1alpha1.AttachDefinition{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "db",
+			Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+		injected("canary", map[string]string{constants.InstanceLabel: "canary"}),
+		injected("kube-system", nil),
+	}
+
+	var tests = []struct {
+		name           string
+		configure      func(c *operatorconfig.Config)
+		wantWithNAD    int
+		wantWithoutNAD int
+	}{
+		{
+			name:           "all Namespaces",
+			wantWithNAD:    1,
+			wantWithoutNAD: 3,
+		},
+		{
+			name: "excluded Namespace",
+			configure: func(c *operatorconfig.Config) {
+				c.Exclusions.Namespaces = []string{"kube-system"}
+			},
+			wantWithNAD:    1,
+			wantWithoutNAD: 2,
+		},
+		{
+			name: "watched Namespaces",
+			configure: func(c *operatorconfig.Config) {
+				c.Manager.WatchNamespaces = []string{"app", "db", "deleted"}
+			},
+			wantWithNAD:    1,
+			wantWithoutNAD: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg = operatorconfig.Default()
+			if tt.configure != nil {
+				tt.configure(cfg)
+			}
+
+			var c = &NamespaceCollector{
+				Client:       reconcilerWith(t, objects...).Client,
+				InstanceName: constants.DefaultInstanceName,
+				Config:       operatorconfig.NewStore(cfg, "", nil),
+			}
+
+			withNAD, withoutNAD, err := c.count(context.Background())
+			if err != nil {
+				t.Fatalf("count() error = %v", err)
+			}
+
+			if withNAD != tt.wantWithNAD || withoutNAD != tt.wantWithoutNAD {
+				t.Errorf("count() = %d, %d, want %d, %d", withNAD, withoutNAD, tt.wantWithNAD, tt.wantWithoutNAD)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/metrics"
+)
+
+const (
+	// EventReasonNetworkStatusMissing - Multus did not set network-status annotation on a running meshed Pod.
+	EventReasonNetworkStatusMissing = "NetworkStatusMissing"
+	// EventReasonNetworkStatusInvalid - Multus network-status annotation can not be parsed.
+	EventReasonNetworkStatusInvalid = "NetworkStatusInvalid"
+	// EventReasonLinkerdCNIMissing - Multus network-status does not contain Linkerd CNI network.
+	EventReasonLinkerdCNIMissing = "LinkerdCNINotAttached"
+)
+
+// PodNetworkStatusReconciler verifies that Multus called Linkerd CNI for meshed Pods
+// by checking the Multus k8s.v1.cni.cncf.io/network-status annotation.
+// Pod events are reconciled per Namespace, so a burst of Pod changes lists the Namespace's Pods once.
+type PodNetworkStatusReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// InstanceName - only Pods in Namespaces of this operator instance are checked.
+	InstanceName string
+
+	mu sync.Mutex
+	// reported - reasons of the reported Pods by Namespace and Pod UID, so an Event is recorded
+	// and the failure is counted once when a Pod loses Linkerd CNI or the reason changes.
+	reported map[string]map[types.UID]string
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile checks the Multus network status of the Namespace's Pods and updates the Namespace's
+// AttachDefinition status with the number of meshed Pods without Linkerd CNI.
+// The request's name is the Namespace.
+func (r *PodNetworkStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ns, err := GetNamespace(ctx, r.Client, req.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.Name)
+		}
+
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !IsInstance(NamespaceInstance(ns), r.InstanceName) {
+		r.forget(req.Name)
+
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, r.updateNamespaceStatus(ctx, ns)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Namespaces are not watched as the namespace-scoped mode permits only to get them: Pod and
+// AttachDefinition events are mapped to their Namespace, which Reconcile reads directly.
+func (r *PodNetworkStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	c, err := controller.New("PodNetworkStatusReconciler", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range []client.Object{&corev1.Pod{}, &cniv1alpha1.AttachDefinition{}} {
+		if err := c.Watch(&source.Kind{Type: obj}, handler.EnqueueRequestsFromMapFunc(podNamespaceRequests)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// podNamespaceRequests - maps a Pod or an AttachDefinition to the request of its Namespace.
+func podNamespaceRequests(obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetNamespace()}}}
+}
+
+// updateNamespaceStatus - counts meshed Pods with and without Linkerd CNI and Pods
+// which missed the webhook mutation in a Namespace, reports the Pods which lost Linkerd CNI
+// and stores the result in the metrics and the status of the Namespace's AttachDefinitions.
+func (r *PodNetworkStatusReconciler) updateNamespaceStatus(ctx context.Context, ns *corev1.Namespace) error {
+	var namespace = ns.Name
+
+	logger := log.FromContext(ctx).WithValues("namespace", namespace)
+
+	var pods = &corev1.PodList{}
+
+	if err := r.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+		logger.Error(err, "can not list Pods")
+
+		return err
+	}
+
+	var (
+		meshed, withoutCNI, missedMutation int32
+		failures                           = map[types.UID]string{}
+	)
+
+	for i := range pods.Items {
+		var pod = &pods.Items[i]
+
+		if isPodMissedMutation(pod, ns) {
+			missedMutation++
+		}
+
+		if !isPodNetworkStatusExpected(pod) {
+			continue
+		}
+
+		meshed++
+
+		reason, message := checkPodNetworkStatus(pod)
+		if reason == "" {
+			continue
+		}
+
+		withoutCNI++
+
+		failures[pod.UID] = reason
+
+		if r.report(namespace, pod.UID, reason) {
+			logger.Info("Linkerd CNI is not attached to the Pod", "Pod", pod.Name, "reason", reason, "message", message)
+
+			r.Recorder.Event(pod, corev1.EventTypeWarning, reason, message)
+			metrics.PodCNIAttachFailures.WithLabelValues(namespace, reason).Inc()
+		}
+	}
+
+	// Pods which got Linkerd CNI or are deleted are reported again if they lose it.
+	r.mu.Lock()
+	if r.reported == nil {
+		r.reported = map[string]map[types.UID]string{}
+	}
+
+	r.reported[namespace] = failures
+	r.mu.Unlock()
+
+	metrics.PodsWithoutCNI.WithLabelValues(namespace).Set(float64(withoutCNI))
+	metrics.PodsMissedMutation.WithLabelValues(namespace).Set(float64(missedMutation))
+
+	var attachDefinitions = &cniv1alpha1.AttachDefinitionList{}
+
+	if err := r.List(ctx, attachDefinitions, client.InNamespace(namespace)); err != nil {
+		logger.Error(err, "can not list AttachDefinitions")
+
+		return err
+	}
+
+	for i := range attachDefinitions.Items {
+		var attach = &attachDefinitions.Items[i]
+
+		if attach.Status.MeshedPods == meshed && attach.Status.PodsWithoutCNI == withoutCNI &&
+			attach.Status.PodsMissedMutation == missedMutation {
+			continue
+		}
+
+		attach.Status.MeshedPods = meshed
+		attach.Status.PodsWithoutCNI = withoutCNI
+		attach.Status.PodsMissedMutation = missedMutation
+
+		if err := r.Status().Update(ctx, attach); err != nil {
+			logger.Error(err, "can not update AttachDefinition status", "AttachDefinition", attach.Name)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// report - returns true if the Pod has not been reported with the reason before.
+func (r *PodNetworkStatusReconciler) report(namespace string, uid types.UID, reason string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reported[namespace][uid] != reason
+}
+
+// forget - removes the reported Pods of a Namespace which is deleted or belongs to another operator instance.
+func (r *PodNetworkStatusReconciler) forget(namespace string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.reported, namespace)
+}
+
+// isPodNetworkStatusExpected - checks if a Pod requested Linkerd CNI and its sandbox
+// has been created, so Multus must have reported the network status.
+func isPodNetworkStatusExpected(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+
+	return PodRequestsLinkerdCNI(pod)
+}
+
+// checkPodNetworkStatus - returns an Event reason and a message if a meshed Pod
+// has no Linkerd CNI network in its Multus network-status annotation.
+// Empty reason means that the Pod is either not meshed or correctly attached.
+func checkPodNetworkStatus(pod *corev1.Pod) (reason, message string) {
+	if !isPodNetworkStatusExpected(pod) {
+		return "", ""
+	}
+
+	attached, err := HasLinkerdCNINetworkStatus(pod)
+
+	switch {
+	case errors.Is(err, ErrNetworkStatusMissing):
+		return EventReasonNetworkStatusMissing,
+			"Pod requested Linkerd CNI network, but Multus did not set network-status annotation"
+	case err != nil:
+		return EventReasonNetworkStatusInvalid,
+			"can not parse Multus network-status annotation: " + err.Error()
+	case !attached:
+		return EventReasonLinkerdCNIMissing,
+			"Multus network-status does not contain Linkerd CNI network, proxy traffic is not redirected"
+	}
+
+	return "", ""
+}
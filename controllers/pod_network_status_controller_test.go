@@ -0,0 +1,229 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+func TestPodNetworkStatusReconcilerReportsTransitions(t *testing.T) {
+	const (
+		attached   = `[{"name":"linkerd-cni","interface":"net1"}]`
+		unattached = `[{"name":"cbr0","interface":"eth0"}]`
+		missing    = ""
+	)
+
+	var steps = []struct {
+		name          string
+		networkStatus string
+		wantReason    string
+	}{
+		{name: "network status is missing", networkStatus: missing, wantReason: EventReasonNetworkStatusMissing},
+		{name: "same failure is not reported again", networkStatus: missing},
+		{name: "reason changes", networkStatus: unattached, wantReason: EventReasonLinkerdCNIMissing},
+		{name: "Linkerd CNI is attached", networkStatus: attached},
+		{name: "Linkerd CNI is lost again", networkStatus: unattached, wantReason: EventReasonLinkerdCNIMissing},
+	}
+
+	var scheme = runtime.NewScheme()
+
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cniv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	var pod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "test",
+			UID:       types.UID("app-uid"),
+			Annotations: map[string]string{
+				constants.MultusNetworkAttachAnnotation: constants.LinkerdCNINetworkAttachmentDefinitionName,
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	var (
+		kubeClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}}, pod).Build()
+		recorder   = record.NewFakeRecorder(len(steps))
+		reconciler = &PodNetworkStatusReconciler{Client: kubeClient, Scheme: scheme, Recorder: recorder}
+		ctx        = context.Background()
+	)
+
+	for _, step := range steps {
+		var current = &corev1.Pod{}
+
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "test", Name: "app"}, current); err != nil {
+			t.Fatal(err)
+		}
+
+		delete(current.Annotations, constants.MultusNetworkStatusAnnotation)
+
+		if step.networkStatus != missing {
+			current.Annotations[constants.MultusNetworkStatusAnnotation] = step.networkStatus
+		}
+
+		if err := kubeClient.Update(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every Pod event of the Namespace results in the same request.
+		for _, req := range podNamespaceRequests(current) {
+			if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: req.NamespacedName}); err != nil {
+				t.Fatalf("%s: Reconcile() error = %v", step.name, err)
+			}
+		}
+
+		var got string
+
+		select {
+		case event := <-recorder.Events:
+			got = event
+		default:
+		}
+
+		var unexpected = got != ""
+		if step.wantReason != "" {
+			unexpected = !strings.HasPrefix(got, corev1.EventTypeWarning+" "+step.wantReason+" ")
+		}
+
+		if unexpected {
+			t.Errorf("%s: event = %q, want reason %q", step.name, got, step.wantReason)
+		}
+	}
+}
+
+// namespacedInformers - informers of the namespace-scoped mode: its Roles do not permit to watch Namespaces.
+type namespacedInformers struct {
+	*informertest.FakeInformers
+}
+
+func (c *namespacedInformers) GetInformer(ctx context.Context, obj client.Object) (cache.Informer, error) {
+	if _, ok := obj.(*corev1.Namespace); ok {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", errors.New("namespaced Role"))
+	}
+
+	return c.FakeInformers.GetInformer(ctx, obj)
+}
+
+func TestPodNetworkStatusReconcilerNamespaced(t *testing.T) {
+	var scheme = runtime.NewScheme()
+
+	for _, addToScheme := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, cniv1alpha1.AddToScheme} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web-0",
+				Namespace: "app",
+				Annotations: map[string]string{
+					constants.MultusNetworkAttachAnnotation: constants.LinkerdCNINetworkAttachmentDefinitionName,
+				},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		ldAttach = &cniv1alpha1.AttachDefinition{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "app",
+			Name:      constants.LinkerdCNINetworkAttachmentDefinitionName,
+		}}
+		informers = &namespacedInformers{FakeInformers: &informertest.FakeInformers{Scheme: scheme}}
+	)
+
+	mgr, err := ctrl.NewManager(&rest.Config{Host: "https://127.0.0.1:6443"}, ctrl.Options{
+		Scheme:             scheme,
+		MetricsBindAddress: "0",
+		MapperProvider: func(*rest.Config) (meta.RESTMapper, error) {
+			return meta.NewDefaultRESTMapper(nil), nil
+		},
+		NewCache: func(*rest.Config, cache.Options) (cache.Cache, error) {
+			return informers, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kubeClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}}, pod, ldAttach).Build()
+
+	if err := (&PodNetworkStatusReconciler{
+		Client:   kubeClient,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(1),
+	}).SetupWithManager(mgr); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		_ = mgr.Start(ctx)
+	}()
+
+	// The controller syncs without a Namespace watch and reconciles the Namespace on a Pod event.
+	podInformer, err := informers.FakeInformerFor(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wait.PollImmediateUntil(50*time.Millisecond, func() (bool, error) {
+		podInformer.Add(pod)
+
+		var current = &cniv1alpha1.AttachDefinition{}
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(ldAttach), current); err != nil {
+			return false, err
+		}
+
+		return current.Status.PodsWithoutCNI == 1, nil
+	}, ctx.Done()); err != nil {
+		t.Fatalf("the Namespace is not reconciled: %v", err)
+	}
+}
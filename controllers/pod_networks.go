@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nolint:stylecheck // The error text starts from the name of the annotation owner, so capital letter.
+var ErrNetworkStatusMissing = errors.New("Multus network-status annotation is not set")
+
+// IsLinkerdInjectRequested - checks if annotations contain linkerd.io/inject annotation
+// which requests Linkerd proxy injection.
+func IsLinkerdInjectRequested(annotations map[string]string) bool {
+	value, ok := annotations[constants.LinkerdInjectAnnotation]
+
+	return ok && (value == constants.LinkerdInjectEnabled || value == constants.LinkerdInjectIngress)
+}
+
+// IsLinkerdInjectDisabled - checks if annotations explicitly opt out of Linkerd proxy injection.
+func IsLinkerdInjectDisabled(annotations map[string]string) bool {
+	return annotations[constants.LinkerdInjectAnnotation] == constants.LinkerdInjectDisabled
+}
+
+// HasLinkerdProxy - checks if a Pod contains Linkerd proxy container.
+func HasLinkerdProxy(pod *corev1.Pod) bool {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == constants.LinkerdProxyContainerName {
+			return true
+		}
+	}
+
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == constants.LinkerdProxyContainerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsLinkerdCNINetwork - checks if a Multus network reference points to the Linkerd CNI
+// NetworkAttachmentDefinition. The reference may be in a form of "name", "namespace/name"
+// and may contain "@interface" suffix.
+func IsLinkerdCNINetwork(network string) bool {
+	network = strings.TrimSpace(network)
+
+	if idx := strings.Index(network, "@"); idx >= 0 {
+		network = network[:idx]
+	}
+
+	if idx := strings.LastIndex(network, "/"); idx >= 0 {
+		network = network[idx+1:]
+	}
+
+	return network == constants.LinkerdCNINetworkAttachmentDefinitionName
+}
+
+// ParsePodNetworks - parses Multus k8s.v1.cni.cncf.io/networks annotation value which
+// may be either a comma separated list of networks or a JSON list of NetworkSelectionElement.
+func ParsePodNetworks(annotation string) ([]*netattachv1.NetworkSelectionElement, error) {
+	annotation = strings.TrimSpace(annotation)
+	if annotation == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(annotation, "[") {
+		var networks []*netattachv1.NetworkSelectionElement
+
+		if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+			return nil, err
+		}
+
+		return networks, nil
+	}
+
+	var networks []*netattachv1.NetworkSelectionElement
+
+	for _, net := range strings.Split(annotation, ",") {
+		net = strings.TrimSpace(net)
+		if net == "" {
+			continue
+		}
+
+		var element = &netattachv1.NetworkSelectionElement{}
+
+		if idx := strings.Index(net, "@"); idx >= 0 {
+			element.InterfaceRequest = net[idx+1:]
+			net = net[:idx]
+		}
+
+		if idx := strings.Index(net, "/"); idx >= 0 {
+			element.Namespace = net[:idx]
+			net = net[idx+1:]
+		}
+
+		element.Name = net
+
+		networks = append(networks, element)
+	}
+
+	return networks, nil
+}
+
+// PodRequestsLinkerdCNI - checks if a Pod's Multus networks annotation contains the Linkerd CNI network,
+// i.e. if the Pod has been mutated by the webhook or requested Linkerd CNI explicitly.
+func PodRequestsLinkerdCNI(pod *corev1.Pod) bool {
+	networks, err := ParsePodNetworks(pod.Annotations[constants.MultusNetworkAttachAnnotation])
+	if err != nil {
+		return false
+	}
+
+	for _, net := range networks {
+		if net.Name == constants.LinkerdCNINetworkAttachmentDefinitionName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasLinkerdCNINetworkStatus - checks if Multus reported the Linkerd CNI network
+// in the Pod's k8s.v1.cni.cncf.io/network-status annotation.
+func HasLinkerdCNINetworkStatus(pod *corev1.Pod) (bool, error) {
+	rawStatus, ok := pod.Annotations[constants.MultusNetworkStatusAnnotation]
+	if !ok {
+		return false, ErrNetworkStatusMissing
+	}
+
+	var statuses []netattachv1.NetworkStatus
+
+	if err := json.Unmarshal([]byte(rawStatus), &statuses); err != nil {
+		return false, err
+	}
+
+	for i := range statuses {
+		if IsLinkerdCNINetwork(statuses[i].Name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// Provenance - what a NetworkAttachmentDefinition is rendered from.
+type Provenance struct {
+	AttachDefinitionGeneration int64
+	// CNIConfigMap and CNIConfigMapResourceVersion - the Linkerd CNI source, the resourceVersion
+	// is the last known good one if the source is invalid.
+	CNIConfigMap                client.ObjectKey
+	CNIConfigMapResourceVersion string
+}
+
+// NewProvenance - returns the provenance of a NetworkAttachmentDefinition rendered for the AttachDefinition
+// from the Linkerd CNI ConfigMap.
+func NewProvenance(ldAttach *cniv1alpha1.AttachDefinition, cniConfigMap *corev1.ConfigMap) *Provenance {
+	return &Provenance{
+		AttachDefinitionGeneration:  ldAttach.Generation,
+		CNIConfigMap:                client.ObjectKeyFromObject(cniConfigMap),
+		CNIConfigMapResourceVersion: cniConfigMap.ResourceVersion,
+	}
+}
+
+// annotations - returns the provenance annotations with the hash of the CNI configuration.
+func (p *Provenance) annotations(config string) map[string]string {
+	var annotations = map[string]string{
+		constants.OperatorVersionAnnotation: constants.OperatorVersion,
+		constants.ConfigHashAnnotation:      configHash(config),
+	}
+
+	if p != nil {
+		annotations[constants.AttachDefinitionGenerationAnnotation] = strconv.FormatInt(p.AttachDefinitionGeneration, 10)
+		annotations[constants.CNIConfigMapResourceVersionAnnotation] = p.CNIConfigMapResourceVersion
+
+		if p.CNIConfigMap.Name != "" {
+			annotations[constants.CNIConfigMapAnnotation] = p.CNIConfigMap.String()
+		}
+	}
+
+	return annotations
+}
+
+// configHash - returns the hash of the CNI configuration stored in the ConfigHashAnnotation.
+func configHash(config string) string {
+	var sum = sha256.Sum256([]byte(config))
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isTampered - checks if the NetworkAttachmentDefinition's configuration was modified after the operator
+// had generated it. NetworkAttachmentDefinitions without the hash are not considered tampered.
+func isTampered(multusNetAttach *netattachv1.NetworkAttachmentDefinition) bool {
+	hash, ok := multusNetAttach.Annotations[constants.ConfigHashAnnotation]
+
+	return ok && hash != configHash(multusNetAttach.Spec.Config)
+}
+
+// hasAnnotations - checks if the object has all the annotations with the same values.
+func hasAnnotations(obj client.Object, annotations map[string]string) bool {
+	var current = obj.GetAnnotations()
+
+	for key, value := range annotations {
+		if existing, ok := current[key]; !ok || existing != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setAnnotations - sets the annotations on the object keeping its other annotations.
+func setAnnotations(obj client.Object, annotations map[string]string) {
+	var current = obj.GetAnnotations()
+	if current == nil {
+		current = make(map[string]string, len(annotations))
+	}
+
+	for key, value := range annotations {
+		current[key] = value
+	}
+
+	obj.SetAnnotations(current)
+}
+
+// changedConfigFields - returns the paths of the CNI configuration fields which differ between the configurations,
+// for example, "linkerd.proxy-uid". If a configuration is not a JSON object, the whole "config" is reported.
+func changedConfigFields(current, required string) []string {
+	var currentFields, requiredFields map[string]interface{}
+
+	if json.Unmarshal([]byte(current), &currentFields) != nil || json.Unmarshal([]byte(required), &requiredFields) != nil {
+		return []string{"config"}
+	}
+
+	var fields = diffFields("", currentFields, requiredFields)
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+func diffFields(prefix string, current, required map[string]interface{}) []string {
+	var (
+		fields []string
+		keys   = map[string]bool{}
+	)
+
+	for key := range current {
+		keys[key] = true
+	}
+
+	for key := range required {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		var path = key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		currentMap, currentIsMap := current[key].(map[string]interface{})
+		requiredMap, requiredIsMap := required[key].(map[string]interface{})
+
+		if currentIsMap && requiredIsMap {
+			fields = append(fields, diffFields(path, currentMap, requiredMap)...)
+
+			continue
+		}
+
+		currentValue, inCurrent := current[key]
+		requiredValue, inRequired := required[key]
+
+		if inCurrent != inRequired || !reflect.DeepEqual(currentValue, requiredValue) {
+			fields = append(fields, path)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+func TestIsTampered(t *testing.T) {
+	const config = `{"cniVersion":"0.3.1","type":"linkerd-cni"}`
+
+	var tests = []struct {
+		name        string
+		annotations map[string]string
+		config      string
+		want        bool
+	}{
+		{
+			name:   "no hash",
+			config: config,
+		},
+		{
+			name:        "hash matches",
+			annotations: map[string]string{constants.ConfigHashAnnotation: configHash(config)},
+			config:      config,
+		},
+		{
+			name:        "config is changed",
+			annotations: map[string]string{constants.ConfigHashAnnotation: configHash(config)},
+			config:      `{"cniVersion":"0.3.1","type":"linkerd-cni","log_level":"debug"}`,
+			want:        true,
+		},
+		{
+			name:        "hash is changed",
+			annotations: map[string]string{constants.ConfigHashAnnotation: "sha256:0000"},
+			config:      config,
+			want:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       netattachv1.NetworkAttachmentDefinitionSpec{Config: tt.config},
+			}
+
+			if got := isTampered(multusNetAttach); got != tt.want {
+				t.Errorf("isTampered() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedConfigFields(t *testing.T) {
+	var tests = []struct {
+		name     string
+		current  string
+		required string
+		want     []string
+	}{
+		{
+			name:     "equal configurations",
+			current:  `{"type":"linkerd-cni","linkerd":{"proxy-uid":2102}}`,
+			required: `{"linkerd":{"proxy-uid":2102},"type":"linkerd-cni"}`,
+		},
+		{
+			name:     "nested field is changed",
+			current:  `{"type":"linkerd-cni","linkerd":{"proxy-uid":0,"incoming-proxy-port":4143}}`,
+			required: `{"type":"linkerd-cni","linkerd":{"proxy-uid":2102,"incoming-proxy-port":4143}}`,
+			want:     []string{"linkerd.proxy-uid"},
+		},
+		{
+			name:     "fields are added and removed",
+			current:  `{"type":"linkerd-cni","log_level":"debug"}`,
+			required: `{"type":"linkerd-cni","kubernetes":{"kubeconfig":"/etc/cni/net.d/ZZZ-linkerd-cni-kubeconfig"}}`,
+			want:     []string{"kubernetes", "log_level"},
+		},
+		{
+			name:     "lists are compared as values",
+			current:  `{"linkerd":{"inbound-ports-to-ignore":["4190","4191"]}}`,
+			required: `{"linkerd":{"inbound-ports-to-ignore":["4191","4190"]}}`,
+			want:     []string{"linkerd.inbound-ports-to-ignore"},
+		},
+		{
+			name:     "object is replaced by a value",
+			current:  `{"linkerd":{"proxy-uid":2102}}`,
+			required: `{"linkerd":"none"}`,
+			want:     []string{"linkerd"},
+		},
+		{
+			name:     "current configuration is not a JSON object",
+			current:  `not json`,
+			required: `{"type":"linkerd-cni"}`,
+			want:     []string{"config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changedConfigFields(tt.current, tt.required); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedConfigFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
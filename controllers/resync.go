@@ -0,0 +1,145 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// Resync - reconciles every AttachDefinition and deletes orphaned NetworkAttachmentDefinitions
+// when the operator becomes the leader and then periodically, so the changes which happened
+// while the operator was down, for example, deleted AttachDefinitions, are applied.
+type Resync struct {
+	Reconciler *AttachDefinitionReconciler
+	// Period - if positive, how often the resync is repeated.
+	Period time.Duration
+}
+
+// Start - implements manager.Runnable.
+func (s *Resync) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("resync")
+
+	var resync = func() {
+		if err := s.Reconciler.Resync(ctx); err != nil {
+			logger.Error(err, "can not resync AttachDefinitions and NetworkAttachmentDefinitions")
+		}
+	}
+
+	resync()
+
+	if s.Period <= 0 {
+		<-ctx.Done()
+
+		return nil
+	}
+
+	var ticker = time.NewTicker(s.Period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			resync()
+		}
+	}
+}
+
+// NeedLeaderElection - only the leader changes NetworkAttachmentDefinitions.
+func (s *Resync) NeedLeaderElection() bool {
+	return true
+}
+
+// Resync - reconciles every AttachDefinition and deletes the NetworkAttachmentDefinitions of the operator
+// instance whose AttachDefinition no longer exists.
+func (r *AttachDefinitionReconciler) Resync(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	var errs []error
+
+	if err := r.ReconcileAll(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	var multusNetAttaches = &netattachv1.NetworkAttachmentDefinitionList{}
+
+	if err := r.List(ctx, multusNetAttaches); err != nil {
+		logger.Error(err, "can not list NetworkAttachmentDefinitions")
+
+		return utilerrors.NewAggregate(append(errs, err))
+	}
+
+	for i := range multusNetAttaches.Items {
+		var multusNetAttach = &multusNetAttaches.Items[i]
+
+		if !r.isManagedMultusNetAttach(multusNetAttach) {
+			continue
+		}
+
+		if err := r.deleteOrphanedMultusNetAttach(ctx, client.ObjectKeyFromObject(multusNetAttach)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// isManagedMultusNetAttach - checks if the NetworkAttachmentDefinition is created by the operator instance.
+// Only the instance label set by the operator is considered, NetworkAttachmentDefinitions without it
+// may be created by users.
+func (r *AttachDefinitionReconciler) isManagedMultusNetAttach(
+	multusNetAttach *netattachv1.NetworkAttachmentDefinition) bool {
+	return multusNetAttach.Name == constants.LinkerdCNINetworkAttachmentDefinitionName &&
+		multusNetAttach.Labels[constants.InstanceLabel] == r.instanceName()
+}
+
+// deleteOrphanedMultusNetAttach - deletes the NetworkAttachmentDefinition if its Namespace has no AttachDefinition.
+// The deletion is recorded on the Namespace.
+func (r *AttachDefinitionReconciler) deleteOrphanedMultusNetAttach(ctx context.Context,
+	multusRef client.ObjectKey) error {
+	if r.Config != nil && r.Config.Get().IsNamespaceExcluded(multusRef.Namespace) {
+		return nil
+	}
+
+	// The AttachDefinition may be created after the NetworkAttachmentDefinitions are listed.
+	err := r.Get(ctx, multusRef, &cniv1alpha1.AttachDefinition{})
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	namespaceInstance, err := getNamespaceInstance(ctx, r.Client, multusRef.Namespace)
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("AttachDefinition does not exist, delete orphaned NetworkAttachmentDefinition",
+		"k8s.cni.cncf.io/v1/NetworkAttachmentDefinition", multusRef)
+
+	return r.deleteMultusNetAttach(ctx, multusRef, namespaceInstance, "orphaned",
+		NamespaceReference(multusRef.Namespace))
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+// linkerdNetAttach - the Linkerd NetworkAttachmentDefinition of the Namespace labelled with the instance,
+// an empty instance leaves it unlabelled like NetworkAttachmentDefinitions created by users.
+func linkerdNetAttach(namespace, instance string) *netattachv1.NetworkAttachmentDefinition {
+	var multusNetAttach = &netattachv1.NetworkAttachmentDefinition{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+	}
+
+	if instance != "" {
+		setInstanceLabel(multusNetAttach, instance)
+	}
+
+	return multusNetAttach
+}
+
+func TestIsManagedMultusNetAttach(t *testing.T) {
+	var tests = []struct {
+		name            string
+		instanceName    string
+		multusNetAttach *netattachv1.NetworkAttachmentDefinition
+		want            bool
+	}{
+		{
+			name:            "default instance",
+			multusNetAttach: linkerdNetAttach("app", constants.DefaultInstanceName),
+			want:            true,
+		},
+		{
+			name:            "named instance",
+			instanceName:    "canary",
+			multusNetAttach: linkerdNetAttach("app", "canary"),
+			want:            true,
+		},
+		{
+			name:            "another instance",
+			multusNetAttach: linkerdNetAttach("app", "canary"),
+		},
+		{
+			name:            "not labelled",
+			multusNetAttach: linkerdNetAttach("app", ""),
+		},
+		{
+			name: "another name",
+			multusNetAttach: func() *netattachv1.NetworkAttachmentDefinition {
+				var multusNetAttach = linkerdNetAttach("app", constants.DefaultInstanceName)
+				multusNetAttach.Name = "macvlan"
+
+				return multusNetAttach
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = &AttachDefinitionReconciler{InstanceName: tt.instanceName}
+
+			if got := r.isManagedMultusNetAttach(tt.multusNetAttach); got != tt.want {
+				t.Errorf("isManagedMultusNetAttach() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteOrphanedMultusNetAttach(t *testing.T) {
+	var tests = []struct {
+		name        string
+		objects     []client.Object
+		excluded    []string
+		wantDeleted bool
+	}{
+		{
+			name:        "orphaned",
+			objects:     []client.Object{linkerdNetAttach("app", constants.DefaultInstanceName)},
+			wantDeleted: true,
+		},
+		{
+			name: "AttachDefinition exists",
+			objects: []client.Object{
+				linkerdNetAttach("app", constants.DefaultInstanceName),
+				&cniv1alpha1.AttachDefinition{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: constants.LinkerdCNINetworkAttachmentDefinitionName},
+				},
+			},
+		},
+		{
+			name:     "Namespace is excluded",
+			objects:  []client.Object{linkerdNetAttach("app", constants.DefaultInstanceName)},
+			excluded: []string{"app"},
+		},
+		{
+			name: "Namespace of another instance",
+			objects: []client.Object{
+				linkerdNetAttach("app", ""),
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:   "app",
+					Labels: map[string]string{constants.InstanceLabel: "canary"},
+				}},
+			},
+		},
+		{
+			name: "already deleted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ctx       = context.Background()
+				cfg       = operatorconfig.Default()
+				r         = reconcilerWith(t, tt.objects...)
+				multusRef = client.ObjectKey{Namespace: "app", Name: constants.LinkerdCNINetworkAttachmentDefinitionName}
+			)
+
+			cfg.Exclusions.Namespaces = tt.excluded
+			r.Config = operatorconfig.NewStore(cfg, "", nil)
+
+			if err := r.deleteOrphanedMultusNetAttach(ctx, multusRef); err != nil {
+				t.Fatalf("deleteOrphanedMultusNetAttach() error = %v", err)
+			}
+
+			var exists = len(tt.objects) != 0 && !tt.wantDeleted
+
+			err := r.Get(ctx, multusRef, &netattachv1.NetworkAttachmentDefinition{})
+			if exists && err != nil {
+				t.Errorf("NetworkAttachmentDefinition is not kept: %v", err)
+			}
+
+			if !exists && !apierrors.IsNotFound(err) {
+				t.Errorf("NetworkAttachmentDefinition is not deleted: %v", err)
+			}
+		})
+	}
+}
+
+func TestResyncDeletesOnlyOrphanedMultusNetAttaches(t *testing.T) {
+	var (
+		ctx         = context.Background()
+		userCreated = linkerdNetAttach("user", "")
+		macvlan     = linkerdNetAttach("app", constants.DefaultInstanceName)
+	)
+
+	macvlan.Name = "macvlan"
+
+	var r = reconcilerWith(t,
+		linkerdNetAttach("app", constants.DefaultInstanceName),
+		linkerdNetAttach("canary", "canary"),
+		userCreated,
+		macvlan,
+	)
+	r.Config = operatorconfig.NewStore(operatorconfig.Default(), "", nil)
+
+	if err := r.Resync(ctx); err != nil {
+		t.Fatalf("Resync() error = %v", err)
+	}
+
+	var multusNetAttaches = &netattachv1.NetworkAttachmentDefinitionList{}
+	if err := r.List(ctx, multusNetAttaches); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, multusNetAttach := range multusNetAttaches.Items {
+		got = append(got, multusNetAttach.Namespace+"/"+multusNetAttach.Name)
+	}
+
+	var want = []string{
+		"app/macvlan",
+		"canary/" + constants.LinkerdCNINetworkAttachmentDefinitionName,
+		"user/" + constants.LinkerdCNINetworkAttachmentDefinitionName,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NetworkAttachmentDefinitions after Resync() = %v, want %v", got, want)
+	}
+}
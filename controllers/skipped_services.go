@@ -0,0 +1,220 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
+
+// skippedServices - subnets of the Services referenced by proxyConfig.skipOutboundServices.
+type skippedServices struct {
+	Subnets []string
+	// Unresolved - descriptions of the Services which could not be resolved.
+	Unresolved []string
+}
+
+// serviceKey - returns the Service referenced by the AttachDefinition.
+func serviceKey(ldAttach *cniv1alpha1.AttachDefinition, ref *cniv1alpha1.ServiceReference) client.ObjectKey {
+	var namespace = ref.Namespace
+	if namespace == "" {
+		namespace = ldAttach.Namespace
+	}
+
+	return client.ObjectKey{Namespace: namespace, Name: ref.Name}
+}
+
+// referencesService - checks if the AttachDefinition skips the Service.
+func referencesService(ldAttach *cniv1alpha1.AttachDefinition, key client.ObjectKey) bool {
+	for i := range ldAttach.Spec.Config.SkipOutboundServices {
+		if serviceKey(ldAttach, &ldAttach.Spec.Config.SkipOutboundServices[i]) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveSkippedServices - resolves the Services referenced by the AttachDefinition to single address
+// subnets of their ClusterIPs and endpoint addresses. Ports are not skipped: a port skipped for
+// a Service would be skipped for every destination. Missing Services and ports, and Services
+// outside the watched Namespaces, which the operator can not read, are reported as unresolved.
+func (r *AttachDefinitionReconciler) resolveSkippedServices(ctx context.Context,
+	ldAttach *cniv1alpha1.AttachDefinition) (*skippedServices, error) {
+	var (
+		result  = &skippedServices{}
+		subnets = map[string]bool{}
+	)
+
+	for i := range ldAttach.Spec.Config.SkipOutboundServices {
+		var (
+			ref     = &ldAttach.Spec.Config.SkipOutboundServices[i]
+			key     = serviceKey(ldAttach, ref)
+			service = &corev1.Service{}
+		)
+
+		if r.Config != nil && !r.Config.Get().IsNamespaceWatched(key.Namespace) {
+			result.Unresolved = append(result.Unresolved,
+				fmt.Sprintf("Service %s is not in a watched Namespace", key))
+
+			continue
+		}
+
+		if err := r.Get(ctx, key, service); err != nil {
+			if apierrors.IsNotFound(err) {
+				result.Unresolved = append(result.Unresolved, fmt.Sprintf("Service %s is not found", key))
+
+				continue
+			}
+
+			return nil, err
+		}
+
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			result.Unresolved = append(result.Unresolved, fmt.Sprintf("Service %s is ExternalName", key))
+
+			continue
+		}
+
+		if !hasServicePort(service.Spec.Ports, ref.PortName) {
+			result.Unresolved = append(result.Unresolved,
+				fmt.Sprintf("Service %s has no port %q", key, ref.PortName))
+
+			continue
+		}
+
+		for _, ip := range service.Spec.ClusterIPs {
+			if subnet := hostSubnet(ip); subnet != "" {
+				subnets[subnet] = true
+			}
+		}
+
+		// Headless Services are reached by the endpoint addresses.
+		var endpoints = &corev1.Endpoints{}
+
+		if err := r.Get(ctx, key, endpoints); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, subset := range endpoints.Subsets {
+			if !hasEndpointPort(subset.Ports, ref.PortName) {
+				continue
+			}
+
+			for _, address := range subset.Addresses {
+				if subnet := hostSubnet(address.IP); subnet != "" {
+					subnets[subnet] = true
+				}
+			}
+		}
+	}
+
+	result.Subnets = sortedKeys(subnets)
+
+	return result, nil
+}
+
+// hasServicePort - checks if the Service has the named port, any port if the name is empty.
+func hasServicePort(ports []corev1.ServicePort, name string) bool {
+	for _, port := range ports {
+		if name == "" || port.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasEndpointPort - checks if the endpoints serve the named port, any port if the name is empty.
+func hasEndpointPort(ports []corev1.EndpointPort, name string) bool {
+	for _, port := range ports {
+		if name == "" || port.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applySkippedServices - adds the subnets of the Services to the CNI configuration.
+func applySkippedServices(cfg *CNIPluginConf, services *skippedServices) *CNIPluginConf {
+	cfg.Linkerd.SubnetsToIgnore = appendUnique(cfg.Linkerd.SubnetsToIgnore, services.Subnets...)
+
+	return cfg
+}
+
+// newServicesResolvedCondition - reports the Services which could not be resolved.
+func newServicesResolvedCondition(services *skippedServices) metav1.Condition {
+	if len(services.Unresolved) != 0 {
+		return metav1.Condition{
+			Type:    cniv1alpha1.ConditionServicesResolved,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Unresolved",
+			Message: strings.Join(services.Unresolved, "; "),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    cniv1alpha1.ConditionServicesResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Resolved",
+		Message: "all skipped Services are resolved",
+	}
+}
+
+// hostSubnet - returns a single address subnet of the IP or an empty string for "None" and invalid IPs.
+func hostSubnet(ip string) string {
+	var parsed = net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if parsed.To4() != nil {
+		return parsed.String() + "/32"
+	}
+
+	return parsed.String() + "/128"
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var list = make([]string, 0, len(set))
+
+	for key := range set {
+		list = append(list, key)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
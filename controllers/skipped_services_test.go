@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// serviceWith - a Service with the ClusterIPs and named TCP ports.
+func serviceWith(namespace, name string, clusterIPs []string, ports map[string]int32) *corev1.Service {
+	var service = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.ServiceSpec{ClusterIPs: clusterIPs},
+	}
+
+	for portName, port := range ports {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Name: portName, Port: port})
+	}
+
+	return service
+}
+
+func TestResolveSkippedServices(t *testing.T) {
+	var headlessEndpoints = &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "database", Name: "postgres-headless"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.1.0.12"}, {IP: "fd00::12"}},
+			Ports:     []corev1.EndpointPort{{Name: "postgres", Port: 15432}, {Name: "metrics", Port: 9187}},
+		}, {
+			Addresses: []corev1.EndpointAddress{{IP: "10.1.0.13"}},
+			Ports:     []corev1.EndpointPort{{Name: "metrics", Port: 9187}},
+		}},
+	}
+
+	var externalName = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "database", Name: "rds"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "db.example.com"},
+	}
+
+	var objects = []client.Object{
+		serviceWith("database", "postgres", []string{"10.96.0.10"}, map[string]int32{"postgres": 5432, "metrics": 9187}),
+		serviceWith("database", "postgres-headless", []string{corev1.ClusterIPNone}, map[string]int32{"postgres": 5432}),
+		serviceWith("database", "redis", []string{"10.96.0.20", "fd00:96::20"}, map[string]int32{"redis": 6379}),
+		serviceWith("app", "redis", []string{"10.96.0.30"}, map[string]int32{"redis": 6380}),
+		headlessEndpoints,
+		externalName,
+	}
+
+	var tests = []struct {
+		name string
+		refs []cniv1alpha1.ServiceReference
+		// watchNamespaces - if set, the operator runs in the namespace-scoped mode.
+		watchNamespaces []string
+		wantSubnets     []string
+		wantUnresolved  []string
+	}{
+		{
+			name:        "all ports",
+			refs:        []cniv1alpha1.ServiceReference{{Name: "postgres", Namespace: "database"}},
+			wantSubnets: []string{"10.96.0.10/32"},
+		},
+		{
+			name:        "named port",
+			refs:        []cniv1alpha1.ServiceReference{{Name: "postgres", Namespace: "database", PortName: "postgres"}},
+			wantSubnets: []string{"10.96.0.10/32"},
+		},
+		{
+			name:        "dual-stack Service",
+			refs:        []cniv1alpha1.ServiceReference{{Name: "redis", Namespace: "database"}},
+			wantSubnets: []string{"10.96.0.20/32", "fd00:96::20/128"},
+		},
+		{
+			name:        "Service of the AttachDefinition's Namespace",
+			refs:        []cniv1alpha1.ServiceReference{{Name: "redis"}},
+			wantSubnets: []string{"10.96.0.30/32"},
+		},
+		{
+			name: "headless Service",
+			refs: []cniv1alpha1.ServiceReference{
+				{Name: "postgres-headless", Namespace: "database", PortName: "postgres"},
+			},
+			wantSubnets: []string{"10.1.0.12/32", "fd00::12/128"},
+		},
+		{
+			name:        "headless Service without a port name",
+			refs:        []cniv1alpha1.ServiceReference{{Name: "postgres-headless", Namespace: "database"}},
+			wantSubnets: []string{"10.1.0.12/32", "10.1.0.13/32", "fd00::12/128"},
+		},
+		{
+			name: "namespace-scoped mode",
+			refs: []cniv1alpha1.ServiceReference{
+				{Name: "redis"},
+				{Name: "postgres", Namespace: "database"},
+			},
+			watchNamespaces: []string{"app"},
+			wantSubnets:     []string{"10.96.0.30/32"},
+			wantUnresolved:  []string{"Service database/postgres is not in a watched Namespace"},
+		},
+		{
+			name: "unresolved Services",
+			refs: []cniv1alpha1.ServiceReference{
+				{Name: "mysql", Namespace: "database"},
+				{Name: "rds", Namespace: "database"},
+				{Name: "postgres", Namespace: "database", PortName: "replication"},
+				{Name: "redis", Namespace: "database"},
+			},
+			wantSubnets: []string{"10.96.0.20/32", "fd00:96::20/128"},
+			wantUnresolved: []string{
+				"Service database/mysql is not found",
+				"Service database/rds is ExternalName",
+				`Service database/postgres has no port "replication"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ldAttach = &cniv1alpha1.AttachDefinition{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "attach"},
+			}
+			ldAttach.Spec.Config.SkipOutboundServices = tt.refs
+
+			var (
+				r   = reconcilerWith(t, objects...)
+				cfg = operatorconfig.Default()
+			)
+
+			cfg.Manager.WatchNamespaces = tt.watchNamespaces
+			r.Config = operatorconfig.NewStore(cfg, "", nil)
+
+			got, err := r.resolveSkippedServices(context.Background(), ldAttach)
+			if err != nil {
+				t.Fatalf("resolveSkippedServices() error = %v", err)
+			}
+
+			var want = &skippedServices{
+				Subnets:    tt.wantSubnets,
+				Unresolved: tt.wantUnresolved,
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("resolveSkippedServices() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
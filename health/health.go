@@ -0,0 +1,159 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health implements readiness checks of the operator and an endpoint
+// which reports the result of every check with its failure reason.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// DetailsPath - path of the endpoint with per-check details on the metrics server,
+// the health probe server withholds failure reasons.
+const DetailsPath = "/debug/readyz"
+
+// cacheSyncTimeout - how long a readiness probe waits for the informers.
+const cacheSyncTimeout = time.Second
+
+// nolint:stylecheck // The error text starts from the name of the application, so capital letter.
+var (
+	ErrCacheNotSynced = errors.New("informer caches are not synced")
+	ErrKindNotServed  = errors.New("kind is not served by the API server")
+)
+
+// check - a named readiness check.
+type check struct {
+	name    string
+	checker healthz.Checker
+	// informational - the check is only reported by the details endpoint and does not affect readiness.
+	informational bool
+}
+
+// Checks - readiness checks which are registered in the manager and reported by the details endpoint.
+type Checks struct {
+	checks []check
+}
+
+// CheckResult - result of one check reported by the details endpoint.
+type CheckResult struct {
+	Name          string `json:"name"`
+	Ready         bool   `json:"ready"`
+	Informational bool   `json:"informational,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// Report - results of all checks reported by the details endpoint.
+type Report struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Add - adds a readiness check to the manager and to the details endpoint.
+func (c *Checks) Add(mgr ctrl.Manager, name string, checker healthz.Checker) error {
+	if err := mgr.AddReadyzCheck(name, checker); err != nil {
+		return err
+	}
+
+	c.checks = append(c.checks, check{name: name, checker: checker})
+
+	return nil
+}
+
+// AddInformational - adds a check which is only reported by the details endpoint, its failure
+// does not make the process unready.
+func (c *Checks) AddInformational(name string, checker healthz.Checker) {
+	c.checks = append(c.checks, check{name: name, checker: checker, informational: true})
+}
+
+// Run - runs all checks in the order they were added.
+func (c *Checks) Run(req *http.Request) *Report {
+	var report = &Report{Ready: true, Checks: make([]CheckResult, 0, len(c.checks))}
+
+	for _, chk := range c.checks {
+		var result = CheckResult{Name: chk.name, Ready: true, Informational: chk.informational}
+
+		if err := chk.checker(req); err != nil {
+			result.Ready = false
+			result.Message = err.Error()
+			report.Ready = report.Ready && chk.informational
+		}
+
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+// ServeHTTP - reports the result of every check as JSON, the status code is 503 if any check fails.
+func (c *Checks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var report = c.Run(r)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	// The status code is already written, an encoding error can only be logged by the server.
+	_ = encoder.Encode(report)
+}
+
+// CacheSynced - a check which fails until the manager's informers are synced.
+func CacheSynced(informers cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+
+		if !informers.WaitForCacheSync(ctx) {
+			return ErrCacheNotSynced
+		}
+
+		return nil
+	}
+}
+
+// KindServed - a check which fails if the API server does not serve the kind,
+// for example, if its CRD is not installed.
+func KindServed(client discovery.DiscoveryInterface, groupVersion, kind string) healthz.Checker {
+	return func(_ *http.Request) error {
+		resources, err := client.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return fmt.Errorf("can not discover %s: %w", groupVersion, err)
+		}
+
+		for i := range resources.APIResources {
+			if resources.APIResources[i].Kind == kind {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%w: %s %s", ErrKindNotServed, groupVersion, kind)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// errFailed - error of a failed test check.
+var errFailed = errors.New("failed")
+
+// passed and failed - test checks.
+var (
+	passed = func(_ *http.Request) error { return nil }
+	failed = func(_ *http.Request) error { return errFailed }
+)
+
+func TestChecksServeHTTP(t *testing.T) {
+	var tests = []struct {
+		name       string
+		checks     []check
+		wantStatus int
+		wantReady  []bool
+	}{
+		{
+			name:       "no checks",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "all checks pass",
+			checks:     []check{{name: "cache", checker: passed}, {name: "crd", checker: passed}},
+			wantStatus: http.StatusOK,
+			wantReady:  []bool{true, true},
+		},
+		{
+			name:       "a check fails",
+			checks:     []check{{name: "cache", checker: passed}, {name: "crd", checker: failed}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReady:  []bool{true, false},
+		},
+		{
+			name: "an informational check fails",
+			checks: []check{
+				{name: "cache", checker: passed},
+				{name: "cni-config", checker: failed, informational: true},
+			},
+			wantStatus: http.StatusOK,
+			wantReady:  []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				checks   = &Checks{checks: tt.checks}
+				recorder = httptest.NewRecorder()
+			)
+
+			checks.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DetailsPath, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			var report = &Report{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), report); err != nil {
+				t.Fatalf("can not decode the report %q: %v", recorder.Body.String(), err)
+			}
+
+			if report.Ready != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("ready = %t, want %t", report.Ready, tt.wantStatus == http.StatusOK)
+			}
+
+			if len(report.Checks) != len(tt.wantReady) {
+				t.Fatalf("report has %d checks, want %d", len(report.Checks), len(tt.wantReady))
+			}
+
+			for i, result := range report.Checks {
+				if result.Name != tt.checks[i].name || result.Ready != tt.wantReady[i] {
+					t.Errorf("check %d = %+v, want %s ready %t", i, result, tt.checks[i].name, tt.wantReady[i])
+				}
+
+				if !result.Ready && result.Message != errFailed.Error() {
+					t.Errorf("check %s message = %q, want %q", result.Name, result.Message, errFailed)
+				}
+			}
+		})
+	}
+}
+
+func TestKindServed(t *testing.T) {
+	var discovery = &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{{
+		GroupVersion: "cni.linkerd.io/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "attachdefinitions", Kind: "AttachDefinition"}},
+	}}}}
+
+	var tests = []struct {
+		name         string
+		groupVersion string
+		kind         string
+		wantErr      bool
+	}{
+		{
+			name:         "served",
+			groupVersion: "cni.linkerd.io/v1alpha1",
+			kind:         "AttachDefinition",
+		},
+		{
+			name:         "kind is not served",
+			groupVersion: "cni.linkerd.io/v1alpha1",
+			kind:         "AttachDefinitionPolicy",
+			wantErr:      true,
+		},
+		{
+			name:         "group version is not served",
+			groupVersion: "k8s.cni.cncf.io/v1",
+			kind:         "NetworkAttachmentDefinition",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := KindServed(discovery, tt.groupVersion, tt.kind)(nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KindServed() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
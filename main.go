@@ -17,55 +17,43 @@ limitations under the License.
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
-	"fmt"
 	"os"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	podwebhook "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1"
 	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/certs"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/cmd"
 
 	netattachv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
 	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/controllers"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/health"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/policy"
 	//+kubebuilder:scaffold:imports
 )
 
-const (
-	EnvVarPrefix = "LINKERD_CNI_ATTACH_OPERATOR_"
-
-	EnvInstanceName          = EnvVarPrefix + "INSTANCE"
-	EnvCNIConfigMapNamespace = EnvVarPrefix + "CNI_CM_NAMESPACE"
-	EnvCNIConfigMapName      = EnvVarPrefix + "CNI_CM_NAME"
-	EnvCNIConfigMapKey       = EnvVarPrefix + "CNI_CM_KEY"
-	EnvCNIKubeconfig         = EnvVarPrefix + "KUBECONFIG"
-)
-
-const (
-	DefaultInstanceName = "default"
-
-	DefaultLinkerdCNICMNamespace = "linkerd-cni"
-	DefaultLinkerdCNICMName      = "linkerd-cni-config"
-	DefaultLinkerdCNICMKey       = "cni_network_config"
-
-	// DefaultLinkerdCNIKubeconfigName - used the name which is created by
-	// Linkerd-CNI DaemonSet.
-	DefaultLinkerdCNIKubeconfigPath = "/etc/cni/net.d/ZZZ-linkerd-cni-kubeconfig"
-)
-
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -81,15 +69,12 @@ func init() {
 }
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	var probeAddr string
+	// Run a subcommand instead of the manager if requested.
+	if len(os.Args) > 1 && cmd.IsCommand(os.Args[1]) {
+		os.Exit(cmd.Run(os.Args[1], os.Args[2:]))
+	}
 
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
-		"Enable leader election for controller manager. "+
-			"Enabling this will ensure there is only one active controller manager.")
+	var configFlags = operatorconfig.BindFlags(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -99,108 +84,340 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	// Configure environment.
-	var configMapNamespace = os.Getenv(EnvCNIConfigMapNamespace)
-	if configMapNamespace == "" {
-		configMapNamespace = DefaultLinkerdCNICMNamespace
+	// Configuration: defaults, environment, configuration file and flags.
+	config, err := configFlags.Load()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
 	}
 
-	var configMapName = os.Getenv(EnvCNIConfigMapName)
-	if configMapName == "" {
-		configMapName = DefaultLinkerdCNICMName
-	}
+	var configStore = operatorconfig.NewStore(config, configFlags.ConfigFile, configFlags.Load)
 
-	var configMapKey = os.Getenv(EnvCNIConfigMapKey)
-	if configMapKey == "" {
-		configMapKey = DefaultLinkerdCNICMKey
+	var options = ctrl.Options{
+		Scheme:                 scheme,
+		MetricsBindAddress:     config.Manager.MetricsBindAddress,
+		Port:                   config.Webhook.Port,
+		CertDir:                config.Webhook.CertDir,
+		HealthProbeBindAddress: config.Manager.HealthProbeBindAddress,
+		LeaderElection:         config.Manager.LeaderElect && config.RunsControllers(),
+		LeaderElectionID:       operatorconfig.LeaderElectionID(config.InstanceName),
 	}
 
-	var instanceName = os.Getenv(EnvInstanceName)
-	if instanceName == "" {
-		instanceName = DefaultInstanceName
-	}
+	setupLog.Info("starting components", "components", config.Manager.Components)
 
-	var cniKubeconfig = os.Getenv(EnvCNIKubeconfig)
-	if cniKubeconfig == "" {
-		cniKubeconfig = DefaultLinkerdCNIKubeconfigPath
+	// Every webhook replica serves admission requests, only the controllers need a leader.
+	if config.Manager.LeaderElect && !config.RunsControllers() {
+		setupLog.Info("leader election is not used by the webhook, ignoring")
 	}
 
-	// Check that instance name is not too long.
-	const maxInstanceNameLen = 30
-	if len(instanceName) > maxInstanceNameLen {
-		setupLog.Error(
-			errors.New("instance-name is too long"),
-			fmt.Sprintf("instance name must be no longer than %d symbols", len(instanceName)),
-			"current_length", len(instanceName),
-		)
-		os.Exit(1)
+	// Namespace-scoped mode: watch only the configured Namespaces. Namespaces and ConfigMaps
+	// are read directly as watching them requires cluster-wide or extra Namespaces' permissions.
+	if len(config.Manager.WatchNamespaces) != 0 {
+		setupLog.Info("Namespace-scoped mode", "namespaces", config.Manager.WatchNamespaces)
+
+		options.NewCache = cache.MultiNamespacedCacheBuilder(config.Manager.WatchNamespaces)
+		options.ClientDisableCacheFor = []client.Object{&corev1.Namespace{}, &corev1.ConfigMap{}}
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "cni-attach-operator.linkerd.io",
-	})
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	// Linkerd AttachDefinition controller.
+	if err = mgr.Add(configStore); err != nil {
+		setupLog.Error(err, "unable to watch operator configuration")
+		os.Exit(1)
+	}
+
+	var (
+		ctx    = ctrl.SetupSignalHandler()
+		checks = &health.Checks{}
+	)
+
+	if config.RunsWebhook() && config.Webhook.CertManagement == operatorconfig.CertManagementBuiltIn {
+		if err = setupCertManager(ctx, mgr, config, checks); err != nil {
+			setupLog.Error(err, "unable to set up webhook certificates")
+			os.Exit(1)
+		}
+	}
+
+	// Linkerd AttachDefinition reconciler, the debug endpoint uses it to render configuration in all components.
 	var attachReconciler = &controllers.AttachDefinitionReconciler{
-		Client:        mgr.GetClient(),
-		Scheme:        mgr.GetScheme(),
-		InstanceName:  instanceName,
-		CNIKubeconfig: cniKubeconfig,
-		CNIConfigMapRef: controllers.CNIConfigMapRef{
-			ObjectKey: types.NamespacedName{
-				Namespace: configMapNamespace,
-				Name:      configMapName,
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		InstanceName: config.InstanceName,
+		Recorder:     mgr.GetEventRecorderFor(controllers.EventRecorderName),
+		Config:       configStore,
+	}
+
+	if config.RunsControllers() {
+		if err = setupLastKnownGood(mgr, attachReconciler, config); err != nil {
+			setupLog.Error(err, "unable to set up last known good Linkerd CNI configuration")
+			os.Exit(1)
+		}
+
+		if err = setupControllers(mgr, attachReconciler, config); err != nil {
+			os.Exit(1)
+		}
+	}
+
+	if config.RunsWebhook() {
+		// Create mutating webhook.
+		mgr.GetWebhookServer().Register(constants.PodWebhookPath, &webhook.Admission{
+			Handler: &podwebhook.PodAnnotator{
+				Client:       mgr.GetClient(),
+				Config:       configStore,
+				InstanceName: config.InstanceName,
+				Recorder:     mgr.GetEventRecorderFor(controllers.EventRecorderName),
 			},
-			Key: configMapKey,
+		})
+
+		// Create validating webhook which enforces AttachDefinitionPolicies.
+		mgr.GetWebhookServer().Register(constants.AttachDefinitionPolicyWebhookPath, &webhook.Admission{
+			Handler: &policy.Validator{Client: mgr.GetClient()},
+		})
+	}
+
+	// Debug endpoint which explains the webhook decision for a Pod.
+	if err = mgr.AddMetricsExtraHandler(podwebhook.ExplainPath, &podwebhook.ExplainHandler{
+		Explainer: &podwebhook.Explainer{
+			Client:       mgr.GetClient(),
+			InstanceName: config.InstanceName,
+			Render:       attachReconciler.RenderMultusNetworkAttachDefinition,
+		},
+	}); err != nil {
+		setupLog.Error(err, "unable to register debug handler", "path", podwebhook.ExplainPath)
+		os.Exit(1)
+	}
+
+	//+kubebuilder:scaffold:builder
+
+	// Liveness does not depend on the cluster, unavailable dependencies are reported by the ready checks.
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+
+	if err = setupReadyChecks(mgr, config, attachReconciler, checks); err != nil {
+		setupLog.Error(err, "unable to set up ready checks")
+		os.Exit(1)
+	}
+
+	// Failure reasons of the ready checks, the metrics endpoint is protected by the auth proxy.
+	if err = mgr.AddMetricsExtraHandler(health.DetailsPath, checks); err != nil {
+		setupLog.Error(err, "unable to register debug handler", "path", health.DetailsPath)
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting manager")
+	if err := mgr.Start(ctx); err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
+	}
+}
+
+// setupCertManager - generates the webhook certificates before the webhook server starts
+// and adds their rotation and the readiness check to the manager.
+func setupCertManager(ctx context.Context, mgr ctrl.Manager, config *operatorconfig.Config,
+	checks *health.Checks,
+) error {
+	namespace, err := config.WebhookNamespace()
+	if err != nil {
+		return err
+	}
+
+	// The manager's cache is not started yet.
+	certClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return err
+	}
+
+	var certManager = certs.NewManager(certClient,
+		client.ObjectKey{Namespace: namespace, Name: config.Webhook.SecretName},
+		client.ObjectKey{Namespace: namespace, Name: config.Webhook.ServiceName},
+		config.Webhook.ConfigurationName, config.Webhook.CertDir, config.Webhook.Port)
+	certManager.ValidatingWebhookConfigurationName = config.Webhook.ValidatingConfigurationName
+
+	if err = certManager.Ensure(ctx); err != nil {
+		return err
+	}
+
+	if err = mgr.Add(certManager); err != nil {
+		return err
+	}
+
+	return checks.Add(mgr, "webhook-certificate", certManager.ReadyCheck)
+}
+
+// setupLastKnownGood - stores the last known good Linkerd CNI configurations in a Secret
+// in the operator's Namespace. The fallback is disabled if the Namespace is unknown.
+func setupLastKnownGood(mgr ctrl.Manager, attachReconciler *controllers.AttachDefinitionReconciler,
+	config *operatorconfig.Config,
+) error {
+	namespace, err := config.WebhookNamespace()
+	if err != nil {
+		setupLog.Info("last known good Linkerd CNI configuration is disabled", "reason", err.Error())
+
+		return nil
+	}
+
+	// Secrets are not cached, the manager would watch them in all Namespaces.
+	secretClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return err
+	}
+
+	attachReconciler.LastKnownGood = &controllers.LastKnownGood{
+		Client: secretClient,
+		Secret: client.ObjectKey{
+			Namespace: namespace,
+			Name:      operatorconfig.LastKnownGoodSecretName(config.InstanceName),
 		},
 	}
 
+	return nil
+}
+
+// setupControllers - adds the reconcilers to the manager and re-renders NetworkAttachmentDefinitions
+// when the CNI source or defaults are reloaded.
+func setupControllers(mgr ctrl.Manager, attachReconciler *controllers.AttachDefinitionReconciler,
+	config *operatorconfig.Config,
+) error {
+	var err error
+
+	// Linkerd AttachDefinition controller.
 	if err = attachReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AttachDefinition")
-		os.Exit(1)
+		return err
+	}
+
+	// Progressive rollout of Linkerd CNI ConfigMap changes.
+	if err = (&controllers.CNIRolloutReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		InstanceName: config.InstanceName,
+		Recorder:     mgr.GetEventRecorderFor(controllers.EventRecorderName),
+		Config:       attachReconciler.Config,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CNIRolloutReconciler")
+		return err
 	}
 
 	// Multus NetAttachDefinition controller.
 	if err = (&controllers.MultusNetAttachDefinitionReconciler{
 		Client:                 mgr.GetClient(),
 		Scheme:                 mgr.GetScheme(),
-		InstanceName:           instanceName,
+		InstanceName:           config.InstanceName,
 		AttachReconcileTrigger: attachReconciler.Reconcile,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MultusNetAttachDefinitionReconciler")
-		os.Exit(1)
+		return err
 	}
 
-	// Create mutating webhook.
-	mgr.GetWebhookServer().Register("/annotate-v1-pod", &webhook.Admission{
-		Handler: &podwebhook.PodAnnotator{
-			Client: mgr.GetClient(),
-		},
+	// Pod Multus network-status controller.
+	if err = (&controllers.PodNetworkStatusReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Recorder:     mgr.GetEventRecorderFor(controllers.EventRecorderName),
+		InstanceName: config.InstanceName,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodNetworkStatusReconciler")
+		return err
+	}
+
+	// Detection and remediation of Pods which missed the webhook mutation.
+	if err = (&controllers.MissedMutationReconciler{
+		Client:                   mgr.GetClient(),
+		Scheme:                   mgr.GetScheme(),
+		Recorder:                 mgr.GetEventRecorderFor(controllers.EventRecorderName),
+		KubeClient:               kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		InstanceName:             config.InstanceName,
+		WebhookConfigurationName: config.Webhook.ConfigurationName,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MissedMutationReconciler")
+		return err
+	}
+
+	// Changes missed while the operator was down are applied at startup and periodically.
+	if err = mgr.Add(&controllers.Resync{
+		Reconciler: attachReconciler,
+		Period:     config.Manager.ResyncPeriod.Duration,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up resync")
+		return err
+	}
+
+	// Namespaces with and without the NetworkAttachmentDefinition are counted on scrape.
+	if err = ctrlmetrics.Registry.Register(&controllers.NamespaceCollector{
+		Client:       mgr.GetClient(),
+		InstanceName: config.InstanceName,
+		Config:       attachReconciler.Config,
+	}); err != nil {
+		setupLog.Error(err, "unable to register metrics collector", "collector", "NamespaceCollector")
+		return err
+	}
+
+	// Re-render NetworkAttachmentDefinitions when the CNI source or defaults are reloaded.
+	attachReconciler.Config.AddReloadHandler(func(ctx context.Context) {
+		select {
+		case <-mgr.Elected():
+		default:
+			return
+		}
+
+		if err := attachReconciler.ReconcileAll(ctx); err != nil {
+			setupLog.Error(err, "can not reconcile AttachDefinitions after configuration reload")
+		}
 	})
 
-	//+kubebuilder:scaffold:builder
+	return nil
+}
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+// setupReadyChecks - adds the ready checks of the components run by the process.
+func setupReadyChecks(mgr ctrl.Manager, config *operatorconfig.Config,
+	attachReconciler *controllers.AttachDefinitionReconciler, checks *health.Checks,
+) error {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+
+	// Both the controllers and the webhook read AttachDefinitions and NetworkAttachmentDefinitions from the cache.
+	if err = checks.Add(mgr, "informers", health.CacheSynced(mgr.GetCache())); err != nil {
+		return err
 	}
 
-	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		setupLog.Error(err, "problem running manager")
-		os.Exit(1)
+	if err = checks.Add(mgr, "multus-crd", health.KindServed(discoveryClient,
+		constants.MultusNetworkAttachmentDefinitionAPIVersion,
+		constants.MultusNetworkAttachmentDefinitionResourceKind)); err != nil {
+		return err
+	}
+
+	// The webhook must stay ready while the CNI source is broken: Pods admitted without it are not mutated.
+	// The source state is reported by the details endpoint, the conditions and the metrics instead.
+	if config.RunsControllers() {
+		if config.RunsWebhook() {
+			checks.AddInformational("cni-source", attachReconciler.CNISourceCheck)
+		} else if err = checks.Add(mgr, "cni-source", attachReconciler.CNISourceCheck); err != nil {
+			return err
+		}
+
+		checks.AddInformational("cni-source-degraded", attachReconciler.CNISourceDegradedCheck)
 	}
+
+	if !config.RunsWebhook() {
+		return nil
+	}
+
+	if err = checks.Add(mgr, "webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		return err
+	}
+
+	// The BuiltIn certificate manager adds its own check which also verifies the injected CA bundle.
+	if config.Webhook.CertManagement == operatorconfig.CertManagementExternal {
+		return checks.Add(mgr, "webhook-certificate", certs.ServingCertificateCheck(config.Webhook.CertDir))
+	}
+
+	return nil
 }
@@ -0,0 +1,146 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines Prometheus metrics of the operator.
+// The metrics are registered in the controller-runtime registry, so they are
+// exposed by the manager's metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "linkerd_cni_attach"
+
+// Operations on Multus NetworkAttachmentDefinitions.
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Outcomes of the pod webhook.
+const (
+	OutcomeAttached            = "attached"
+	OutcomeSkippedNotRequested = "skipped-not-requested"
+	OutcomeSkippedOptOut       = "skipped-opt-out"
+	OutcomeSkippedExcluded     = "skipped-excluded"
+	OutcomeSkippedInstance     = "skipped-other-instance"
+	OutcomeErrorNoNAD          = "error-no-nad"
+	OutcomeDeniedProxyConflict = "denied-proxy-conflict"
+	OutcomeDeniedPolicy        = "denied-policy"
+	OutcomeError               = "error"
+)
+
+var (
+	// PodsWithoutCNI - number of meshed Pods per Namespace for which Multus did not report
+	// a successful Linkerd CNI attachment.
+	PodsWithoutCNI = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pods_without_cni",
+		Help:      "Number of meshed Pods whose Multus network-status lacks the Linkerd CNI network or is invalid.",
+	}, []string{"namespace"})
+
+	// PodCNIAttachFailures - number of detected Pods without Linkerd CNI attachment by reason.
+	PodCNIAttachFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pod_cni_attach_failures_total",
+		Help:      "Number of times a meshed Pod was detected without Linkerd CNI attachment.",
+	}, []string{"namespace", "reason"})
+
+	// PodsMissedMutation - number of meshed Pods per Namespace which were not mutated by the webhook.
+	PodsMissedMutation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pods_missed_mutation",
+		Help:      "Number of Pods with Linkerd proxy which were created without Linkerd CNI network.",
+	}, []string{"namespace"})
+
+	// PodEvictions - number of evictions of Pods which missed mutation by result.
+	PodEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pod_evictions_total",
+		Help:      "Number of eviction attempts of Pods which missed the webhook mutation.",
+	}, []string{"namespace", "result"})
+
+	// NetworkAttachmentDefinitionOperations - number of changes of Multus NetworkAttachmentDefinitions
+	// by operation and reason.
+	NetworkAttachmentDefinitionOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "network_attachment_definition_operations_total",
+		Help:      "Number of Multus NetworkAttachmentDefinitions created, updated and deleted by the operator.",
+	}, []string{"operation", "reason"})
+
+	// ConfigDrift - number of times an existing NetworkAttachmentDefinition differed from the rendered one.
+	ConfigDrift = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_drift_total",
+		Help:      "Number of times a NetworkAttachmentDefinition differed from the configuration rendered by the operator.",
+	}, []string{"namespace"})
+
+	// CNISourceLoadFailures - number of failures to load the Linkerd CNI configuration by reason.
+	CNISourceLoadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cni_source_load_failures_total",
+		Help:      "Number of failures to load the Linkerd CNI ConfigMap or linkerd-config.",
+	}, []string{"reason"})
+
+	// CNISourceDegraded - whether NetworkAttachmentDefinitions are rendered from the last known good
+	// configuration of an invalid Linkerd CNI source.
+	CNISourceDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cni_source_degraded",
+		Help:      "1 if the Linkerd CNI ConfigMap is invalid and its last known good configuration is used, 0 otherwise.",
+	}, []string{"config_map", "key"})
+
+	// WebhookDecisions - number of pod webhook decisions by outcome.
+	WebhookDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_decisions_total",
+		Help:      "Number of Pod admission requests handled by the webhook by outcome.",
+	}, []string{"outcome"})
+
+	// WebhookDuration - latency of the pod webhook by outcome.
+	WebhookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_duration_seconds",
+		Help:      "Latency of Pod admission requests handled by the webhook.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"outcome"})
+
+	// NamespacesDesc - Namespaces which expect a Linkerd CNI NetworkAttachmentDefinition by its presence,
+	// it is collected on scrape by a collector with access to the cluster.
+	NamespacesDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "namespaces"),
+		"Number of Namespaces which request Linkerd injection or have an AttachDefinition "+
+			"with and without the Linkerd CNI NetworkAttachmentDefinition.",
+		[]string{"network_attachment_definition"}, nil)
+)
+
+// nolint:gochecknoinits // metrics must be registered before the manager starts serving them.
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		PodsWithoutCNI,
+		PodCNIAttachFailures,
+		PodsMissedMutation,
+		PodEvictions,
+		NetworkAttachmentDefinitionOperations,
+		ConfigDrift,
+		CNISourceLoadFailures,
+		CNISourceDegraded,
+		WebhookDecisions,
+		WebhookDuration,
+	)
+}
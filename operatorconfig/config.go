@@ -0,0 +1,556 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operatorconfig defines the versioned configuration file of the operator,
+// its validation, command-line flag equivalents and reload on file changes.
+package operatorconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+const (
+	APIVersion = "config.cni.linkerd.io/v1alpha1"
+	Kind       = "OperatorConfig"
+
+	// MaxInstanceNameLen - instance name is used as a part of resource names, so it is limited.
+	MaxInstanceNameLen = 30
+
+	DefaultMetricsBindAddress     = ":8080"
+	DefaultHealthProbeBindAddress = ":8081"
+	DefaultWebhookPort            = 9443
+	DefaultWebhookCertDir         = "/tmp/k8s-webhook-server/serving-certs"
+	DefaultResyncPeriod           = 10 * time.Minute
+
+	// CertManagementExternal - webhook certificates are provided in the certificate directory,
+	// for example, by cert-manager.
+	CertManagementExternal = "External"
+	// CertManagementBuiltIn - the operator generates, injects and rotates webhook certificates.
+	CertManagementBuiltIn = "BuiltIn"
+
+	// ProxyConflictsWarn - the webhook admits Pods which conflict with the proxy with warnings.
+	ProxyConflictsWarn = "Warn"
+	// ProxyConflictsDeny - the webhook denies Pods which conflict with the proxy.
+	ProxyConflictsDeny = "Deny"
+
+	// ComponentsAll - the process runs the controllers and the webhook.
+	ComponentsAll = "all"
+	// ComponentsControllers - the process runs only the controllers, it needs leader election
+	// to run several replicas.
+	ComponentsControllers = "controllers"
+	// ComponentsWebhook - the process runs only the webhook and can be scaled horizontally
+	// without leader election.
+	ComponentsWebhook = "webhook"
+
+	// Names of the webhook objects created by the kustomize manifests.
+	DefaultWebhookServiceName       = "linkerd-multus-operator-webhook-service"
+	DefaultWebhookSecretName        = "linkerd-multus-operator-webhook-server-cert"
+	DefaultWebhookConfigurationName = "linkerd-multus-operator-mutating-webhook-configuration"
+
+	DefaultValidatingWebhookConfigurationName = "linkerd-multus-operator-validating-webhook-configuration"
+
+	// serviceAccountNamespaceFile - file with the Pod's Namespace mounted with the ServiceAccount token.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// ConfigMapKeyRef - reference to a key of a ConfigMap.
+type ConfigMapKeyRef struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// CNISources - Linkerd CNI sources which AttachDefinitions may reference in addition to the operator's ones.
+type CNISources struct {
+	// ConfigMaps - allowed Linkerd CNI ConfigMaps, an empty key allows any key of the ConfigMap.
+	ConfigMaps []ConfigMapKeyRef `json:"configMaps,omitempty"`
+	// Kubeconfigs - allowed paths to Linkerd CNI kubeconfigs on nodes.
+	Kubeconfigs []string `json:"kubeconfigs,omitempty"`
+}
+
+// Manager - settings of the controller manager.
+type Manager struct {
+	MetricsBindAddress     string `json:"metricsBindAddress,omitempty"`
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+	LeaderElect            bool   `json:"leaderElect,omitempty"`
+	// Components - the components run by the process: all, controllers or webhook.
+	Components string `json:"components,omitempty"`
+	// WatchNamespaces - if set, the operator watches and mutates objects only in these Namespaces
+	// and can run with namespaced Roles instead of ClusterRoles.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// ResyncPeriod - how often all AttachDefinitions are reconciled and orphaned NetworkAttachmentDefinitions
+	// are deleted in addition to the pass at startup, 0 disables the periodic resync.
+	ResyncPeriod metav1.Duration `json:"resyncPeriod,omitempty"`
+}
+
+// Webhook - settings of the webhook server.
+type Webhook struct {
+	Port    int    `json:"port,omitempty"`
+	CertDir string `json:"certDir,omitempty"`
+
+	// CertManagement - External or BuiltIn.
+	CertManagement string `json:"certManagement,omitempty"`
+	// ProxyConflicts - Warn or Deny Pods whose containers run as the proxy UID or declare
+	// ports which are used or skipped by the proxy.
+	ProxyConflicts string `json:"proxyConflicts,omitempty"`
+	// Namespace - Namespace of the webhook Service and Secret in the BuiltIn mode and of the Secret
+	// with the last known good Linkerd CNI configurations, the operator's Namespace if not set.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceName - the webhook Service, the serving certificate is issued for its DNS names.
+	ServiceName string `json:"serviceName,omitempty"`
+	// SecretName - Secret which stores the generated CA and serving certificate.
+	SecretName string `json:"secretName,omitempty"`
+	// ConfigurationName - MutatingWebhookConfiguration which gets the generated CA bundle.
+	ConfigurationName string `json:"configurationName,omitempty"`
+	// ValidatingConfigurationName - ValidatingWebhookConfiguration which gets the generated CA bundle.
+	ValidatingConfigurationName string `json:"validatingConfigurationName,omitempty"`
+}
+
+// Exclusions - objects which the operator does not manage.
+type Exclusions struct {
+	// Namespaces - the webhook does not mutate Pods and the reconciler does not
+	// create NetworkAttachmentDefinitions in these Namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Config - the operator configuration file.
+// InstanceName, Manager and Webhook are structural settings which are applied only at startup,
+// other settings are reloaded when the file changes.
+type Config struct {
+	metav1.TypeMeta `json:",inline"`
+
+	InstanceName string `json:"instanceName,omitempty"`
+	// CNIConfigMap - Linkerd CNI ConfigMap which is the base of the rendered CNI configuration.
+	CNIConfigMap  ConfigMapKeyRef `json:"cniConfigMap,omitempty"`
+	CNIKubeconfig string          `json:"cniKubeconfig,omitempty"`
+	// AllowedCNISources - CNI sources which AttachDefinitions may reference.
+	AllowedCNISources CNISources `json:"allowedCNISources,omitempty"`
+	Manager           Manager    `json:"manager,omitempty"`
+	Webhook           Webhook    `json:"webhook,omitempty"`
+	Exclusions        Exclusions `json:"exclusions,omitempty"`
+
+	// LinkerdConfig - Linkerd control plane ConfigMap with Helm values whose proxy settings
+	// are applied on top of the Linkerd CNI ConfigMap. Not used if not set.
+	LinkerdConfig *ConfigMapKeyRef `json:"linkerdConfig,omitempty"`
+
+	// Defaults - Linkerd proxy settings applied on top of the Linkerd CNI ConfigMap and linkerd-config
+	// and below the settings of an AttachDefinition.
+	Defaults cniv1alpha1.ProxyConfig `json:"defaults,omitempty"`
+}
+
+// Default - returns the default configuration.
+func Default() *Config {
+	return &Config{
+		TypeMeta:     metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind},
+		InstanceName: constants.DefaultInstanceName,
+		CNIConfigMap: ConfigMapKeyRef{
+			Namespace: constants.DefaultLinkerdCNICMNamespace,
+			Name:      constants.DefaultLinkerdCNICMName,
+			Key:       constants.DefaultLinkerdCNICMKey,
+		},
+		CNIKubeconfig: constants.DefaultLinkerdCNIKubeconfigPath,
+		Manager: Manager{
+			MetricsBindAddress:     DefaultMetricsBindAddress,
+			HealthProbeBindAddress: DefaultHealthProbeBindAddress,
+			Components:             ComponentsAll,
+			ResyncPeriod:           metav1.Duration{Duration: DefaultResyncPeriod},
+		},
+		Webhook: Webhook{
+			Port:              DefaultWebhookPort,
+			CertDir:           DefaultWebhookCertDir,
+			CertManagement:    CertManagementExternal,
+			ProxyConflicts:    ProxyConflictsWarn,
+			ServiceName:       DefaultWebhookServiceName,
+			SecretName:        DefaultWebhookSecretName,
+			ConfigurationName: DefaultWebhookConfigurationName,
+
+			ValidatingConfigurationName: DefaultValidatingWebhookConfigurationName,
+		},
+	}
+}
+
+// ApplyEnv - applies the LINKERD_CNI_ATTACH_OPERATOR_* environment variables
+// which were used to configure the operator before the configuration file.
+func (c *Config) ApplyEnv() {
+	for env, value := range map[string]*string{
+		constants.EnvInstanceName:          &c.InstanceName,
+		constants.EnvCNIConfigMapNamespace: &c.CNIConfigMap.Namespace,
+		constants.EnvCNIConfigMapName:      &c.CNIConfigMap.Name,
+		constants.EnvCNIConfigMapKey:       &c.CNIConfigMap.Key,
+		constants.EnvCNIKubeconfig:         &c.CNIKubeconfig,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*value = v
+		}
+	}
+}
+
+// ApplyFile - applies settings from a configuration file on top of the current ones.
+// Unknown fields are rejected.
+func (c *Config) ApplyFile(path string) error {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	var typeMeta = &metav1.TypeMeta{}
+
+	if err = yaml.Unmarshal(raw, typeMeta); err != nil {
+		return fmt.Errorf("can not decode %s: %w", path, err)
+	}
+
+	if typeMeta.APIVersion != APIVersion || typeMeta.Kind != Kind {
+		return fmt.Errorf("%s: unsupported configuration %s, %s; expected %s, %s",
+			path, typeMeta.APIVersion, typeMeta.Kind, APIVersion, Kind)
+	}
+
+	if err = yaml.UnmarshalStrict(raw, c); err != nil {
+		return fmt.Errorf("can not decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// PodWebhookName - returns the name of the instance's pod webhook in its MutatingWebhookConfiguration.
+// The default instance keeps the unprefixed name.
+func PodWebhookName(instance string) string {
+	if instance == "" || instance == constants.DefaultInstanceName {
+		return constants.PodWebhookName
+	}
+
+	return instance + "." + constants.PodWebhookName
+}
+
+// LeaderElectionID - returns the name of the instance's leader election lock,
+// so replicas of different instances do not compete for the same lock.
+func LeaderElectionID(instance string) string {
+	if instance == "" || instance == constants.DefaultInstanceName {
+		return constants.LeaderElectionID
+	}
+
+	return instance + "." + constants.LeaderElectionID
+}
+
+// LastKnownGoodSecretName - returns the name of the instance's Secret with the last known good
+// Linkerd CNI configurations, so instances do not overwrite each other's Secrets.
+func LastKnownGoodSecretName(instance string) string {
+	if instance == "" || instance == constants.DefaultInstanceName {
+		return constants.LastKnownGoodSecretName
+	}
+
+	return instance + "-" + constants.LastKnownGoodSecretName
+}
+
+// IsCNIConfigMapAllowed - checks if an AttachDefinition may reference the Linkerd CNI ConfigMap key.
+// The operator's own ConfigMap is always allowed.
+func (c *Config) IsCNIConfigMapAllowed(namespace, name, key string) bool {
+	if c.CNIConfigMap == (ConfigMapKeyRef{Namespace: namespace, Name: name, Key: key}) {
+		return true
+	}
+
+	for _, allowed := range c.AllowedCNISources.ConfigMaps {
+		if allowed.Namespace == namespace && allowed.Name == name && (allowed.Key == "" || allowed.Key == key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsCNIKubeconfigAllowed - checks if an AttachDefinition may reference the Linkerd CNI kubeconfig path.
+// The operator's own path is always allowed.
+func (c *Config) IsCNIKubeconfigAllowed(path string) bool {
+	if path == c.CNIKubeconfig {
+		return true
+	}
+
+	for _, allowed := range c.AllowedCNISources.Kubeconfigs {
+		if allowed == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsNamespaceWatched - checks if the Namespace is in the operator's scope.
+func (c *Config) IsNamespaceWatched(namespace string) bool {
+	if len(c.Manager.WatchNamespaces) == 0 {
+		return true
+	}
+
+	for _, watched := range c.Manager.WatchNamespaces {
+		if watched == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunsControllers - checks if the process runs the controllers.
+func (c *Config) RunsControllers() bool {
+	return c.Manager.Components == ComponentsAll || c.Manager.Components == ComponentsControllers
+}
+
+// RunsWebhook - checks if the process serves the webhook.
+func (c *Config) RunsWebhook() bool {
+	return c.Manager.Components == ComponentsAll || c.Manager.Components == ComponentsWebhook
+}
+
+// IsNamespaceExcluded - checks if the operator must not manage the Namespace.
+func (c *Config) IsNamespaceExcluded(namespace string) bool {
+	for _, excluded := range c.Exclusions.Namespaces {
+		if excluded == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate - returns all validation errors of the configuration.
+func (c *Config) Validate() error {
+	var errs field.ErrorList
+
+	if len(c.InstanceName) > MaxInstanceNameLen {
+		errs = append(errs, field.TooLong(field.NewPath("instanceName"), c.InstanceName, MaxInstanceNameLen))
+	}
+
+	errs = append(errs, validateDNS1123Label(field.NewPath("instanceName"), c.InstanceName)...)
+
+	var cmPath = field.NewPath("cniConfigMap")
+
+	errs = append(errs, validateDNS1123Label(cmPath.Child("namespace"), c.CNIConfigMap.Namespace)...)
+
+	for _, msg := range validation.IsDNS1123Subdomain(c.CNIConfigMap.Name) {
+		errs = append(errs, field.Invalid(cmPath.Child("name"), c.CNIConfigMap.Name, msg))
+	}
+
+	for _, msg := range validation.IsConfigMapKey(c.CNIConfigMap.Key) {
+		errs = append(errs, field.Invalid(cmPath.Child("key"), c.CNIConfigMap.Key, msg))
+	}
+
+	if !filepath.IsAbs(c.CNIKubeconfig) {
+		errs = append(errs, field.Invalid(field.NewPath("cniKubeconfig"), c.CNIKubeconfig, "must be an absolute path"))
+	}
+
+	var sourcesPath = field.NewPath("allowedCNISources")
+
+	for i, cm := range c.AllowedCNISources.ConfigMaps {
+		var path = sourcesPath.Child("configMaps").Index(i)
+
+		errs = append(errs, validateDNS1123Label(path.Child("namespace"), cm.Namespace)...)
+
+		for _, msg := range validation.IsDNS1123Subdomain(cm.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), cm.Name, msg))
+		}
+
+		if cm.Key == "" {
+			continue
+		}
+
+		for _, msg := range validation.IsConfigMapKey(cm.Key) {
+			errs = append(errs, field.Invalid(path.Child("key"), cm.Key, msg))
+		}
+	}
+
+	for i, kubeconfig := range c.AllowedCNISources.Kubeconfigs {
+		if !filepath.IsAbs(kubeconfig) {
+			errs = append(errs, field.Invalid(sourcesPath.Child("kubeconfigs").Index(i), kubeconfig,
+				"must be an absolute path"))
+		}
+	}
+
+	if c.LinkerdConfig != nil {
+		var path = field.NewPath("linkerdConfig")
+
+		errs = append(errs, validateDNS1123Label(path.Child("namespace"), c.LinkerdConfig.Namespace)...)
+
+		for _, msg := range validation.IsDNS1123Subdomain(c.LinkerdConfig.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), c.LinkerdConfig.Name, msg))
+		}
+
+		for _, msg := range validation.IsConfigMapKey(c.LinkerdConfig.Key) {
+			errs = append(errs, field.Invalid(path.Child("key"), c.LinkerdConfig.Key, msg))
+		}
+	}
+
+	for _, msg := range validation.IsValidPortNum(c.Webhook.Port) {
+		errs = append(errs, field.Invalid(field.NewPath("webhook", "port"), c.Webhook.Port, msg))
+	}
+
+	if c.Webhook.CertDir == "" {
+		errs = append(errs, field.Required(field.NewPath("webhook", "certDir"), ""))
+	}
+
+	errs = append(errs, c.validateCertManagement()...)
+
+	if c.Webhook.ProxyConflicts != ProxyConflictsWarn && c.Webhook.ProxyConflicts != ProxyConflictsDeny {
+		errs = append(errs, field.NotSupported(field.NewPath("webhook", "proxyConflicts"), c.Webhook.ProxyConflicts,
+			[]string{ProxyConflictsWarn, ProxyConflictsDeny}))
+	}
+
+	switch c.Manager.Components {
+	case ComponentsAll, ComponentsControllers, ComponentsWebhook:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("manager", "components"), c.Manager.Components,
+			[]string{ComponentsAll, ComponentsControllers, ComponentsWebhook}))
+	}
+
+	if c.Manager.ResyncPeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("manager", "resyncPeriod"),
+			c.Manager.ResyncPeriod.Duration.String(), "must not be negative"))
+	}
+
+	for i, namespace := range c.Manager.WatchNamespaces {
+		errs = append(errs, validateDNS1123Label(field.NewPath("manager", "watchNamespaces").Index(i), namespace)...)
+	}
+
+	for i, namespace := range c.Exclusions.Namespaces {
+		errs = append(errs, validateDNS1123Label(field.NewPath("exclusions", "namespaces").Index(i), namespace)...)
+	}
+
+	errs = append(errs, ValidateProxyConfig(field.NewPath("defaults"), &c.Defaults)...)
+
+	return errs.ToAggregate()
+}
+
+func (c *Config) validateCertManagement() field.ErrorList {
+	var (
+		errs field.ErrorList
+		path = field.NewPath("webhook")
+	)
+
+	switch c.Webhook.CertManagement {
+	case CertManagementExternal:
+		return nil
+	case CertManagementBuiltIn:
+	default:
+		return append(errs, field.NotSupported(path.Child("certManagement"), c.Webhook.CertManagement,
+			[]string{CertManagementExternal, CertManagementBuiltIn}))
+	}
+
+	if c.Webhook.Namespace != "" {
+		errs = append(errs, validateDNS1123Label(path.Child("namespace"), c.Webhook.Namespace)...)
+	}
+
+	errs = append(errs, validateDNS1123Label(path.Child("serviceName"), c.Webhook.ServiceName)...)
+
+	for name, value := range map[string]string{
+		"secretName":                  c.Webhook.SecretName,
+		"configurationName":           c.Webhook.ConfigurationName,
+		"validatingConfigurationName": c.Webhook.ValidatingConfigurationName,
+	} {
+		for _, msg := range validation.IsDNS1123Subdomain(value) {
+			errs = append(errs, field.Invalid(path.Child(name), value, msg))
+		}
+	}
+
+	return errs
+}
+
+// WebhookNamespace - returns the Namespace of the webhook objects and the last known good Secret:
+// the configured one or the operator's Pod Namespace.
+func (c *Config) WebhookNamespace() (string, error) {
+	if c.Webhook.Namespace != "" {
+		return c.Webhook.Namespace, nil
+	}
+
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("webhook.namespace is not set and the operator's Namespace is unknown: %w", err)
+	}
+
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// ValidateProxyConfig - validates ports and port ranges of a ProxyConfig.
+func ValidateProxyConfig(path *field.Path, cfg *cniv1alpha1.ProxyConfig) field.ErrorList {
+	var errs field.ErrorList
+
+	for name, ports := range map[string][]cniv1alpha1.Ports{
+		"skipInboundPorts":  cfg.SkipInboundPorts,
+		"skipOutboundPorts": cfg.SkipOutboundPorts,
+	} {
+		for i := range ports {
+			if ports[i].Range == "" {
+				continue
+			}
+
+			if _, _, err := ParsePortRange(ports[i].Range); err != nil {
+				errs = append(errs, field.Invalid(path.Child(name).Index(i).Child("range"), ports[i].Range, err.Error()))
+			}
+		}
+	}
+
+	return errs
+}
+
+// maxPort - the greatest TCP port.
+const maxPort = 65535
+
+// ParsePortRange - parses a port range in a form of "first-last" with the ports within 0-65535.
+func ParsePortRange(portRange string) (first, last int, err error) {
+	var parts = strings.SplitN(portRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("port range must be in a form of first-last")
+	}
+
+	if first, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, err
+	}
+
+	if last, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, err
+	}
+
+	for _, port := range []int{first, last} {
+		if port < 0 || port > maxPort {
+			return 0, 0, fmt.Errorf("port %d is out of range 0-%d", port, maxPort)
+		}
+	}
+
+	if first > last {
+		return 0, 0, fmt.Errorf("first port %d is greater than last port %d", first, last)
+	}
+
+	return first, last, nil
+}
+
+func validateDNS1123Label(path *field.Path, value string) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, msg := range validation.IsDNS1123Label(value) {
+		errs = append(errs, field.Invalid(path, value, msg))
+	}
+
+	return errs
+}
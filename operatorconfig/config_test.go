@@ -0,0 +1,386 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+func TestParsePortRange(t *testing.T) {
+	var tests = []struct {
+		portRange   string
+		first, last int
+		wantErr     bool
+	}{
+		{portRange: "8000-8100", first: 8000, last: 8100},
+		{portRange: "443-443", first: 443, last: 443},
+		{portRange: "443", wantErr: true},
+		{portRange: "8100-8000", wantErr: true},
+		{portRange: "a-100", wantErr: true},
+		{portRange: "100-", wantErr: true},
+		{portRange: "0-65535", first: 0, last: 65535},
+		{portRange: "8000-65536", wantErr: true},
+		{portRange: "70000-80000", wantErr: true},
+		{portRange: "-1-100", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.portRange, func(t *testing.T) {
+			first, last, err := ParsePortRange(tt.portRange)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortRange() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if first != tt.first || last != tt.last {
+				t.Errorf("ParsePortRange() = %d, %d, want %d, %d", first, last, tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		modify func(*Config)
+		// wantErrs - fields which must be reported, no errors are expected if empty.
+		wantErrs []string
+	}{
+		{
+			name:   "default configuration",
+			modify: func(*Config) {},
+		},
+		{
+			name: "too long instance name",
+			modify: func(c *Config) {
+				c.InstanceName = strings.Repeat("a", MaxInstanceNameLen+1)
+			},
+			wantErrs: []string{"instanceName"},
+		},
+		{
+			name: "invalid CNI ConfigMap reference",
+			modify: func(c *Config) {
+				c.CNIConfigMap = ConfigMapKeyRef{Namespace: "Linkerd", Name: "cni_config", Key: "a/b"}
+			},
+			wantErrs: []string{"cniConfigMap.namespace", "cniConfigMap.name", "cniConfigMap.key"},
+		},
+		{
+			name: "relative kubeconfig path",
+			modify: func(c *Config) {
+				c.CNIKubeconfig = "ZZZ-linkerd-cni-kubeconfig"
+			},
+			wantErrs: []string{"cniKubeconfig"},
+		},
+		{
+			name: "invalid webhook server settings",
+			modify: func(c *Config) {
+				c.Webhook.Port = 70000
+				c.Webhook.CertDir = ""
+			},
+			wantErrs: []string{"webhook.port", "webhook.certDir"},
+		},
+		{
+			name: "invalid excluded Namespace",
+			modify: func(c *Config) {
+				c.Exclusions.Namespaces = []string{"kube-system", "kube_public"}
+			},
+			wantErrs: []string{"exclusions.namespaces[1]"},
+		},
+		{
+			name: "invalid default port range",
+			modify: func(c *Config) {
+				c.Defaults.SkipInboundPorts = []cniv1alpha1.Ports{{Port: 25}, {Range: "9000-8000"}}
+			},
+			wantErrs: []string{"defaults.skipInboundPorts[1].range"},
+		},
+		{
+			name: "allowed ConfigMap without a key",
+			modify: func(c *Config) {
+				c.AllowedCNISources.ConfigMaps = []ConfigMapKeyRef{{Namespace: "linkerd-canary", Name: "linkerd-cni-config"}}
+			},
+		},
+		{
+			name: "invalid allowed CNI sources",
+			modify: func(c *Config) {
+				c.AllowedCNISources.ConfigMaps = []ConfigMapKeyRef{{Namespace: "linkerd-canary", Name: "Linkerd", Key: "a/b"}}
+				c.AllowedCNISources.Kubeconfigs = []string{"/etc/cni/net.d/kubeconfig", "kubeconfig"}
+			},
+			wantErrs: []string{
+				"allowedCNISources.configMaps[0].name", "allowedCNISources.configMaps[0].key",
+				"allowedCNISources.kubeconfigs[1]",
+			},
+		},
+		{
+			name: "invalid linkerd-config reference",
+			modify: func(c *Config) {
+				c.LinkerdConfig = &ConfigMapKeyRef{Namespace: "linkerd", Name: "linkerd-config"}
+			},
+			wantErrs: []string{"linkerdConfig.key"},
+		},
+		{
+			name: "invalid watched Namespace",
+			modify: func(c *Config) {
+				c.Manager.WatchNamespaces = []string{"apps", "Apps"}
+			},
+			wantErrs: []string{"manager.watchNamespaces[1]"},
+		},
+		{
+			name: "unsupported certificate management",
+			modify: func(c *Config) {
+				c.Webhook.CertManagement = "Manual"
+			},
+			wantErrs: []string{"webhook.certManagement"},
+		},
+		{
+			name: "built-in certificates with invalid object names",
+			modify: func(c *Config) {
+				c.Webhook.CertManagement = CertManagementBuiltIn
+				c.Webhook.ServiceName = "webhook.service"
+				c.Webhook.SecretName = "Secret"
+			},
+			wantErrs: []string{"webhook.serviceName", "webhook.secretName"},
+		},
+		{
+			name: "external certificates ignore the names of the built-in objects",
+			modify: func(c *Config) {
+				c.Webhook.ServiceName = "webhook.service"
+			},
+		},
+		{
+			name: "unsupported components",
+			modify: func(c *Config) {
+				c.Manager.Components = "proxy"
+			},
+			wantErrs: []string{"manager.components"},
+		},
+		{
+			name: "unsupported proxy conflicts mode",
+			modify: func(c *Config) {
+				c.Webhook.ProxyConflicts = "Ignore"
+			},
+			wantErrs: []string{"webhook.proxyConflicts"},
+		},
+		{
+			name: "negative resync period",
+			modify: func(c *Config) {
+				c.Manager.ResyncPeriod.Duration = -time.Minute
+			},
+			wantErrs: []string{"manager.resyncPeriod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg = Default()
+
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want errors of %v", tt.wantErrs)
+			}
+
+			for _, field := range tt.wantErrs {
+				if !strings.Contains(err.Error(), field+":") {
+					t.Errorf("Validate() error = %v, want an error of %s", err, field)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceObjectNames(t *testing.T) {
+	var tests = []struct {
+		instance             string
+		wantPodWebhook       string
+		wantLeaderElectionID string
+		wantLastKnownGood    string
+	}{
+		{
+			instance:             "",
+			wantPodWebhook:       constants.PodWebhookName,
+			wantLeaderElectionID: constants.LeaderElectionID,
+			wantLastKnownGood:    constants.LastKnownGoodSecretName,
+		},
+		{
+			instance:             constants.DefaultInstanceName,
+			wantPodWebhook:       constants.PodWebhookName,
+			wantLeaderElectionID: constants.LeaderElectionID,
+			wantLastKnownGood:    constants.LastKnownGoodSecretName,
+		},
+		{
+			instance:             "canary",
+			wantPodWebhook:       "canary." + constants.PodWebhookName,
+			wantLeaderElectionID: "canary." + constants.LeaderElectionID,
+			wantLastKnownGood:    "canary-" + constants.LastKnownGoodSecretName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.instance, func(t *testing.T) {
+			if got := PodWebhookName(tt.instance); got != tt.wantPodWebhook {
+				t.Errorf("PodWebhookName() = %q, want %q", got, tt.wantPodWebhook)
+			}
+
+			if got := LeaderElectionID(tt.instance); got != tt.wantLeaderElectionID {
+				t.Errorf("LeaderElectionID() = %q, want %q", got, tt.wantLeaderElectionID)
+			}
+
+			if got := LastKnownGoodSecretName(tt.instance); got != tt.wantLastKnownGood {
+				t.Errorf("LastKnownGoodSecretName() = %q, want %q", got, tt.wantLastKnownGood)
+			}
+		})
+	}
+}
+
+func TestIsCNISourceAllowed(t *testing.T) {
+	var cfg = Default()
+
+	cfg.AllowedCNISources = CNISources{
+		ConfigMaps: []ConfigMapKeyRef{
+			{Namespace: "linkerd-canary", Name: "linkerd-cni-config"},
+			{Namespace: "linkerd-edge", Name: "linkerd-cni-config", Key: "cni_network_config"},
+		},
+		Kubeconfigs: []string{"/etc/cni/net.d/ZZZ-linkerd-cni-canary-kubeconfig"},
+	}
+
+	var configMapTests = []struct {
+		name               string
+		namespace, cm, key string
+		want               bool
+	}{
+		{
+			name:      "operator's ConfigMap",
+			namespace: cfg.CNIConfigMap.Namespace, cm: cfg.CNIConfigMap.Name, key: cfg.CNIConfigMap.Key,
+			want: true,
+		},
+		{
+			name:      "another key of the operator's ConfigMap",
+			namespace: cfg.CNIConfigMap.Namespace, cm: cfg.CNIConfigMap.Name, key: "other",
+		},
+		{
+			name:      "any key of an allowed ConfigMap",
+			namespace: "linkerd-canary", cm: "linkerd-cni-config", key: "other",
+			want: true,
+		},
+		{
+			name:      "allowed key",
+			namespace: "linkerd-edge", cm: "linkerd-cni-config", key: "cni_network_config",
+			want: true,
+		},
+		{
+			name:      "another key of a ConfigMap with an allowed key",
+			namespace: "linkerd-edge", cm: "linkerd-cni-config", key: "other",
+		},
+		{
+			name:      "ConfigMap with the allowed name in another Namespace",
+			namespace: "default", cm: "linkerd-cni-config", key: "cni_network_config",
+		},
+	}
+
+	for _, tt := range configMapTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.IsCNIConfigMapAllowed(tt.namespace, tt.cm, tt.key); got != tt.want {
+				t.Errorf("IsCNIConfigMapAllowed() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	var kubeconfigTests = []struct {
+		path string
+		want bool
+	}{
+		{path: cfg.CNIKubeconfig, want: true},
+		{path: "/etc/cni/net.d/ZZZ-linkerd-cni-canary-kubeconfig", want: true},
+		{path: "/etc/cni/net.d/../net.d/ZZZ-linkerd-cni-canary-kubeconfig"},
+		{path: "/etc/kubernetes/admin.conf"},
+	}
+
+	for _, tt := range kubeconfigTests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cfg.IsCNIKubeconfigAllowed(tt.path); got != tt.want {
+				t.Errorf("IsCNIKubeconfigAllowed() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNamespaceWatched(t *testing.T) {
+	var tests = []struct {
+		name      string
+		watched   []string
+		namespace string
+		want      bool
+	}{
+		{name: "every Namespace is watched by default", namespace: "apps", want: true},
+		{name: "watched Namespace", watched: []string{"apps", "web"}, namespace: "web", want: true},
+		{name: "other Namespace", watched: []string{"apps", "web"}, namespace: "kube-system"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg = Default()
+
+			cfg.Manager.WatchNamespaces = tt.watched
+
+			if got := cfg.IsNamespaceWatched(tt.namespace); got != tt.want {
+				t.Errorf("IsNamespaceWatched() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponents(t *testing.T) {
+	var tests = []struct {
+		components      string
+		wantControllers bool
+		wantWebhook     bool
+	}{
+		{components: ComponentsAll, wantControllers: true, wantWebhook: true},
+		{components: ComponentsControllers, wantControllers: true},
+		{components: ComponentsWebhook, wantWebhook: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.components, func(t *testing.T) {
+			var cfg = Default()
+
+			cfg.Manager.Components = tt.components
+
+			if got := cfg.RunsControllers(); got != tt.wantControllers {
+				t.Errorf("RunsControllers() = %t, want %t", got, tt.wantControllers)
+			}
+
+			if got := cfg.RunsWebhook(); got != tt.wantWebhook {
+				t.Errorf("RunsWebhook() = %t, want %t", got, tt.wantWebhook)
+			}
+		})
+	}
+}
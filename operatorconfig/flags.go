@@ -0,0 +1,160 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// Flags - command-line equivalents of the configuration file settings.
+// Only explicitly set flags override the configuration file.
+type Flags struct {
+	flagSet *flag.FlagSet
+	values  *Config
+
+	// ConfigFile - path to the configuration file.
+	ConfigFile string
+
+	excludedNamespaces string
+	watchNamespaces    string
+	resyncPeriod       time.Duration
+}
+
+// BindFlags - registers the configuration flags in the flag set.
+func BindFlags(fs *flag.FlagSet) *Flags {
+	var (
+		f        = &Flags{flagSet: fs, values: Default()}
+		defaults = Default()
+	)
+
+	fs.StringVar(&f.ConfigFile, "config", "",
+		"Path to the operator configuration file. Flags override values from the file.")
+	fs.StringVar(&f.values.InstanceName, "instance-name", defaults.InstanceName,
+		"Name of the operator instance.")
+	fs.StringVar(&f.values.CNIConfigMap.Namespace, "cni-config-map-namespace", defaults.CNIConfigMap.Namespace,
+		"Namespace of the Linkerd CNI ConfigMap.")
+	fs.StringVar(&f.values.CNIConfigMap.Name, "cni-config-map-name", defaults.CNIConfigMap.Name,
+		"Name of the Linkerd CNI ConfigMap.")
+	fs.StringVar(&f.values.CNIConfigMap.Key, "cni-config-map-key", defaults.CNIConfigMap.Key,
+		"Key of the Linkerd CNI ConfigMap which contains CNI configuration.")
+	fs.StringVar(&f.values.CNIKubeconfig, "cni-kubeconfig", defaults.CNIKubeconfig,
+		"Path to the Linkerd CNI kubeconfig on nodes.")
+	fs.StringVar(&f.values.Manager.MetricsBindAddress, "metrics-bind-address", defaults.Manager.MetricsBindAddress,
+		"The address the metric endpoint binds to.")
+	fs.StringVar(&f.values.Manager.HealthProbeBindAddress, "health-probe-bind-address",
+		defaults.Manager.HealthProbeBindAddress, "The address the probe endpoint binds to.")
+	fs.BoolVar(&f.values.Manager.LeaderElect, "leader-elect", defaults.Manager.LeaderElect,
+		"Enable leader election for controller manager. "+
+			"Enabling this will ensure there is only one active controller manager.")
+	fs.StringVar(&f.values.Manager.Components, "components", defaults.Manager.Components,
+		"Components run by the process: all, controllers or webhook. "+
+			"The webhook does not use leader election and can be scaled horizontally.")
+	fs.DurationVar(&f.resyncPeriod, "resync-period", DefaultResyncPeriod,
+		"How often all AttachDefinitions are reconciled and orphaned NetworkAttachmentDefinitions are deleted, "+
+			"0 disables the periodic resync.")
+	fs.StringVar(&f.watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of Namespaces which the operator watches. All Namespaces are watched if empty.")
+	fs.IntVar(&f.values.Webhook.Port, "webhook-port", defaults.Webhook.Port,
+		"Port of the webhook server.")
+	fs.StringVar(&f.values.Webhook.CertDir, "webhook-cert-dir", defaults.Webhook.CertDir,
+		"Directory with the webhook server certificate tls.crt and key tls.key.")
+	fs.StringVar(&f.values.Webhook.CertManagement, "webhook-cert-management", defaults.Webhook.CertManagement,
+		"Webhook certificate management: External, for example, cert-manager, or BuiltIn.")
+	fs.StringVar(&f.values.Webhook.ProxyConflicts, "webhook-proxy-conflicts", defaults.Webhook.ProxyConflicts,
+		"Warn or Deny Pods whose containers run as the proxy UID or declare ports used or skipped by the proxy.")
+	fs.StringVar(&f.excludedNamespaces, "excluded-namespaces", "",
+		"Comma separated list of Namespaces which the operator does not manage.")
+
+	return f
+}
+
+// Apply - applies explicitly set flags to the configuration.
+func (f *Flags) Apply(cfg *Config) {
+	f.flagSet.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "instance-name":
+			cfg.InstanceName = f.values.InstanceName
+		case "cni-config-map-namespace":
+			cfg.CNIConfigMap.Namespace = f.values.CNIConfigMap.Namespace
+		case "cni-config-map-name":
+			cfg.CNIConfigMap.Name = f.values.CNIConfigMap.Name
+		case "cni-config-map-key":
+			cfg.CNIConfigMap.Key = f.values.CNIConfigMap.Key
+		case "cni-kubeconfig":
+			cfg.CNIKubeconfig = f.values.CNIKubeconfig
+		case "metrics-bind-address":
+			cfg.Manager.MetricsBindAddress = f.values.Manager.MetricsBindAddress
+		case "health-probe-bind-address":
+			cfg.Manager.HealthProbeBindAddress = f.values.Manager.HealthProbeBindAddress
+		case "leader-elect":
+			cfg.Manager.LeaderElect = f.values.Manager.LeaderElect
+		case "components":
+			cfg.Manager.Components = f.values.Manager.Components
+		case "resync-period":
+			cfg.Manager.ResyncPeriod.Duration = f.resyncPeriod
+		case "watch-namespaces":
+			cfg.Manager.WatchNamespaces = splitList(f.watchNamespaces)
+		case "webhook-port":
+			cfg.Webhook.Port = f.values.Webhook.Port
+		case "webhook-cert-dir":
+			cfg.Webhook.CertDir = f.values.Webhook.CertDir
+		case "webhook-cert-management":
+			cfg.Webhook.CertManagement = f.values.Webhook.CertManagement
+		case "webhook-proxy-conflicts":
+			cfg.Webhook.ProxyConflicts = f.values.Webhook.ProxyConflicts
+		case "excluded-namespaces":
+			cfg.Exclusions.Namespaces = splitList(f.excludedNamespaces)
+		}
+	})
+}
+
+// Load - builds the configuration from defaults, environment variables,
+// the configuration file and flags, in this order, and validates it.
+func (f *Flags) Load() (*Config, error) {
+	var cfg = Default()
+
+	cfg.ApplyEnv()
+
+	if f.ConfigFile != "" {
+		if err := cfg.ApplyFile(f.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	f.Apply(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// splitList - splits a comma separated list omitting empty elements.
+func splitList(list string) []string {
+	var result []string
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
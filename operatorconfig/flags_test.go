@@ -0,0 +1,159 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/constants"
+)
+
+func TestFlagsLoad(t *testing.T) {
+	const header = "apiVersion: " + APIVersion + "\nkind: " + Kind + "\n"
+
+	var tests = []struct {
+		name string
+		env  map[string]string
+		// file - content of the configuration file, the file is not used if empty.
+		file             string
+		args             []string
+		wantInstance     string
+		wantCNIConfigMap ConfigMapKeyRef
+		wantExcluded     []string
+		wantErr          bool
+	}{
+		{
+			name:         "defaults",
+			wantInstance: constants.DefaultInstanceName,
+			wantCNIConfigMap: ConfigMapKeyRef{
+				Namespace: constants.DefaultLinkerdCNICMNamespace,
+				Name:      constants.DefaultLinkerdCNICMName,
+				Key:       constants.DefaultLinkerdCNICMKey,
+			},
+		},
+		{
+			name: "environment variables override defaults",
+			env: map[string]string{
+				constants.EnvInstanceName:          "env",
+				constants.EnvCNIConfigMapNamespace: "linkerd-cni-env",
+				constants.EnvCNIConfigMapName:      "cni-env",
+				constants.EnvCNIConfigMapKey:       "cni.conf",
+			},
+			wantInstance:     "env",
+			wantCNIConfigMap: ConfigMapKeyRef{Namespace: "linkerd-cni-env", Name: "cni-env", Key: "cni.conf"},
+		},
+		{
+			name: "file overrides environment variables",
+			env: map[string]string{
+				constants.EnvInstanceName:     "env",
+				constants.EnvCNIConfigMapName: "cni-env",
+			},
+			file:         header + "instanceName: file\nexclusions:\n  namespaces: [kube-system]\n",
+			wantInstance: "file",
+			wantCNIConfigMap: ConfigMapKeyRef{
+				Namespace: constants.DefaultLinkerdCNICMNamespace,
+				Name:      "cni-env",
+				Key:       constants.DefaultLinkerdCNICMKey,
+			},
+			wantExcluded: []string{"kube-system"},
+		},
+		{
+			name:         "flags override the file",
+			env:          map[string]string{constants.EnvInstanceName: "env"},
+			file:         header + "instanceName: file\nexclusions:\n  namespaces: [kube-system]\n",
+			args:         []string{"--instance-name=flag", "--excluded-namespaces=a, b,"},
+			wantInstance: "flag",
+			wantCNIConfigMap: ConfigMapKeyRef{
+				Namespace: constants.DefaultLinkerdCNICMNamespace,
+				Name:      constants.DefaultLinkerdCNICMName,
+				Key:       constants.DefaultLinkerdCNICMKey,
+			},
+			wantExcluded: []string{"a", "b"},
+		},
+		{
+			name:    "unsupported kind",
+			file:    "apiVersion: " + APIVersion + "\nkind: Config\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			file:    header + "instance: file\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid result",
+			args:    []string{"--instance-name=Invalid_Name"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{
+				constants.EnvInstanceName, constants.EnvCNIConfigMapNamespace, constants.EnvCNIConfigMapName,
+				constants.EnvCNIConfigMapKey, constants.EnvCNIKubeconfig,
+			} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			var (
+				fs    = flag.NewFlagSet("test", flag.ContinueOnError)
+				flags = BindFlags(fs)
+				args  = tt.args
+			)
+
+			if tt.file != "" {
+				var path = filepath.Join(t.TempDir(), "config.yaml")
+
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				args = append([]string{"--config=" + path}, args...)
+			}
+
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := flags.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if cfg.InstanceName != tt.wantInstance {
+				t.Errorf("instanceName = %q, want %q", cfg.InstanceName, tt.wantInstance)
+			}
+
+			if cfg.CNIConfigMap != tt.wantCNIConfigMap {
+				t.Errorf("cniConfigMap = %+v, want %+v", cfg.CNIConfigMap, tt.wantCNIConfigMap)
+			}
+
+			if !reflect.DeepEqual(cfg.Exclusions.Namespaces, tt.wantExcluded) {
+				t.Errorf("exclusions.namespaces = %v, want %v", cfg.Exclusions.Namespaces, tt.wantExcluded)
+			}
+		})
+	}
+}
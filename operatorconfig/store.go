@@ -0,0 +1,145 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Store - holds the current configuration and reloads it when the configuration file changes.
+// Configurations returned by Get must not be modified.
+type Store struct {
+	mu     sync.RWMutex
+	config *Config
+	load   func() (*Config, error)
+	path   string
+
+	handlers []func(ctx context.Context)
+}
+
+// NewStore - creates a Store with the initial configuration. If path is not empty,
+// Start watches the file and reloads the configuration with the load function.
+func NewStore(cfg *Config, path string, load func() (*Config, error)) *Store {
+	return &Store{config: cfg, path: path, load: load}
+}
+
+// Get - returns the current configuration.
+func (s *Store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.config
+}
+
+// AddReloadHandler - registers a function which is called after the configuration is reloaded
+// from the watched file. It must be called before the Store is started.
+func (s *Store) AddReloadHandler(handler func(ctx context.Context)) {
+	s.handlers = append(s.handlers, handler)
+}
+
+// Reload - loads the configuration and applies its non-structural settings.
+// Changes of structural settings are ignored until the operator restarts.
+func (s *Store) Reload() error {
+	logger := ctrl.Log.WithName("operatorconfig")
+
+	cfg, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.InstanceName != s.config.InstanceName ||
+		!reflect.DeepEqual(cfg.Manager, s.config.Manager) ||
+		!reflect.DeepEqual(cfg.Webhook, s.config.Webhook) {
+		logger.Info("Structural settings instanceName, manager and webhook are changed, restart to apply them")
+
+		cfg.InstanceName = s.config.InstanceName
+		cfg.Manager = s.config.Manager
+		cfg.Webhook = s.config.Webhook
+	}
+
+	s.config = cfg
+
+	logger.Info("Configuration is reloaded")
+
+	return nil
+}
+
+// Start - watches the configuration file until the context is done.
+// The file's directory is watched as ConfigMap volumes replace files via symlinks.
+func (s *Store) Start(ctx context.Context) error {
+	if s.path == "" {
+		return nil
+	}
+
+	logger := ctrl.Log.WithName("operatorconfig").WithValues("path", s.path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	if err = watcher.Add(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			if err := s.Reload(); err != nil {
+				logger.Error(err, "can not reload configuration, keep the previous one")
+
+				continue
+			}
+
+			for _, handler := range s.handlers {
+				handler(ctx)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			logger.Error(err, "configuration file watch error")
+		}
+	}
+}
+
+// NeedLeaderElection - every replica reloads its configuration.
+func (s *Store) NeedLeaderElection() bool {
+	return false
+}
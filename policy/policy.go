@@ -0,0 +1,247 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy evaluates cluster-scoped AttachDefinitionPolicies which restrict what
+// Namespace editors may set in AttachDefinitions. The policies are enforced by the
+// validating webhook and by the AttachDefinition reconciler.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+	"github.com/ErmakovDmitriy/linkerd-cni-attach-operator/operatorconfig"
+)
+
+// portRange - an inclusive range of ports.
+type portRange struct {
+	first, last int
+}
+
+// Check - returns violations of all AttachDefinitionPolicies which select the Namespace by the spec.
+func Check(ctx context.Context, c client.Reader, namespaceName string,
+	spec *cniv1alpha1.AttachDefinitionSpec) (field.ErrorList, error) {
+	var policies = &cniv1alpha1.AttachDefinitionPolicyList{}
+
+	if err := c.List(ctx, policies); err != nil {
+		return nil, err
+	}
+
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	var namespace = &corev1.Namespace{}
+
+	// Namespaces which can not be read, for example, in the namespace-scoped mode, have no labels.
+	if err := c.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace); err != nil &&
+		!apierrors.IsForbidden(err) && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return Evaluate(policies.Items, namespace.Labels, spec)
+}
+
+// Evaluate - returns violations of the policies which select a Namespace with the labels by the spec.
+func Evaluate(policies []cniv1alpha1.AttachDefinitionPolicy, namespaceLabels map[string]string,
+	spec *cniv1alpha1.AttachDefinitionSpec) (field.ErrorList, error) {
+	var errs field.ErrorList
+
+	for i := range policies {
+		selected, err := Selects(&policies[i], namespaceLabels)
+		if err != nil {
+			return nil, fmt.Errorf("AttachDefinitionPolicy %s: %w", policies[i].Name, err)
+		}
+
+		if selected {
+			errs = append(errs, Validate(&policies[i], spec)...)
+		}
+	}
+
+	return errs, nil
+}
+
+// Selects - checks if the policy selects a Namespace with the labels.
+func Selects(policy *cniv1alpha1.AttachDefinitionPolicy, namespaceLabels map[string]string) (bool, error) {
+	if policy.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+
+	return selector.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// Validate - returns violations of the policy by the spec.
+func Validate(policy *cniv1alpha1.AttachDefinitionPolicy, spec *cniv1alpha1.AttachDefinitionSpec) field.ErrorList {
+	var (
+		errs   field.ErrorList
+		path   = field.NewPath("spec")
+		config = path.Child("proxyConfig")
+		by     = "forbidden by AttachDefinitionPolicy " + policy.Name
+	)
+
+	for _, setting := range policy.Spec.Forbidden {
+		if isSet(spec, setting) {
+			errs = append(errs, field.Forbidden(path.Child(string(setting)), by))
+		}
+	}
+
+	if restriction := policy.Spec.SkipInboundPorts; restriction != nil {
+		errs = append(errs, validatePorts(config.Child("skipInboundPorts"), spec.Config.SkipInboundPorts,
+			restriction.Allowed, by)...)
+	}
+
+	if restriction := policy.Spec.SkipOutboundPorts; restriction != nil {
+		errs = append(errs, validatePorts(config.Child("skipOutboundPorts"), spec.Config.SkipOutboundPorts,
+			restriction.Allowed, by)...)
+	}
+
+	if restriction := policy.Spec.ProxyUIDs; restriction != nil && spec.Config.ProxyUID != nil &&
+		!isUIDAllowed(*spec.Config.ProxyUID, restriction.Allowed) {
+		errs = append(errs, field.Invalid(config.Child("proxyUID"), int64(*spec.Config.ProxyUID), "UID is "+by))
+	}
+
+	return errs
+}
+
+// isSet - checks if the setting differs from its default value in the spec.
+func isSet(spec *cniv1alpha1.AttachDefinitionSpec, setting cniv1alpha1.PolicySetting) bool {
+	switch setting {
+	case cniv1alpha1.PolicySettingCNISource:
+		return spec.CNISource != nil
+	case cniv1alpha1.PolicySettingInboundPort:
+		return spec.Config.InboundPort != 0
+	case cniv1alpha1.PolicySettingOutboundPort:
+		return spec.Config.OutboundPort != 0
+	case cniv1alpha1.PolicySettingLogLevel:
+		return spec.Config.LogLevel != ""
+	case cniv1alpha1.PolicySettingProxyUID:
+		return spec.Config.ProxyUID != nil
+	case cniv1alpha1.PolicySettingSkipInboundPorts:
+		return len(spec.Config.SkipInboundPorts) != 0
+	case cniv1alpha1.PolicySettingSkipOutboundPorts:
+		return len(spec.Config.SkipOutboundPorts) != 0
+	case cniv1alpha1.PolicySettingSkipOutboundServices:
+		return len(spec.Config.SkipOutboundServices) != 0
+	case cniv1alpha1.PolicySettingMissedPodPolicy:
+		return spec.MissedPodPolicy != "" && spec.MissedPodPolicy != cniv1alpha1.MissedPodPolicyReport
+	}
+
+	return false
+}
+
+// validatePorts - every port or range must be within one of the allowed ports or ranges.
+// An entry which sets both a port and a range is rendered as both, so both must be allowed.
+func validatePorts(path *field.Path, ports, allowed []cniv1alpha1.Ports, by string) field.ErrorList {
+	var (
+		errs          field.ErrorList
+		allowedRanges = make([]portRange, 0, len(allowed))
+	)
+
+	for _, ports := range allowed {
+		// An invalid allowed entry does not allow anything.
+		if ranges, err := toPortRanges(ports); err == nil {
+			allowedRanges = append(allowedRanges, ranges...)
+		}
+	}
+
+	for i, ports := range ports {
+		ranges, err := toPortRanges(ports)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), ports, err.Error()))
+
+			continue
+		}
+
+		for _, r := range ranges {
+			if !isRangeAllowed(r, allowedRanges) {
+				errs = append(errs, field.Invalid(path.Index(i), portsString(ports), "port is "+by))
+
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// toPortRanges - converts a port and a port range of an entry to ranges. An entry without
+// a range is a port, even if the port is not set.
+func toPortRanges(ports cniv1alpha1.Ports) ([]portRange, error) {
+	var ranges []portRange
+
+	if ports.Port != 0 || ports.Range == "" {
+		ranges = append(ranges, portRange{first: int(ports.Port), last: int(ports.Port)})
+	}
+
+	if ports.Range != "" {
+		first, last, err := operatorconfig.ParsePortRange(ports.Range)
+		if err != nil {
+			return nil, err
+		}
+
+		ranges = append(ranges, portRange{first: first, last: last})
+	}
+
+	return ranges, nil
+}
+
+// isRangeAllowed - checks if the range is within one of the allowed ranges.
+func isRangeAllowed(r portRange, allowed []portRange) bool {
+	for _, a := range allowed {
+		if r.first >= a.first && r.last <= a.last {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isUIDAllowed - checks if the user ID is within one of the allowed ranges.
+func isUIDAllowed(uid uint32, allowed []cniv1alpha1.UIDRange) bool {
+	for _, r := range allowed {
+		if uid >= r.Min && uid <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// portsString - returns a port and a port range as they are written in Linkerd annotations.
+func portsString(ports cniv1alpha1.Ports) string {
+	switch {
+	case ports.Range == "":
+		return strconv.Itoa(int(ports.Port))
+	case ports.Port == 0:
+		return ports.Range
+	}
+
+	return strconv.Itoa(int(ports.Port)) + "," + ports.Range
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+// restrictedPolicy - a policy which restricts Namespaces labelled with tier=restricted.
+func restrictedPolicy(name string, spec cniv1alpha1.AttachDefinitionPolicySpec) *cniv1alpha1.AttachDefinitionPolicy {
+	if spec.NamespaceSelector == nil {
+		spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "restricted"}}
+	}
+
+	return &cniv1alpha1.AttachDefinitionPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestCheck(t *testing.T) {
+	var uid = uint32(1000)
+
+	var (
+		forbidCNISource = restrictedPolicy("forbid-cni-source", cniv1alpha1.AttachDefinitionPolicySpec{
+			Forbidden: []cniv1alpha1.PolicySetting{cniv1alpha1.PolicySettingCNISource},
+		})
+		allowWebPorts = restrictedPolicy("allow-web-ports", cniv1alpha1.AttachDefinitionPolicySpec{
+			SkipInboundPorts: &cniv1alpha1.PortRestriction{
+				Allowed: []cniv1alpha1.Ports{{Port: 443}, {Range: "8000-8100"}},
+			},
+		})
+		allowSystemUIDs = restrictedPolicy("allow-system-uids", cniv1alpha1.AttachDefinitionPolicySpec{
+			ProxyUIDs: &cniv1alpha1.UIDRestriction{Allowed: []cniv1alpha1.UIDRange{{Min: 2000, Max: 2999}}},
+		})
+		everyNamespace = restrictedPolicy("every-namespace", cniv1alpha1.AttachDefinitionPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{},
+			Forbidden:         []cniv1alpha1.PolicySetting{cniv1alpha1.PolicySettingMissedPodPolicy},
+		})
+	)
+
+	var tests = []struct {
+		name      string
+		namespace string
+		policies  []client.Object
+		spec      cniv1alpha1.AttachDefinitionSpec
+		want      []string
+	}{
+		{
+			name:      "no policies",
+			namespace: "restricted",
+			spec:      cniv1alpha1.AttachDefinitionSpec{CNISource: &cniv1alpha1.CNISource{}},
+		},
+		{
+			name:      "forbidden setting",
+			namespace: "restricted",
+			policies:  []client.Object{forbidCNISource},
+			spec:      cniv1alpha1.AttachDefinitionSpec{CNISource: &cniv1alpha1.CNISource{}},
+			want:      []string{"spec.cniSource"},
+		},
+		{
+			name:      "forbidden setting is not set",
+			namespace: "restricted",
+			policies:  []client.Object{forbidCNISource},
+		},
+		{
+			name:      "namespace is not selected",
+			namespace: "open",
+			policies:  []client.Object{forbidCNISource},
+			spec:      cniv1alpha1.AttachDefinitionSpec{CNISource: &cniv1alpha1.CNISource{}},
+		},
+		{
+			name:      "missing namespace is selected only by policies without selector",
+			namespace: "missing",
+			policies:  []client.Object{forbidCNISource, everyNamespace},
+			spec: cniv1alpha1.AttachDefinitionSpec{
+				CNISource:       &cniv1alpha1.CNISource{},
+				MissedPodPolicy: cniv1alpha1.MissedPodPolicyEvict,
+			},
+			want: []string{"spec.missedPodPolicy"},
+		},
+		{
+			name:      "allowed ports and ranges",
+			namespace: "restricted",
+			policies:  []client.Object{allowWebPorts},
+			spec: cniv1alpha1.AttachDefinitionSpec{Config: cniv1alpha1.ProxyConfig{
+				SkipInboundPorts: []cniv1alpha1.Ports{{Port: 443}, {Port: 8080}, {Range: "8000-8050"}},
+			}},
+		},
+		{
+			name:      "ports outside the allowed ones",
+			namespace: "restricted",
+			policies:  []client.Object{allowWebPorts},
+			spec: cniv1alpha1.AttachDefinitionSpec{Config: cniv1alpha1.ProxyConfig{
+				SkipInboundPorts: []cniv1alpha1.Ports{{Port: 443}, {Port: 22}, {Range: "8000-9000"}},
+			}},
+			want: []string{"spec.proxyConfig.skipInboundPorts[1]", "spec.proxyConfig.skipInboundPorts[2]"},
+		},
+		{
+			name:      "port and range of one entry",
+			namespace: "restricted",
+			policies:  []client.Object{allowWebPorts},
+			spec: cniv1alpha1.AttachDefinitionSpec{Config: cniv1alpha1.ProxyConfig{
+				SkipInboundPorts: []cniv1alpha1.Ports{
+					{Port: 443, Range: "8000-8050"},
+					{Port: 443, Range: "1-65535"},
+					{Port: 22, Range: "8000-8050"},
+				},
+			}},
+			want: []string{"spec.proxyConfig.skipInboundPorts[1]", "spec.proxyConfig.skipInboundPorts[2]"},
+		},
+		{
+			name:      "invalid range",
+			namespace: "restricted",
+			policies:  []client.Object{allowWebPorts},
+			spec: cniv1alpha1.AttachDefinitionSpec{Config: cniv1alpha1.ProxyConfig{
+				SkipInboundPorts: []cniv1alpha1.Ports{{Range: "8100-8000"}},
+			}},
+			want: []string{"spec.proxyConfig.skipInboundPorts[0]"},
+		},
+		{
+			name:      "UID outside the allowed ranges",
+			namespace: "restricted",
+			policies:  []client.Object{allowSystemUIDs},
+			spec:      cniv1alpha1.AttachDefinitionSpec{Config: cniv1alpha1.ProxyConfig{ProxyUID: &uid}},
+			want:      []string{"spec.proxyConfig.proxyUID"},
+		},
+		{
+			name:      "violations of every selecting policy",
+			namespace: "restricted",
+			policies:  []client.Object{forbidCNISource, allowSystemUIDs, everyNamespace},
+			spec: cniv1alpha1.AttachDefinitionSpec{
+				CNISource:       &cniv1alpha1.CNISource{},
+				MissedPodPolicy: cniv1alpha1.MissedPodPolicyEvict,
+				Config:          cniv1alpha1.ProxyConfig{ProxyUID: &uid},
+			},
+			// Policies are listed by name.
+			want: []string{"spec.proxyConfig.proxyUID", "spec.missedPodPolicy", "spec.cniSource"},
+		},
+	}
+
+	var scheme = runtime.NewScheme()
+
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cniv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects = append([]client.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name: "restricted", Labels: map[string]string{"tier": "restricted"},
+				}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "open"}},
+			}, tt.policies...)
+
+			var c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+			errs, err := Check(context.Background(), c, tt.namespace, &tt.spec)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Field)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
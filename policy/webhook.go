@@ -0,0 +1,73 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cniv1alpha1 "github.com/ErmakovDmitriy/linkerd-cni-attach-operator/api/v1alpha1"
+)
+
+//nolint:lll
+//+kubebuilder:webhook:path=/validate-cni-linkerd-io-v1alpha1-attachdefinition,mutating=false,failurePolicy=ignore,groups=cni.linkerd.io,resources=attachdefinitions,verbs=create;update,versions=v1alpha1,name=policy.attachdefinition.cni.linkerd.io,admissionReviewVersions=v1,sideEffects=None
+//+kubebuilder:rbac:groups=cni.linkerd.io,resources=attachdefinitionpolicies,verbs=get;list;watch
+
+// Validator - denies AttachDefinitions which violate AttachDefinitionPolicies of their Namespace.
+type Validator struct {
+	Client  client.Reader
+	decoder *admission.Decoder
+}
+
+// Handle - validates the AttachDefinition against the policies.
+// nolint:gocritic // hugeParam - admission.Request is passed not as a pointer to conform to admission.Handler interface.
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.FromContext(ctx).WithValues("request_namespace", req.Namespace, "request_name", req.Name)
+
+	var attachDefinition = &cniv1alpha1.AttachDefinition{}
+
+	if err := v.decoder.Decode(req, attachDefinition); err != nil {
+		logger.Error(err, "can not decode AttachDefinition")
+
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	violations, err := Check(ctx, v.Client, req.Namespace, &attachDefinition.Spec)
+	if err != nil {
+		logger.Error(err, "can not check AttachDefinitionPolicies")
+
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if len(violations) != 0 {
+		logger.Info("AttachDefinition violates AttachDefinitionPolicies", "violations", violations.ToAggregate().Error())
+
+		return admission.Denied(violations.ToAggregate().Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// InjectDecoder - injects the decoder.
+func (v *Validator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}